@@ -0,0 +1,135 @@
+// Package accounting tracks LLM token usage and cost per tenant and enforces budgets.
+package accounting
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/vijaylingoju/prompterdb/llm"
+)
+
+// ErrBudgetExceeded is returned when a tenant has used up its budget
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// Budget limits the usage of a tenant. Zero values mean no limit.
+type Budget struct {
+	MaxTokens int
+	MaxCost   float64
+}
+
+// TenantUsage is the accumulated usage of a tenant
+type TenantUsage struct {
+	Calls   int                  `json:"calls"`
+	Usage   llm.Usage            `json:"usage"`
+	Cost    float64              `json:"cost"`
+	ByModel map[string]llm.Usage `json:"by_model"`
+}
+
+// Ledger records usage and cost per tenant.
+// A tenant is any string the caller uses for chargeback, such as a team or session ID.
+type Ledger struct {
+	prices  llm.PriceTable
+	mu      sync.RWMutex
+	budgets map[string]Budget
+	usage   map[string]*TenantUsage
+}
+
+// NewLedger creates a Ledger that prices usage with the given table
+func NewLedger(prices llm.PriceTable) *Ledger {
+	return &Ledger{
+		prices:  prices,
+		budgets: make(map[string]Budget),
+		usage:   make(map[string]*TenantUsage),
+	}
+}
+
+// SetBudget sets the budget of a tenant
+func (l *Ledger) SetBudget(tenant string, budget Budget) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.budgets[tenant] = budget
+}
+
+// Check returns ErrBudgetExceeded if the tenant has reached its budget
+func (l *Ledger) Check(tenant string) error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	budget, ok := l.budgets[tenant]
+	if !ok {
+		return nil
+	}
+	used, ok := l.usage[tenant]
+	if !ok {
+		return nil
+	}
+
+	if budget.MaxTokens > 0 && used.Usage.TotalTokens >= budget.MaxTokens {
+		return fmt.Errorf("%w: tenant %q used %d of %d tokens", ErrBudgetExceeded, tenant, used.Usage.TotalTokens, budget.MaxTokens)
+	}
+	if budget.MaxCost > 0 && used.Cost >= budget.MaxCost {
+		return fmt.Errorf("%w: tenant %q spent %.4f of %.4f", ErrBudgetExceeded, tenant, used.Cost, budget.MaxCost)
+	}
+	return nil
+}
+
+// Record adds the usage of one LLM call to a tenant and returns its cost
+func (l *Ledger) Record(tenant, model string, usage llm.Usage) float64 {
+	cost := llm.Cost(l.prices, model, usage)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	used, ok := l.usage[tenant]
+	if !ok {
+		used = &TenantUsage{ByModel: make(map[string]llm.Usage)}
+		l.usage[tenant] = used
+	}
+	used.Calls++
+	used.Usage = used.Usage.Add(usage)
+	used.Cost += cost
+	used.ByModel[model] = used.ByModel[model].Add(usage)
+
+	return cost
+}
+
+// Usage returns the accumulated usage of a tenant
+func (l *Ledger) Usage(tenant string) TenantUsage {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	used, ok := l.usage[tenant]
+	if !ok {
+		return TenantUsage{ByModel: map[string]llm.Usage{}}
+	}
+	return copyUsage(used)
+}
+
+// Report returns a snapshot of the usage of every tenant, for chargeback
+func (l *Ledger) Report() map[string]TenantUsage {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	report := make(map[string]TenantUsage, len(l.usage))
+	for tenant, used := range l.usage {
+		report[tenant] = copyUsage(used)
+	}
+	return report
+}
+
+// Reset clears the recorded usage of a tenant, e.g. at the start of a billing period
+func (l *Ledger) Reset(tenant string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.usage, tenant)
+}
+
+func copyUsage(used *TenantUsage) TenantUsage {
+	c := *used
+	c.ByModel = make(map[string]llm.Usage, len(used.ByModel))
+	for model, usage := range used.ByModel {
+		c.ByModel[model] = usage
+	}
+	return c
+}
@@ -0,0 +1,305 @@
+package prompterdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/vijaylingoju/prompterdb/config"
+	"github.com/vijaylingoju/prompterdb/db"
+	"github.com/vijaylingoju/prompterdb/engine"
+	"github.com/vijaylingoju/prompterdb/llm"
+	"github.com/vijaylingoju/prompterdb/templates"
+)
+
+const (
+	// DefaultAgentSteps is the number of queries AskAgent runs when AskOptions.MaxAgentSteps is not set
+	DefaultAgentSteps = 5
+	// DefaultAgentTokens is the LLM token budget of AskAgent when AskOptions.MaxAgentTokens is not set
+	DefaultAgentTokens = 50000
+
+	// summaryRows is the number of rows of a step result shown to the model
+	summaryRows = 20
+	// maxSummaryLen bounds the length of a step summary, in bytes
+	maxSummaryLen = 4000
+)
+
+// ErrAgentTokenLimit is returned by AskAgent when the token budget ran out before an answer was composed
+var ErrAgentTokenLimit = errors.New("agent token budget exhausted")
+
+// AgentStep is a query run by AskAgent
+type AgentStep struct {
+	Index    int            `json:"index"`
+	Reason   string         `json:"reason,omitempty"` // why the model asked for the step
+	Database string         `json:"database"`
+	Prompt   string         `json:"prompt"`
+	Query    string         `json:"query,omitempty"`
+	Args     []llm.QueryArg `json:"args,omitempty"`
+	Result   *db.ResultSet  `json:"result,omitempty"`
+	Summary  string         `json:"summary"` // what the model was shown of the result
+	Error    string         `json:"error,omitempty"`
+	Usage    llm.Usage      `json:"usage"`
+}
+
+// AgentResult is the outcome of an AskAgent call
+type AgentResult struct {
+	Prompt string
+	Answer string
+	// Plan is the model's latest list of the steps it still meant to take
+	Plan  []string
+	Steps []*AgentStep
+	Usage llm.Usage // tokens consumed by all LLM calls, including the steps' queries
+	Cost  float64
+}
+
+// agentTurn is a reply of the model: the next step to take, or the answer
+type agentTurn struct {
+	Plan   []string `json:"plan"`
+	Answer string   `json:"answer"`
+	Step   *struct {
+		Database string `json:"database"`
+		Prompt   string `json:"prompt"`
+		Reason   string `json:"reason"`
+	} `json:"step"`
+}
+
+// AskAgent answers analytical questions that need several queries, such as comparing
+// this quarter's churn to the last one by plan. The model plans the steps and asks for
+// one query at a time; each is generated, validated and run like an Ask query, and a
+// summary of its result is shown to the model before the next turn. Once it has what it
+// needs, or the step limit is reached, the model composes the answer.
+//
+// Steps are bounded by opts.MaxAgentSteps and LLM tokens by opts.MaxAgentTokens. A failed
+// step is recorded and shown to the model rather than ending the run. When the token
+// budget runs out first, the result so far is returned with ErrAgentTokenLimit.
+func AskAgent(ctx context.Context, userPrompt string, llmClient llm.LLM, opts AskOptions) (*AgentResult, error) {
+	if userPrompt == "" {
+		return nil, errors.New("prompt is empty")
+	}
+	schema := GetAllSchemas()
+	if schema == "" {
+		return nil, errors.New("schema is empty – call IntrospectAllSchemas() first")
+	}
+	maxSteps, maxTokens := agentLimits(opts)
+	result := &AgentResult{Prompt: userPrompt}
+
+	// Count the tokens of every call, including those of steps that fail, and refuse
+	// calls once the budget is spent
+	counter := &usageCounter{LLM: llmClient, limit: maxTokens}
+	tm, err := useDefaultTemplates(counter)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		if result.Usage.TotalTokens >= maxTokens {
+			return result, fmt.Errorf("%w after %d tokens and %d steps", ErrAgentTokenLimit, result.Usage.TotalTokens, len(result.Steps))
+		}
+
+		final := len(result.Steps) >= maxSteps
+		turn, err := nextAgentTurn(ctx, userPrompt, schema, counter, opts, result, maxSteps, final)
+		result.Usage = counter.usage
+		if err != nil {
+			return result, err
+		}
+		if turn.Plan != nil {
+			result.Plan = turn.Plan
+		}
+		if turn.Answer != "" || turn.Step == nil {
+			result.Answer = turn.Answer
+			if result.Answer == "" {
+				return result, errors.New("the model returned neither a step nor an answer")
+			}
+			return result, nil
+		}
+		if final {
+			return result, fmt.Errorf("the model asked for another step after the limit of %d", maxSteps)
+		}
+
+		step := &AgentStep{
+			Index:    len(result.Steps) + 1,
+			Reason:   turn.Step.Reason,
+			Database: turn.Step.Database,
+			Prompt:   turn.Step.Prompt,
+		}
+		before := counter.usage
+		cost, err := runAgentStep(ctx, step, tm, counter, opts)
+		result.Cost += cost
+		step.Usage = counter.usage.Sub(before)
+		result.Usage = counter.usage
+		result.Steps = append(result.Steps, step)
+		if err != nil {
+			return result, fmt.Errorf("%w after %d tokens and %d steps", err, result.Usage.TotalTokens, len(result.Steps))
+		}
+	}
+}
+
+// agentLimits returns the step and token limits of an AskAgent run
+func agentLimits(opts AskOptions) (int, int) {
+	steps, tokens := opts.MaxAgentSteps, opts.MaxAgentTokens
+	if steps <= 0 {
+		steps = DefaultAgentSteps
+	}
+	if tokens <= 0 {
+		tokens = DefaultAgentTokens
+	}
+	return steps, tokens
+}
+
+// nextAgentTurn shows the model the steps so far and parses its reply. With final
+// set, the model is told to answer with what it has.
+func nextAgentTurn(ctx context.Context, userPrompt, schema string, llmClient llm.LLM, opts AskOptions, result *AgentResult, maxSteps int, final bool) (*agentTurn, error) {
+	req := llm.QueryRequest{
+		Prompt:    userPrompt,
+		Schema:    schema,
+		DBType:    "agent",
+		QueryType: llm.QueryTypeAgent,
+		CustomVars: map[string]interface{}{
+			"Databases": planDatabases(),
+			"Plan":      result.Plan,
+			"Steps":     result.Steps,
+			"StepsLeft": maxSteps - len(result.Steps),
+			"Final":     final,
+		},
+	}
+
+	// generateQuery charges the ledger as for Ask
+	turnResult := &AskResult{}
+	resp, err := generateQuery(ctx, llmClient, req, opts, turnResult)
+	if err != nil {
+		return nil, fmt.Errorf("llm planning failed: %w", err)
+	}
+	result.Cost += turnResult.Cost
+
+	var turn agentTurn
+	text := cleanMongoText(resp.Query)
+	if err := json.Unmarshal([]byte(text), &turn); err != nil {
+		return nil, fmt.Errorf("invalid agent reply: %w\nRaw response: %s", err, text)
+	}
+	return &turn, nil
+}
+
+// runAgentStep generates and runs the query of a step on its database, or on the
+// database the prompt is routed to when the model named none, and returns the cost
+// of generating it. Errors are recorded on the step; only ErrAgentTokenLimit, when
+// counter refuses to generate the query because the budget is spent, is returned.
+func runAgentStep(ctx context.Context, step *AgentStep, tm *templates.TemplateManager, counter *usageCounter, opts AskOptions) (float64, error) {
+	if strings.TrimSpace(step.Prompt) == "" {
+		step.Error = "the step has no prompt"
+		step.Summary = "Error: " + step.Error
+		return 0, nil
+	}
+	targetDB, ok := config.RegisteredDBs[step.Database]
+	if !ok {
+		if step.Database != "" {
+			log.Printf("Warning: agent step %d names unregistered database %q, routing the prompt instead", step.Index, step.Database)
+		}
+		routed, err := engine.RoutePrompt(ctx, step.Prompt)
+		if err != nil {
+			step.Error = fmt.Sprintf("failed to determine target database: %v", err)
+			step.Summary = "Error: " + step.Error
+			return 0, nil
+		}
+		targetDB = routed
+		step.Database = routed.Name
+	}
+
+	// Steps are written by the model, there is no user to ask
+	opts.AllowClarification = false
+	stepResult, err := askDatabase(ctx, step.Prompt, targetDB, GetSchema(targetDB.Name), tm, counter, opts)
+	if err != nil {
+		step.Error = err.Error()
+		step.Summary = "Error: " + step.Error
+		if errors.Is(err, ErrAgentTokenLimit) {
+			return 0, ErrAgentTokenLimit
+		}
+		return 0, nil
+	}
+	if stepResult.Result == nil {
+		stepResult.Result = db.NewResultSet(stepResult.Rows)
+	}
+	step.Query = stepResult.Query
+	step.Args = stepResult.Args
+	step.Result = stepResult.Result
+	step.Summary = summarizeResult(stepResult.Result)
+	return stepResult.Cost, nil
+}
+
+// usageCounter adds up the token usage of the calls made through an LLM, and
+// refuses calls once limit tokens, if set, are used
+type usageCounter struct {
+	llm.LLM
+	usage llm.Usage
+	limit int
+}
+
+// check returns ErrAgentTokenLimit when the token budget is spent
+func (c *usageCounter) check() error {
+	if c.limit > 0 && c.usage.TotalTokens >= c.limit {
+		return ErrAgentTokenLimit
+	}
+	return nil
+}
+
+func (c *usageCounter) GenerateQuery(req llm.QueryRequest) (*llm.QueryResponse, error) {
+	return c.GenerateQueryContext(context.Background(), req)
+}
+
+// GenerateQueryContext counts the tokens of the call, including those of failed attempts
+func (c *usageCounter) GenerateQueryContext(ctx context.Context, req llm.QueryRequest) (*llm.QueryResponse, error) {
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+	resp, err := llm.GenerateQueryContext(ctx, c.LLM, req)
+	failed := llm.FailedUsage(err)
+	if resp != nil {
+		c.usage = c.usage.Add(resp.Usage)
+		failed = resp.FailedUsage
+	}
+	for _, u := range failed {
+		c.usage = c.usage.Add(u.Usage)
+	}
+	return resp, err
+}
+
+// summarizeResult describes a result to the model: its columns, row count and first
+// rows, and statistics of the columns when not all rows are shown
+func summarizeResult(rs *db.ResultSet) string {
+	var b strings.Builder
+	columns := make([]string, len(rs.Columns))
+	for i, c := range rs.Columns {
+		columns[i] = fmt.Sprintf("%s (%s)", c.Name, c.Type)
+	}
+	count := fmt.Sprint(len(rs.Rows))
+	if rs.Truncated {
+		count = "more than " + count
+	}
+	fmt.Fprintf(&b, "Columns: %s\nRows: %s\n", strings.Join(columns, ", "), count)
+
+	rows := rs.Rows
+	if len(rows) > summaryRows {
+		rows = rows[:summaryRows]
+	}
+	for _, row := range rows {
+		line, err := json.Marshal(row)
+		if err != nil {
+			line = []byte(fmt.Sprint(row))
+		}
+		if b.Len()+len(line) > maxSummaryLen {
+			b.WriteString("...\n")
+			break
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	if len(rows) < len(rs.Rows) {
+		fmt.Fprintf(&b, "(%d more rows not shown)\nColumn statistics of all rows:\n%s\n", len(rs.Rows)-len(rows), columnStats(rs))
+	}
+	return strings.TrimSpace(b.String())
+}
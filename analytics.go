@@ -0,0 +1,39 @@
+package prompterdb
+
+import (
+	"errors"
+
+	"github.com/vijaylingoju/prompterdb/analytics"
+	"github.com/vijaylingoju/prompterdb/config"
+	"github.com/vijaylingoju/prompterdb/db"
+)
+
+// ConnectAnalytics opens and registers an in-memory analytics database with the given
+// CSV, JSON Lines, Parquet or Excel files loaded as tables. Prompts are routed to it
+// and answered with SQLite SQL like any other database.
+func ConnectAnalytics(name string, files ...string) error {
+	return Connect(config.DBConfig{
+		Name:  name,
+		Type:  config.Analytics,
+		Files: files,
+	})
+}
+
+// AttachFile loads a file into an analytics database and returns the tables it was
+// loaded as: one named after the file, or one per sheet of an Excel workbook
+func AttachFile(name, path string) ([]string, error) {
+	return analytics.AttachFile(name, path)
+}
+
+// AttachResult loads the rows of an earlier result into an analytics database as a
+// table, so later prompts can query them, e.g. joined with a file
+func AttachResult(name, table string, result *AskResult) error {
+	if result == nil {
+		return errors.New("result cannot be nil")
+	}
+	rs := result.Result
+	if rs == nil {
+		rs = db.NewResultSet(result.Rows)
+	}
+	return analytics.AttachResult(name, table, rs)
+}
@@ -0,0 +1,81 @@
+// Package analytics runs generated SQL over files and earlier query results, loaded
+// into an in-memory SQLite database.
+package analytics
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/vijaylingoju/prompterdb/config"
+	"github.com/vijaylingoju/prompterdb/db"
+)
+
+func init() {
+	sqlite, err := db.GetDriver(config.SQLite)
+	if err != nil {
+		panic(fmt.Sprintf("analytics: %v", err))
+	}
+	db.RegisterDriver(config.Analytics, &driver{Driver: sqlite})
+}
+
+// driver is the driver of analytics databases. Queries are written, validated and run
+// as for SQLite; connecting loads the files of the config as tables.
+type driver struct {
+	db.Driver
+}
+
+// Connect opens an in-memory database, unless cfg.URI names a SQLite file to use
+// instead, and loads cfg.Files into it
+func (d *driver) Connect(cfg config.DBConfig) error {
+	if cfg.URI == "" {
+		cfg.URI = ":memory:"
+	}
+	if err := d.Driver.Connect(cfg); err != nil {
+		return err
+	}
+	for _, path := range cfg.Files {
+		if _, err := AttachFile(cfg.Name, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AttachFile loads a file into the analytics database with the given name and returns
+// the tables it was loaded as. Tables of the same name are replaced.
+func AttachFile(name, path string) ([]string, error) {
+	tables, err := ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(tables))
+	for _, t := range tables {
+		if err := load(name, t.Name, t.Data); err != nil {
+			return nil, err
+		}
+		names = append(names, t.Name)
+	}
+	return names, nil
+}
+
+// AttachResult loads rows, e.g. the result of an earlier query, into the analytics
+// database with the given name as a table. A table of the same name is replaced.
+func AttachResult(name, table string, rs *db.ResultSet) error {
+	return load(name, TableName(table), rs)
+}
+
+// load loads rows as a table and caches the new schema of the database
+func load(name, table string, rs *db.ResultSet) error {
+	cfg, ok := config.RegisteredDBs[name]
+	if !ok || cfg.Type != config.Analytics {
+		return fmt.Errorf("%s is not a registered analytics database", name)
+	}
+	if err := db.LoadSQLiteTable(context.Background(), name, table, rs); err != nil {
+		return err
+	}
+	// GetSQLiteSchema caches the schema, which loading the table removed
+	if _, err := db.GetSQLiteSchema(name); err != nil {
+		return fmt.Errorf("failed to introspect %s: %w", name, err)
+	}
+	return nil
+}
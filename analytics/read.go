@@ -0,0 +1,370 @@
+package analytics
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/vijaylingoju/prompterdb/db"
+	"github.com/vijaylingoju/prompterdb/export"
+	"github.com/xuri/excelize/v2"
+)
+
+// maxLineSize is the longest JSON Lines record ReadFile accepts
+const maxLineSize = 16 << 20
+
+// Table is data read from a file, to be loaded as a table
+type Table struct {
+	Name string
+	Data *db.ResultSet
+}
+
+// ReadFile reads a CSV, JSON Lines, Parquet or Excel file. The table is named after
+// the file; Excel files give one table per sheet, named <file>_<sheet> when there are several.
+func ReadFile(path string) ([]Table, error) {
+	format, err := export.ParseFormat(filepath.Ext(path))
+	if err != nil {
+		return nil, fmt.Errorf("unsupported file %s: %w", path, err)
+	}
+	name := TableName(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+
+	if format == export.XLSX {
+		return readXLSX(path, name)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var data *db.ResultSet
+	switch format {
+	case export.CSV:
+		data, err = readCSV(f)
+	case export.NDJSON:
+		data, err = readNDJSON(f)
+	case export.Parquet:
+		data, err = readParquet(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return []Table{{Name: name, Data: data}}, nil
+}
+
+// TableName turns a file or sheet name into a table name of lowercase letters, digits and underscores
+func TableName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	table := strings.Trim(b.String(), "_")
+	if table == "" || (table[0] >= '0' && table[0] <= '9') {
+		table = "t_" + table
+	}
+	return table
+}
+
+func readCSV(r io.Reader) (*db.ResultSet, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("file is empty")
+	}
+	return textTable(records[0], records[1:]), nil
+}
+
+func readXLSX(path, name string) ([]Table, error) {
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	sheets := f.GetSheetList()
+	var tables []Table
+	for _, sheet := range sheets {
+		rows, err := f.GetRows(sheet)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read sheet %s of %s: %w", sheet, path, err)
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		table := name
+		if len(sheets) > 1 {
+			table = TableName(name + "_" + sheet)
+		}
+		tables = append(tables, Table{Name: table, Data: textTable(rows[0], rows[1:])})
+	}
+	if len(tables) == 0 {
+		return nil, fmt.Errorf("%s has no rows", path)
+	}
+	return tables, nil
+}
+
+// textTable types the columns of text records from their values: a column is numeric,
+// boolean or a time when every non-empty cell parses as one. Empty cells are NULL.
+func textTable(header []string, records [][]string) *db.ResultSet {
+	rs := &db.ResultSet{}
+	seen := map[string]int{}
+	for i, h := range header {
+		name := strings.TrimSpace(h)
+		if name == "" {
+			name = fmt.Sprintf("column_%d", i+1)
+		}
+		if seen[name]++; seen[name] > 1 {
+			name = fmt.Sprintf("%s_%d", name, seen[name])
+		}
+		rs.Columns = append(rs.Columns, db.Column{Name: name})
+	}
+
+	for i := range rs.Columns {
+		rs.Columns[i].DBType, rs.Columns[i].Type = textColumnType(records, i)
+	}
+
+	for _, record := range records {
+		row := make([]interface{}, len(rs.Columns))
+		for i, c := range rs.Columns {
+			if i < len(record) {
+				row[i] = parseText(c.DBType, record[i])
+			}
+		}
+		rs.Rows = append(rs.Rows, row)
+	}
+	return rs
+}
+
+// textColumnType returns the narrowest type that every non-empty cell of column i parses as
+func textColumnType(records [][]string, i int) (string, db.LogicalType) {
+	candidates := []string{"integer", "real", "boolean", "datetime"}
+	for _, record := range records {
+		if i >= len(record) || strings.TrimSpace(record[i]) == "" {
+			continue
+		}
+		var remaining []string
+		for _, t := range candidates {
+			if parseText(t, record[i]) != record[i] || t == "real" && isNumber(record[i]) {
+				remaining = append(remaining, t)
+			}
+		}
+		candidates = remaining
+		if len(candidates) == 0 {
+			break
+		}
+	}
+	if len(candidates) == 0 || len(records) == 0 {
+		return "text", db.TypeString
+	}
+	switch candidates[0] {
+	case "integer", "real":
+		return candidates[0], db.TypeNumber
+	case "boolean":
+		return "boolean", db.TypeBool
+	}
+	return "datetime", db.TypeTime
+}
+
+func isNumber(s string) bool {
+	_, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return err == nil
+}
+
+// timeLayouts are the layouts text cells are parsed as times with
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"}
+
+// parseText converts a text cell to a value of the given type. Cells that do not
+// parse are returned unchanged, and empty cells as nil.
+func parseText(dbType, s string) interface{} {
+	trimmed := strings.TrimSpace(s)
+	if trimmed == "" {
+		return nil
+	}
+	switch dbType {
+	case "integer":
+		if i, err := strconv.ParseInt(trimmed, 10, 64); err == nil {
+			return i
+		}
+	case "real":
+		if f, err := strconv.ParseFloat(trimmed, 64); err == nil {
+			return f
+		}
+	case "boolean":
+		switch strings.ToLower(trimmed) {
+		case "true":
+			return true
+		case "false":
+			return false
+		}
+	case "datetime":
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, trimmed); err == nil {
+				return t
+			}
+		}
+	}
+	return s
+}
+
+func readNDJSON(r io.Reader) (*db.ResultSet, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+
+	var rows []map[string]interface{}
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		decoder := json.NewDecoder(strings.NewReader(text))
+		decoder.UseNumber()
+		var row map[string]interface{}
+		if err := decoder.Decode(&row); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		for k, v := range row {
+			row[k] = jsonValue(v)
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("file is empty")
+	}
+	return db.NewResultSet(rows), nil
+}
+
+// jsonValue converts the numbers of a decoded JSON value to int64 or float64
+func jsonValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case json.Number:
+		if i, err := x.Int64(); err == nil {
+			return i
+		}
+		f, _ := x.Float64()
+		return f
+	case map[string]interface{}:
+		for k, child := range x {
+			x[k] = jsonValue(child)
+		}
+	case []interface{}:
+		for i, child := range x {
+			x[i] = jsonValue(child)
+		}
+	}
+	return v
+}
+
+func readParquet(f *os.File) (*db.ResultSet, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	pf, err := parquet.OpenFile(f, info.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	rs := &db.ResultSet{}
+	fields := pf.Schema().Fields()
+	for _, field := range fields {
+		dbType, logical := parquetColumnType(field)
+		rs.Columns = append(rs.Columns, db.Column{Name: field.Name(), DBType: dbType, Type: logical})
+	}
+
+	reader := parquet.NewReader(pf)
+	defer reader.Close()
+	for {
+		record := map[string]interface{}{}
+		if err := reader.Read(&record); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		row := make([]interface{}, len(fields))
+		for i, field := range fields {
+			row[i] = parquetValue(field, record[field.Name()])
+		}
+		rs.Rows = append(rs.Rows, row)
+	}
+	return rs, nil
+}
+
+// parquetColumnType returns the type name and logical type of a Parquet field
+func parquetColumnType(field parquet.Field) (string, db.LogicalType) {
+	if !field.Leaf() {
+		return "group", db.TypeJSON
+	}
+	if lt := field.Type().LogicalType(); lt != nil {
+		switch {
+		case lt.Timestamp != nil:
+			return "timestamp", db.TypeTime
+		case lt.Date != nil:
+			return "date", db.TypeTime
+		case lt.Json != nil:
+			return "json", db.TypeJSON
+		case lt.UTF8 != nil:
+			return "string", db.TypeString
+		}
+	}
+	switch field.Type().Kind() {
+	case parquet.Boolean:
+		return "boolean", db.TypeBool
+	case parquet.Int32, parquet.Int64:
+		return "int64", db.TypeNumber
+	case parquet.Float, parquet.Double:
+		return "double", db.TypeNumber
+	}
+	return "binary", db.TypeString
+}
+
+// parquetValue converts timestamps and dates, which are read as integers, to times
+func parquetValue(field parquet.Field, v interface{}) interface{} {
+	if v == nil || !field.Leaf() {
+		return v
+	}
+	lt := field.Type().LogicalType()
+	if lt == nil {
+		return v
+	}
+	switch {
+	case lt.Timestamp != nil:
+		n, ok := v.(int64)
+		if !ok {
+			return v
+		}
+		switch {
+		case lt.Timestamp.Unit.Millis != nil:
+			return time.UnixMilli(n).UTC()
+		case lt.Timestamp.Unit.Nanos != nil:
+			return time.Unix(0, n).UTC()
+		}
+		return time.UnixMicro(n).UTC()
+	case lt.Date != nil:
+		if n, ok := v.(int32); ok {
+			return time.Unix(int64(n)*86400, 0).UTC()
+		}
+	}
+	return v
+}
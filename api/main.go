@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/joho/godotenv"
 	"github.com/vijaylingoju/prompterdb"
@@ -60,6 +62,39 @@ func main() {
 		log.Fatalf("Mongo connect failed: %v", err)
 	}
 
+	// MySQL is optional
+	if mysql_uri := os.Getenv("MYSQL_URI"); mysql_uri != "" {
+		mysql_name := os.Getenv("MYSQL_NAME")
+		if mysql_name == "" {
+			log.Fatal("MYSQL_NAME is required when MYSQL_URI is set")
+		}
+		if err := prompterdb.ConnectMySQL(mysql_name, mysql_uri); err != nil {
+			log.Fatalf("MySQL connect failed: %v", err)
+		}
+	}
+
+	// SQLite is optional
+	if sqlite_path := os.Getenv("SQLITE_PATH"); sqlite_path != "" {
+		sqlite_name := os.Getenv("SQLITE_NAME")
+		if sqlite_name == "" {
+			log.Fatal("SQLITE_NAME is required when SQLITE_PATH is set")
+		}
+		if err := prompterdb.ConnectSQLite(sqlite_name, sqlite_path); err != nil {
+			log.Fatalf("SQLite connect failed: %v", err)
+		}
+	}
+
+	// Analytics over files is optional
+	if analytics_files := os.Getenv("ANALYTICS_FILES"); analytics_files != "" {
+		analytics_name := os.Getenv("ANALYTICS_NAME")
+		if analytics_name == "" {
+			log.Fatal("ANALYTICS_NAME is required when ANALYTICS_FILES is set")
+		}
+		if err := prompterdb.ConnectAnalytics(analytics_name, strings.Split(analytics_files, ",")...); err != nil {
+			log.Fatalf("Analytics connect failed: %v", err)
+		}
+	}
+
 	// STEP 2: Introspect all schemas (required for LLM)
 	if err := prompterdb.IntrospectAllSchemas(); err != nil {
 		log.Fatalf("Schema introspection failed: %v", err)
@@ -71,43 +106,56 @@ func main() {
 		log.Fatalf("Failed to load templates: %v", err)
 	}
 
-	// STEP 4: Create LLM client (mock or actual)
-	var llmClient llm.LLM
-	var llmErr error
+	// STEP 4: Create LLM client, falling back across every configured provider
+	var providers []llm.Provider
 
-	// Try to use OpenAI if API key is available
 	if apiKey := os.Getenv("OPENAI_API_KEY"); apiKey != "" {
-		llmClient, llmErr = llm.NewOpenAI(apiKey, os.Getenv("OPENAI_MODEL"))
-	} else if apiKey := os.Getenv("GEMINI_API_KEY"); apiKey != "" {
-		llmClient, llmErr = llm.NewGemini(apiKey, os.Getenv("GEMINI_MODEL"))
-	} else {
+		client, err := llm.NewOpenAI(apiKey, os.Getenv("OPENAI_MODEL"))
+		if err != nil {
+			log.Fatalf("OpenAI initialization failed: %v", err)
+		}
+		providers = append(providers, llm.Provider{LLM: client, Weight: 1})
+	}
+	if apiKey := os.Getenv("GEMINI_API_KEY"); apiKey != "" {
+		client, err := llm.NewGemini(apiKey, os.Getenv("GEMINI_MODEL"))
+		if err != nil {
+			log.Fatalf("Gemini initialization failed: %v", err)
+		}
+		providers = append(providers, llm.Provider{LLM: client, Weight: 1})
+	}
+	if len(providers) == 0 {
 		log.Fatal("No LLM API key found. Please set either OPENAI_API_KEY or GEMINI_API_KEY")
 	}
 
-	if llmErr != nil {
-		log.Fatalf("LLM initialization failed: %v", llmErr)
+	llmClient, err := llm.NewFallback(llm.DefaultFallbackOptions(), providers...)
+	if err != nil {
+		log.Fatalf("LLM initialization failed: %v", err)
 	}
 
 	// Set the template manager for the LLM client
 	llmClient.SetTemplateManager(tm)
 
 	// STEP 4: Run the query using your library
-	results, err := prompterdb.Ask(prompt, llmClient)
+	result, err := prompterdb.AskWithOptions(context.Background(), prompt, llmClient, prompterdb.AskOptions{})
 	if err != nil {
 		log.Fatalf("Ask failed: %v", err)
 	}
 
 	// STEP 5: Print the results
 	fmt.Println("\n✅ Query Results:")
-	for i, row := range results {
+	fmt.Println(strings.Join(result.Result.ColumnNames(), " | "))
+	for i, row := range result.Result.Rows {
 		fmt.Printf("%d. %v\n", i+1, row)
 	}
+	if result.Truncated {
+		fmt.Println("(more rows available)")
+	}
 
 	// STEP 6: Visualize the results
 	if tm != nil {
 		fmt.Println("\n📊 Visualization:")
 		// Use the default template for visualization
-		widgets, err := prompterdb.Visualize(results, "default", tm, llmClient)
+		widgets, err := prompterdb.VisualizeResultSet(result.Result, "default", tm, llmClient)
 		if err != nil {
 			log.Printf("Warning: Visualization failed: %v", err)
 		} else {
@@ -2,22 +2,130 @@ package prompterdb
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"io/fs"
 	"log"
 	"strings"
+	"sync"
 
+	"github.com/vijaylingoju/prompterdb/accounting"
+	"github.com/vijaylingoju/prompterdb/cache"
 	"github.com/vijaylingoju/prompterdb/config"
 	"github.com/vijaylingoju/prompterdb/db"
 	"github.com/vijaylingoju/prompterdb/engine"
+	"github.com/vijaylingoju/prompterdb/examples"
 	"github.com/vijaylingoju/prompterdb/llm"
 	"github.com/vijaylingoju/prompterdb/templates"
-	"go.mongodb.org/mongo-driver/bson"
 )
 
-// Ask processes a natural language query and returns the results along with visualization suggestions
+// AskOptions configures a single AskWithOptions call
+type AskOptions struct {
+	// Tenant identifies the team or session the LLM usage is charged to
+	Tenant string
+	// Ledger records token usage and enforces the tenant's budget when set
+	Ledger *accounting.Ledger
+	// QueryCache reuses previously validated queries for identical questions when set
+	QueryCache *cache.QueryCache
+	// SemanticCache reuses previously validated queries for paraphrased questions when set
+	SemanticCache *cache.SemanticCache
+	// Examples supplies few-shot examples for the system prompt when set
+	Examples *examples.Store
+	// ExampleCount is the number of examples selected per request (default examples.DefaultK)
+	ExampleCount int
+	// MongoPolicy restricts generated MongoDB queries (default llm.DefaultMongoPolicy)
+	MongoPolicy *llm.MongoPolicy
+	// PageSize is the maximum number of rows returned per page (default db.RowLimit)
+	PageSize int
+	// PageKey switches from offset to keyset pagination: results are ordered by this
+	// unique column, in the direction the query orders it, and the next page starts
+	// after the last key returned. A page whose key values repeat fails.
+	PageKey string
+	// QueryGuard sets the server-side limits generated SQL runs under (default db.DefaultQueryGuard)
+	QueryGuard *db.QueryGuard
+	// JoinKeys declares how the results of different databases relate, for AskFederated
+	JoinKeys []JoinKey
+	// MaxStepRows is the number of rows AskFederated reads from each database (default 10 × db.RowLimit)
+	MaxStepRows int
+	// MaxAgentSteps is the number of queries AskAgent may run (default DefaultAgentSteps)
+	MaxAgentSteps int
+	// MaxAgentTokens is the LLM token budget of an AskAgent call (default DefaultAgentTokens)
+	MaxAgentTokens int
+	// Summarize adds a natural language answer to the result, see Summarize
+	Summarize bool
+	// AllowClarification lets the model answer an ambiguous prompt with a question for
+	// the user, returned as AskResult.Clarification, instead of guessing a query
+	AllowClarification bool
+	// Clarifications are the user's answers to earlier clarifications of the prompt
+	Clarifications []llm.ClarificationAnswer
+}
+
+// AskResult is the outcome of an AskWithOptions call
+type AskResult struct {
+	Prompt string
+	Rows   []map[string]interface{}
+	// Result holds the rows with ordered, typed columns
+	Result   *db.ResultSet
+	Query    string
+	Args     []llm.QueryArg // arguments bound to the placeholders of a SQL query
+	Database string
+	Provider string    // LLM provider that generated the query
+	Model    string    // model that generated the query
+	Usage    llm.Usage // tokens consumed by all LLM calls
+	Cost     float64   // cost of Usage according to the ledger's price table
+	Cached   bool      // query was served from a cache instead of the LLM
+	// ReusedFrom is the earlier prompt whose query was reused by the semantic cache
+	ReusedFrom string
+	// Similarity is the similarity between the prompt and ReusedFrom
+	Similarity float64
+	// Truncated is set when the query returned more rows than the page size
+	Truncated bool
+	// NextPageToken fetches the next page with FetchPage; empty on the last page
+	NextPageToken string
+	// Summary answers the prompt in words, when AskOptions.Summarize is set
+	Summary *Summary
+	// Clarification is set, and no query run, when the model asks what the prompt means.
+	// Ask again with its answer in AskOptions.Clarifications.
+	Clarification *llm.Clarification
+}
+
+// Example returns the prompt and generated query as a few-shot example,
+// for recording runs the user confirmed as correct. A SQL query with arguments
+// is stored in the JSON form read by llm.ParseSQLQuery.
+func (r *AskResult) Example() llm.Example {
+	query := llm.SQLQuery{Query: r.Query, Args: r.Args}.String()
+	return llm.Example{Question: r.Prompt, Query: query, Database: r.Database}
+}
+
+// Ask processes a natural language query and returns the results
 func Ask(userPrompt string, llmClient llm.LLM) ([]map[string]interface{}, error) {
+	result, err := AskWithOptions(context.Background(), userPrompt, llmClient, AskOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return result.Rows, nil
+}
+
+// AskWithOptions processes a natural language query like Ask and reports
+// the generated query, the provider that answered and the LLM usage
+func AskWithOptions(ctx context.Context, userPrompt string, llmClient llm.LLM, opts AskOptions) (*AskResult, error) {
+	result, err := ask(ctx, userPrompt, llmClient, opts)
+	if err != nil {
+		return nil, err
+	}
+	if result.Result == nil {
+		result.Result = db.NewResultSet(result.Rows)
+	}
+	if opts.Summarize && result.Clarification == nil {
+		// The rows are still returned when they cannot be summarized
+		if _, err := Summarize(ctx, result, llmClient, opts); err != nil {
+			log.Printf("Warning: could not summarize result: %v", err)
+		}
+	}
+	return result, nil
+}
+
+func ask(ctx context.Context, userPrompt string, llmClient llm.LLM, opts AskOptions) (*AskResult, error) {
 	if userPrompt == "" {
 		return nil, errors.New("prompt is empty")
 	}
@@ -27,148 +135,341 @@ func Ask(userPrompt string, llmClient llm.LLM) ([]map[string]interface{}, error)
 		return nil, errors.New("schema is empty – call IntrospectAllSchemas() first")
 	}
 
-	// Initialize template manager
-	tm := templates.NewTemplateManager()
-	// Load templates from the default directory
-	if err := tm.LoadTemplatesFromDir("templates"); err != nil {
-		log.Printf("Warning: could not load templates: %v", err)
+	tm, err := useDefaultTemplates(llmClient)
+	if err != nil {
+		return nil, err
 	}
 
-	// Set the template manager for the LLM client
-	llmClient.SetTemplateManager(tm)
-
 	// STEP 1: Route to the most appropriate DB
-	targetDB, err := engine.RoutePrompt(context.Background(), userPrompt)
+	targetDB, err := engine.RoutePrompt(ctx, clarifiedPrompt(userPrompt, opts.Clarifications))
 	if err != nil {
 		return nil, fmt.Errorf("failed to determine target database: %w", err)
 	}
 
+	return askDatabase(ctx, userPrompt, targetDB, schema, tm, llmClient, opts)
+}
+
+// askDatabase generates a query for the prompt on targetDB, given the schema shown
+// to the LLM, and runs it
+func askDatabase(ctx context.Context, userPrompt string, targetDB config.DBConfig, schema string, tm *templates.TemplateManager, llmClient llm.LLM, opts AskOptions) (*AskResult, error) {
 	if targetDB.Name == "" || targetDB.Type == "" {
 		return nil, errors.New("invalid database configuration")
 	}
 
+	// Step 2: Find the driver of the database, which shapes the prompt and runs the query
+	drv, err := db.GetDriver(targetDB.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &AskResult{Prompt: userPrompt, Database: targetDB.Name}
+
 	// Prepare the query request
 	req := llm.QueryRequest{
 		Prompt:     userPrompt,
 		Schema:     schema,
-		DBType:     strings.ToLower(string(targetDB.Type)),
+		DBType:     strings.ToLower(drv.TemplateKey()),
+		QueryType:  drv.QueryType(),
 		CustomVars: make(map[string]interface{}),
 	}
-
-	switch targetDB.Type {
-	case config.Postgres:
-		req.QueryType = llm.QueryTypeSQL
-		// Step 2: Ask LLM to generate SQL
-		resp, err := llmClient.GenerateQuery(req)
+	if opts.AllowClarification {
+		req.CustomVars["AllowClarification"] = true
+	}
+	if len(opts.Clarifications) > 0 {
+		clarified, err := renderTemplate(tm, templates.Clarification, req.DBType, map[string]interface{}{
+			"UserRequest":    userPrompt,
+			"DBType":         req.DBType,
+			"Clarifications": opts.Clarifications,
+		})
 		if err != nil {
-			return nil, fmt.Errorf("llm generation failed: %w", err)
+			return nil, fmt.Errorf("failed to render clarifications: %w", err)
+		}
+		req.CustomVars["Clarifications"] = opts.Clarifications
+		req.CustomVars["Clarified"] = clarified
+	}
+	if opts.Examples != nil {
+		req.Examples = opts.Examples.TopK(userPrompt, opts.ExampleCount, targetDB.Name, string(targetDB.Type))
+	}
+	if preparer, ok := drv.(db.RequestPreparer); ok {
+		if err := preparer.PrepareRequest(targetDB, &req); err != nil {
+			return nil, err
 		}
+	}
 
-		query := cleanLLMQuery(resp.Query)
+	// Step 3: Ask LLM to generate the query, unless a validated query is cached
+	cacheKey := queryCacheKey(clarifiedPrompt(userPrompt, opts.Clarifications), targetDB, req)
+	rawQuery, err := resolveQuery(ctx, llmClient, req, cacheKey, opts, result, responseCleaner(req.QueryType))
+	if err != nil {
+		return nil, fmt.Errorf("llm generation failed: %w", err)
+	}
 
-		// Step 3: Validate SQL
-		if err := llm.ValidateSQL(query); err != nil {
-			return nil, fmt.Errorf("query validation failed: %w", err)
+	// The model may ask which reading of an ambiguous prompt was meant instead
+	if clarification, ok := llm.ParseClarification(rawQuery); ok {
+		if !opts.AllowClarification {
+			return nil, fmt.Errorf("llm asked for clarification instead of a query: %s", clarification.Question)
 		}
+		result.Clarification = clarification
+		return result, nil
+	}
 
-		// Step 4: Execute SQL
-		isSelect := strings.HasPrefix(strings.ToLower(strings.TrimSpace(query)), "select")
-		if isSelect {
-			return db.QueryPostgres(targetDB.Name, query)
-		}
-		// For non-SELECT queries, execute and return the result
-		rowsAffected, err := db.Execute(targetDB.Name, query)
-		if err != nil {
-			return nil, fmt.Errorf("query execution failed: %w", err)
-		}
-		results := []map[string]interface{}{
-			{"rows_affected": rowsAffected},
-		}
-		if err != nil {
-			return nil, fmt.Errorf("query execution failed: %w", err)
+	// Step 4: Validate the query and its bound arguments
+	collection, _ := req.CustomVars["Collection"].(string)
+	execOpts := execOptions(opts, collection)
+	stmt, err := drv.Validate(targetDB, rawQuery, execOpts)
+	if err != nil {
+		return nil, fmt.Errorf("query validation failed: %w", err)
+	}
+	result.Query = stmt.Query
+	result.Args = stmt.Args
+
+	// Step 5: Execute the query, one page at a time when it returns rows. Queries are
+	// cached once they ran, a query that fails at runtime is not reused.
+	if stmt.Pageable {
+		page := firstPage(opts, targetDB.Name, rawQuery, stmt.Collection)
+		if err := runPage(ctx, drv, targetDB, stmt, page, execOpts, result); err != nil {
+			return nil, err
 		}
+		storeQuery(opts, cacheKey, rawQuery, result)
+		return result, nil
+	}
+	rs, err := drv.Execute(ctx, targetDB, stmt, execOpts)
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %w", err)
+	}
+	result.Result = rs
+	result.Rows = rs.Maps()
+	storeQuery(opts, cacheKey, rawQuery, result)
 
-		// If there are results, try to generate visualizations
-		if len(results) > 0 {
-			log.Println("Generating visualization suggestions...")
-			// Initialize template manager
-			tm := templates.NewTemplateManager()
-			if err := tm.LoadTemplatesFromDir("templates"); err != nil {
-				log.Printf("Warning: could not load templates for visualization: %v", err)
-			}
+	// For SQL commands, try to generate visualizations
+	if req.QueryType == llm.QueryTypeSQL && len(result.Rows) > 0 {
+		suggestVisualizations(ctx, tm, llmClient, opts, result)
+	}
+	return result, nil
+}
+
+var (
+	defaultTemplatesMu     sync.Mutex
+	defaultTemplates       *templates.TemplateManager
+	defaultTemplatesLoaded bool
+)
 
-			// Generate visualization suggestions
-			widgets, vizErr := Visualize(results, "default", tm, llmClient)
-			if vizErr != nil {
-				log.Printf("Warning: could not generate visualizations: %v", vizErr)
-			} else if len(widgets) > 0 {
-				log.Println("\n=== Visualization Suggestions ===")
-				PrintWidgetConfig(widgets)
+// useDefaultTemplates loads the templates of the default directory into llmClient.
+// The directory is loaded, and its templates validated, until a load succeeds. A
+// missing directory is logged; an invalid template fails the call and is retried by the next.
+func useDefaultTemplates(llmClient llm.LLM) (*templates.TemplateManager, error) {
+	defaultTemplatesMu.Lock()
+	defer defaultTemplatesMu.Unlock()
+	if !defaultTemplatesLoaded {
+		tm := templates.NewTemplateManager()
+		if err := tm.LoadTemplatesFromDir("templates"); err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				return nil, fmt.Errorf("failed to load templates: %w", err)
 			}
+			log.Printf("Warning: could not load templates: %v", err)
 		}
+		defaultTemplates, defaultTemplatesLoaded = tm, true
+	}
+	llmClient.SetTemplateManager(defaultTemplates)
+	return defaultTemplates, nil
+}
+
+// suggestVisualizations logs widget suggestions for the rows of a result.
+// The suggestion counts against the tenant's budget and its usage is added to result.
+func suggestVisualizations(ctx context.Context, tm *templates.TemplateManager, llmClient llm.LLM, opts AskOptions, result *AskResult) {
+	log.Println("Generating visualization suggestions...")
+	generate := func(req llm.QueryRequest) (*llm.QueryResponse, error) {
+		return callLLM(ctx, llmClient, req, opts, result)
+	}
+	widgets, vizErr := visualizeResultSet(result.Result, "default", tm, llmClient, generate)
+	if vizErr != nil {
+		log.Printf("Warning: could not generate visualizations: %v", vizErr)
+	} else if len(widgets) > 0 {
+		log.Println("\n=== Visualization Suggestions ===")
+		PrintWidgetConfig(widgets)
+	}
+}
+
+// templateKey returns key when there is a default template of the type for it, else "default"
+func templateKey(tm *templates.TemplateManager, templateType templates.TemplateType, key string) string {
+	if tm.HasTemplate(templateType, key, "default") {
+		return key
+	}
+	return "default"
+}
+
+// renderTemplate renders the default template of a type for dbType, or the type's
+// default/default.tmpl when dbType has none
+func renderTemplate(tm *templates.TemplateManager, templateType templates.TemplateType, dbType string, data map[string]interface{}) (string, error) {
+	text, err := tm.ExecuteTemplate(templateType, templateKey(tm, templateType, dbType), "default", data)
+	return strings.TrimSpace(text), err
+}
+
+// execOptions returns the settings generated queries are validated and run with.
+// collection is used by MongoDB queries that name none.
+func execOptions(opts AskOptions, collection string) db.ExecOptions {
+	return db.ExecOptions{
+		Guard:       queryGuard(opts),
+		MongoPolicy: opts.MongoPolicy,
+		Collection:  collection,
+	}
+}
 
-		return results, nil
+// queryGuard returns the server-side limits for generated SQL configured by opts
+func queryGuard(opts AskOptions) db.QueryGuard {
+	if opts.QueryGuard != nil {
+		return *opts.QueryGuard
+	}
+	return db.DefaultQueryGuard()
+}
 
-	case config.Mongo:
-		req.QueryType = llm.QueryTypeMongo
+// clarifiedPrompt returns the prompt followed by the user's clarifications of it
+func clarifiedPrompt(userPrompt string, clarifications []llm.ClarificationAnswer) string {
+	if len(clarifications) == 0 {
+		return userPrompt
+	}
+	var b strings.Builder
+	b.WriteString(userPrompt)
+	for _, c := range clarifications {
+		fmt.Fprintf(&b, "\n%s %s", c.Question, c.Answer)
+	}
+	return b.String()
+}
+
+// queryCacheKey builds the query cache key for a request against the target database
+func queryCacheKey(userPrompt string, targetDB config.DBConfig, req llm.QueryRequest) cache.QueryKey {
+	templateName := req.Template
+	if templateName == "" {
+		templateName = "default"
+	}
+	key := cache.QueryKey{
+		Prompt:   userPrompt,
+		Database: targetDB.Name,
+		Template: templateName,
+		Schema:   GetSchema(targetDB.Name),
+	}
+	if collection, ok := req.CustomVars["Collection"].(string); ok {
+		key.Template += "/" + collection
+	}
+	return key
+}
 
-		// Find the most relevant collection if not specified
-		collection := FindMostRelevantMongoCollection(userPrompt, targetDB.Name)
-		if collection == "" {
-			return nil, errors.New("could not infer MongoDB collection name from prompt")
+// resolveQuery returns the cached query for key when available,
+// otherwise it generates a query with the LLM and cleans it with clean
+func resolveQuery(ctx context.Context, llmClient llm.LLM, req llm.QueryRequest, key cache.QueryKey, opts AskOptions, result *AskResult, clean func(*llm.QueryResponse) string) (string, error) {
+	if opts.QueryCache != nil {
+		if entry, ok := opts.QueryCache.Get(key); ok {
+			log.Printf("Using cached query for prompt: %s", key.Prompt)
+			result.Cached = true
+			return entry.Query, nil
 		}
-		req.CustomVars["Collection"] = collection
+	}
 
-		// Step 2: Generate MongoDB query using the template system
-		resp, err := llmClient.GenerateQuery(req)
+	if opts.SemanticCache != nil {
+		match, ok, err := opts.SemanticCache.Lookup(key)
 		if err != nil {
-			return nil, fmt.Errorf("mongo query generation failed: %w", err)
+			log.Printf("Warning: semantic cache lookup failed: %v", err)
+		} else if ok {
+			log.Printf("Reusing query from %q (similarity %.3f)", match.Prompt, match.Similarity)
+			result.Cached = true
+			result.ReusedFrom = match.Prompt
+			result.Similarity = match.Similarity
+			return match.Query, nil
 		}
+	}
+
+	resp, err := generateQuery(ctx, llmClient, req, opts, result)
+	if err != nil {
+		return "", err
+	}
+	return clean(resp), nil
+}
 
-		// Clean and validate the MongoDB query
-		cleanedQuery := cleanMongoText(resp.Query)
-		if err := llm.ValidateMongo(cleanedQuery); err != nil {
-			return nil, fmt.Errorf("mongo query validation failed: %w", err)
+// storeQuery saves a freshly generated query that validated and ran in the configured caches
+func storeQuery(opts AskOptions, key cache.QueryKey, query string, result *AskResult) {
+	if result.Cached {
+		return
+	}
+	if opts.QueryCache != nil {
+		if err := opts.QueryCache.Put(key, query); err != nil {
+			log.Printf("Warning: could not cache query: %v", err)
 		}
+	}
+	if opts.SemanticCache != nil {
+		if err := opts.SemanticCache.Add(key, query); err != nil {
+			log.Printf("Warning: could not index query in semantic cache: %v", err)
+		}
+	}
+}
 
-		log.Println("Raw Mongo LLM response:", cleanedQuery)
+// generateQuery asks the LLM for a query, enforcing the tenant's budget and recording the usage on result
+func generateQuery(ctx context.Context, llmClient llm.LLM, req llm.QueryRequest, opts AskOptions, result *AskResult) (*llm.QueryResponse, error) {
+	resp, err := callLLM(ctx, llmClient, req, opts, result)
+	if err != nil {
+		return nil, err
+	}
+	result.Provider = resp.Provider
+	result.Model = resp.Model
+	return resp, nil
+}
 
-		var mongoQuery struct {
-			Operation  string                 `json:"operation"`
-			Collection string                 `json:"collection"`
-			Filter     map[string]interface{} `json:"filter,omitempty"`
-			Document   map[string]interface{} `json:"document,omitempty"`
-			Update     map[string]interface{} `json:"update,omitempty"`
-			Pipeline   []bson.M               `json:"pipeline,omitempty"`
+// callLLM sends a request to the LLM, enforcing the tenant's budget and adding the usage and cost
+// to result, including those of failed attempts
+func callLLM(ctx context.Context, llmClient llm.LLM, req llm.QueryRequest, opts AskOptions, result *AskResult) (*llm.QueryResponse, error) {
+	if opts.Ledger != nil {
+		if err := opts.Ledger.Check(opts.Tenant); err != nil {
+			return nil, err
 		}
+	}
 
-		if err := json.Unmarshal([]byte(cleanedQuery), &mongoQuery); err != nil {
-			return nil, fmt.Errorf("error parsing LLM Mongo response: %w\nRaw response: %s", err, cleanedQuery)
-		}
+	resp, err := llm.GenerateQueryContext(ctx, llmClient, req)
+	if err != nil {
+		chargeUsage(opts, result, llm.FailedUsage(err)...)
+		return nil, err
+	}
 
-		// Use the collection from the template if not specified in the response
-		if mongoQuery.Collection == "" {
-			mongoQuery.Collection = collection
+	chargeUsage(opts, result, resp.FailedUsage...)
+	chargeUsage(opts, result, llm.ModelUsage{Model: resp.Model, Usage: resp.Usage})
+	return resp, nil
+}
+
+// chargeUsage adds the usage of LLM calls to result and records it in the ledger
+func chargeUsage(opts AskOptions, result *AskResult, usages ...llm.ModelUsage) {
+	for _, u := range usages {
+		result.Usage = result.Usage.Add(u.Usage)
+		if opts.Ledger != nil {
+			result.Cost += opts.Ledger.Record(opts.Tenant, u.Model, u.Usage)
 		}
+	}
+}
 
-		switch mongoQuery.Operation {
-		case "find":
-			return db.QueryMongo(targetDB.Name, targetDB.DBName, mongoQuery.Collection, mongoQuery.Filter)
-		case "insert":
-			return db.InsertMongo(targetDB.Name, targetDB.DBName, mongoQuery.Collection, mongoQuery.Document)
-		case "update":
-			return db.UpdateMongo(targetDB.Name, targetDB.DBName, mongoQuery.Collection, mongoQuery.Filter, mongoQuery.Update)
-		case "delete":
-			return db.DeleteMongo(targetDB.Name, targetDB.DBName, mongoQuery.Collection, mongoQuery.Filter)
-		case "aggregate":
-			return db.AggregateMongo(targetDB.Name, targetDB.DBName, mongoQuery.Collection, mongoQuery.Pipeline)
-		default:
-			return nil, fmt.Errorf("unsupported Mongo operation: %s", mongoQuery.Operation)
+// cleanSQLResponse returns the generated SQL and its arguments in the
+// form accepted by llm.ParseSQLQuery, with markdown fences removed
+func cleanSQLResponse(resp *llm.QueryResponse) string {
+	q := llm.SQLQuery{Query: resp.Query, Args: resp.Args}
+	if len(q.Args) == 0 {
+		if parsed, err := llm.ParseSQLQuery(resp.Query); err == nil {
+			q = *parsed
 		}
+	}
+	q.Query = cleanLLMQuery(q.Query)
+	return q.String()
+}
 
-	default:
-		return nil, fmt.Errorf("unsupported DB type: %s", targetDB.Type)
+// responseCleaner returns the function that extracts the query from an LLM response
+// of the given query type
+func responseCleaner(queryType llm.QueryType) func(*llm.QueryResponse) string {
+	switch queryType {
+	case llm.QueryTypeSQL:
+		return cleanSQLResponse
+	case llm.QueryTypeMongo:
+		return cleanMongoResponse
 	}
+	return func(resp *llm.QueryResponse) string { return cleanLLMQuery(resp.Query) }
+}
+
+// cleanMongoResponse returns the generated MongoDB query JSON
+func cleanMongoResponse(resp *llm.QueryResponse) string {
+	return cleanMongoText(resp.Query)
 }
 
 func cleanLLMQuery(raw string) string {
@@ -207,38 +508,8 @@ func cleanMongoText(response string) string {
 	return strings.Join(clean, "\n")
 }
 
+// FindMostRelevantMongoCollection returns the collection of a Mongo database whose schema
+// shares the most words with the prompt, or "" if none does
 func FindMostRelevantMongoCollection(prompt string, dbName string) string {
-	prompt = strings.ToLower(prompt)
-
-	cfg, ok := config.RegisteredDBs[dbName]
-	if !ok || cfg.Type != config.Mongo {
-		return ""
-	}
-
-	schema, err := db.GetMongoSchema(dbName)
-	if err != nil || schema == "" {
-		return ""
-	}
-
-	bestMatch := ""
-	highestScore := 0
-
-	lines := strings.Split(schema, "\n")
-	for _, line := range lines {
-		if line == "" {
-			continue
-		}
-		lineLower := strings.ToLower(line)
-		score := 0
-		for _, word := range strings.Fields(prompt) {
-			if strings.Contains(lineLower, word) {
-				score++
-			}
-		}
-		if score > highestScore {
-			highestScore = score
-			bestMatch = strings.SplitN(line, "(", 2)[0]
-		}
-	}
-	return bestMatch
+	return db.MostRelevantMongoCollection(prompt, dbName)
 }
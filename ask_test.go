@@ -0,0 +1,57 @@
+package prompterdb
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/vijaylingoju/prompterdb/llm"
+)
+
+func TestAskResultExampleRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		result AskResult
+	}{
+		{
+			name: "arguments",
+			result: AskResult{
+				Prompt:   "orders from Paris over 100",
+				Query:    "SELECT * FROM orders WHERE city = $1 AND total > $2",
+				Args:     []llm.QueryArg{{Value: "Paris", Type: "text", Column: "orders.city"}, {Value: float64(100), Type: "integer"}},
+				Database: "shop",
+			},
+		},
+		{
+			name:   "no arguments",
+			result: AskResult{Prompt: "all orders", Query: "SELECT * FROM orders", Database: "shop"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			example := tt.result.Example()
+			if example.Question != tt.result.Prompt || example.Database != tt.result.Database {
+				t.Errorf("Example() = %+v, want the prompt and database of the result", example)
+			}
+
+			parsed, err := llm.ParseSQLQuery(example.Query)
+			if err != nil {
+				t.Fatalf("ParseSQLQuery(%q) error = %v", example.Query, err)
+			}
+			if parsed.Query != tt.result.Query {
+				t.Errorf("query = %q, want %q", parsed.Query, tt.result.Query)
+			}
+			got, err := parsed.Values()
+			if err != nil {
+				t.Fatalf("Values() error = %v", err)
+			}
+			want, err := llm.SQLQuery{Query: tt.result.Query, Args: tt.result.Args}.Values()
+			if err != nil {
+				t.Fatalf("Values() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("values = %#v, want %#v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package cache
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tokenPattern splits a prompt into quoted values, numbers and words
+var tokenPattern = regexp.MustCompile(`'[^']*'|"[^"]*"|-?\d+(?:\.\d+)?|\p{L}+`)
+
+// quotedPattern and jsonValuePattern match the string values of a cached query:
+// SQL string literals and, for JSON queries, string values that are not object keys
+var (
+	quotedPattern    = regexp.MustCompile(`'((?:[^']|'')*)'`)
+	jsonValuePattern = regexp.MustCompile(`"((?:[^"\\]|\\.)*)"\s*([:]?)`)
+)
+
+var numberWords = map[string]int64{
+	"zero": 0, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6, "seven": 7,
+	"eight": 8, "nine": 9, "ten": 10, "eleven": 11, "twelve": 12, "thirteen": 13,
+	"fourteen": 14, "fifteen": 15, "sixteen": 16, "seventeen": 17, "eighteen": 18,
+	"nineteen": 19, "twenty": 20, "thirty": 30, "forty": 40, "fifty": 50, "sixty": 60,
+	"seventy": 70, "eighty": 80, "ninety": 90,
+}
+
+var numberScales = map[string]int64{"hundred": 100, "thousand": 1000, "million": 1000000}
+
+// promptLiterals returns the values of a prompt in order: quoted strings, numbers
+// and named entities. Number words are converted to digits, so "top 10" and "ten
+// biggest" share the literal "10". Capitalized words that do not start a sentence,
+// such as "Paris" in "orders from Paris", are treated as named entities.
+func promptLiterals(prompt string) []string {
+	var literals []string
+	var n spelledNumber
+	flush := func() {
+		if n.active {
+			literals = append(literals, strconv.FormatInt(n.total+n.current, 10))
+			n = spelledNumber{}
+		}
+	}
+
+	for _, loc := range tokenPattern.FindAllStringIndex(prompt, -1) {
+		token := prompt[loc[0]:loc[1]]
+		switch {
+		case token[0] == '\'' || token[0] == '"':
+			flush()
+			literals = append(literals, token[1:len(token)-1])
+		case token[0] == '-' || unicode.IsDigit(rune(token[0])):
+			flush()
+			if v, err := strconv.ParseInt(token, 10, 64); err == nil {
+				// digits can still be scaled, as in "3 thousand"
+				n = spelledNumber{current: v, active: true, digits: true}
+				continue
+			}
+			literals = append(literals, token)
+		case n.scaled && strings.EqualFold(token, "and"):
+			// "two hundred and fifty"
+		default:
+			word := strings.ToLower(token)
+			if _, scale := numberScales[word]; n.digits && !scale {
+				flush()
+			}
+			if n.add(word) {
+				continue
+			}
+			flush()
+			if isNamedEntity(prompt, loc[0], token) {
+				literals = append(literals, token)
+			}
+		}
+	}
+	flush()
+	return literals
+}
+
+// spelledNumber accumulates a number written in words, such as "two hundred and fifty"
+type spelledNumber struct {
+	total, current int64
+	active         bool // a number is being read
+	digits         bool // the number started with digits, so only scale words continue it
+	scaled         bool // the last word was a scale such as "hundred"
+}
+
+// add adds a number word such as "five" or "hundred" to the number.
+// It reports false, leaving the number unchanged, for any other word.
+func (n *spelledNumber) add(word string) bool {
+	if v, ok := numberWords[word]; ok {
+		n.current += v
+		n.active, n.scaled = true, false
+		return true
+	}
+	scale, ok := numberScales[word]
+	if !ok {
+		return false
+	}
+	if n.current == 0 {
+		n.current = 1
+	}
+	if scale == 100 {
+		n.current *= scale
+	} else {
+		n.total += n.current * scale
+		n.current = 0
+	}
+	n.active, n.scaled = true, true
+	return true
+}
+
+// isNamedEntity reports whether the word at offset is capitalized and does not start a sentence
+func isNamedEntity(prompt string, offset int, word string) bool {
+	first, _ := utf8.DecodeRuneInString(word)
+	if !unicode.IsUpper(first) || word == "I" {
+		return false
+	}
+	before := strings.TrimRightFunc(prompt[:offset], unicode.IsSpace)
+	return before != "" && !strings.ContainsAny(before[len(before)-1:], ".!?")
+}
+
+// queryValues returns the string values of a cached query, skipping JSON object keys
+// and MongoDB field paths such as "$total"
+func queryValues(query string) []string {
+	var values []string
+	for _, m := range quotedPattern.FindAllStringSubmatch(query, -1) {
+		values = append(values, strings.ReplaceAll(m[1], "''", "'"))
+	}
+	if trimmed := strings.TrimSpace(query); strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		for _, m := range jsonValuePattern.FindAllStringSubmatch(query, -1) {
+			if m[2] == "" && !strings.HasPrefix(m[1], "$") {
+				values = append(values, m[1])
+			}
+		}
+	}
+	return values
+}
+
+// bindsMissingValue reports whether query filters on a value taken from its original
+// prompt that the new prompt does not mention, e.g. 'paris' for "orders from paris"
+// when the new prompt is "orders from berlin"
+func bindsMissingValue(query, original, prompt string) bool {
+	original = " " + NormalizePrompt(original) + " "
+	prompt = " " + NormalizePrompt(prompt) + " "
+	for _, value := range queryValues(query) {
+		value = NormalizePrompt(value)
+		if !strings.ContainsFunc(value, unicode.IsLetter) {
+			continue
+		}
+		if strings.Contains(original, " "+value+" ") && !strings.Contains(prompt, " "+value+" ") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,229 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// QueryKey identifies a generated query in the query cache
+type QueryKey struct {
+	Prompt   string
+	Database string
+	Template string
+	Schema   string
+}
+
+// String returns the cache key for k. Prompts that only differ in case,
+// whitespace or punctuation share a key, and any schema change produces a new key.
+func (k QueryKey) String() string {
+	h := sha256.New()
+	for _, part := range []string{NormalizePrompt(k.Prompt), k.Database, k.Template, SchemaFingerprint(k.Schema)} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// NormalizePrompt lowercases a prompt, strips punctuation and collapses whitespace.
+// Signs and decimal points of numbers are kept, so "-100" and "3.5" keep their meaning.
+func NormalizePrompt(prompt string) string {
+	runes := []rune(prompt)
+	digitAt := func(i int) bool { return i >= 0 && i < len(runes) && unicode.IsDigit(runes[i]) }
+	cleaned := make([]rune, len(runes))
+	for i, r := range runes {
+		switch {
+		case r == '-' && digitAt(i+1):
+			cleaned[i] = r
+		case r == '.' && digitAt(i-1) && digitAt(i+1):
+			cleaned[i] = r
+		case unicode.IsPunct(r):
+			cleaned[i] = ' '
+		default:
+			cleaned[i] = unicode.ToLower(r)
+		}
+	}
+	return strings.Join(strings.Fields(string(cleaned)), " ")
+}
+
+// SchemaFingerprint returns a stable hash of a schema description
+func SchemaFingerprint(schema string) string {
+	sum := sha256.Sum256([]byte(schema))
+	return hex.EncodeToString(sum[:])
+}
+
+// QueryEntry is a validated query stored in the query cache
+type QueryEntry struct {
+	Prompt    string    `json:"prompt"`
+	Query     string    `json:"query"`
+	Database  string    `json:"database"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// Expired reports whether the entry has passed its expiry time
+func (e QueryEntry) Expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && now.After(e.ExpiresAt)
+}
+
+// QueryStore persists query cache entries
+type QueryStore interface {
+	Get(key string) (QueryEntry, bool, error)
+	Set(key string, entry QueryEntry) error
+	Delete(key string) error
+}
+
+// QueryCache caches validated queries so identical questions skip the LLM
+type QueryCache struct {
+	store QueryStore
+	ttl   time.Duration
+}
+
+// NewQueryCache creates a query cache on top of store. A ttl of 0 keeps entries forever.
+func NewQueryCache(store QueryStore, ttl time.Duration) *QueryCache {
+	return &QueryCache{store: store, ttl: ttl}
+}
+
+// Get returns the cached entry for key if present and not expired
+func (c *QueryCache) Get(key QueryKey) (QueryEntry, bool) {
+	k := key.String()
+	entry, ok, err := c.store.Get(k)
+	if err != nil || !ok {
+		return QueryEntry{}, false
+	}
+	if entry.Expired(time.Now()) {
+		_ = c.store.Delete(k)
+		return QueryEntry{}, false
+	}
+	return entry, true
+}
+
+// Put stores a validated query under key
+func (c *QueryCache) Put(key QueryKey, query string) error {
+	now := time.Now()
+	entry := QueryEntry{
+		Prompt:    key.Prompt,
+		Query:     query,
+		Database:  key.Database,
+		CreatedAt: now,
+	}
+	if c.ttl > 0 {
+		entry.ExpiresAt = now.Add(c.ttl)
+	}
+	return c.store.Set(key.String(), entry)
+}
+
+// Invalidate removes the entry for key
+func (c *QueryCache) Invalidate(key QueryKey) error {
+	return c.store.Delete(key.String())
+}
+
+// MemoryStore is an in-memory QueryStore
+type MemoryStore struct {
+	mu      sync.RWMutex
+	entries map[string]QueryEntry
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]QueryEntry)}
+}
+
+func (s *MemoryStore) Get(key string) (QueryEntry, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entry, ok := s.entries[key]
+	return entry, ok, nil
+}
+
+func (s *MemoryStore) Set(key string, entry QueryEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = entry
+	return nil
+}
+
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// FileStore is a QueryStore that keeps one JSON file per entry in a directory
+type FileStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileStore creates a file-backed store, creating dir if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	if dir == "" {
+		return nil, errors.New("cache directory cannot be empty")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory %s: %w", dir, err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) path(key string) string {
+	return filepath.Join(s.dir, key+".json")
+}
+
+func (s *FileStore) Get(key string) (QueryEntry, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return QueryEntry{}, false, nil
+	}
+	if err != nil {
+		return QueryEntry{}, false, fmt.Errorf("failed to read cache entry: %w", err)
+	}
+
+	var entry QueryEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return QueryEntry{}, false, fmt.Errorf("failed to decode cache entry: %w", err)
+	}
+	return entry, true, nil
+}
+
+func (s *FileStore) Set(key string, entry QueryEntry) error {
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode cache entry: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Write to a temporary file first so readers never see a partial entry
+	tmp := s.path(key) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := os.Rename(tmp, s.path(key)); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	return nil
+}
+
+func (s *FileStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Remove(s.path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete cache entry: %w", err)
+	}
+	return nil
+}
@@ -36,6 +36,14 @@ func GetCachedSchema(dbName string) (string, bool) {
 	return schema, ok
 }
 
+// RemoveSchema removes the cached schema of a database, so it is introspected again.
+// It's safe for concurrent use by multiple goroutines.
+func RemoveSchema(dbName string) {
+	schemaCacheMu.Lock()
+	defer schemaCacheMu.Unlock()
+	delete(schemaCache, dbName)
+}
+
 // GetAllCachedSchemas returns a copy of all cached schemas.
 // This is safe for concurrent access and returns a snapshot of the cache.
 func GetAllCachedSchemas() map[string]string {
@@ -0,0 +1,228 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/vijaylingoju/prompterdb/llm"
+)
+
+const (
+	// DefaultSimilarityThreshold is the minimum cosine similarity for a semantic cache hit
+	DefaultSimilarityThreshold = 0.92
+	// DefaultMaxSemanticEntries is the number of prompts a semantic cache indexes before
+	// the oldest are dropped
+	DefaultMaxSemanticEntries = 10000
+)
+
+// SemanticMatch is a cached query found for a paraphrased prompt
+type SemanticMatch struct {
+	Prompt     string  // original prompt the query was generated for
+	Query      string  // validated query
+	Similarity float64 // cosine similarity between the two prompts
+}
+
+type semanticEntry struct {
+	Prompt    string    `json:"prompt"`
+	Query     string    `json:"query"`
+	Database  string    `json:"database"`
+	Template  string    `json:"template"`
+	Schema    string    `json:"schema"` // schema fingerprint
+	Vector    []float64 `json:"vector"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SemanticCache is a local vector index of past prompts. It reuses validated
+// queries for prompts that are worded differently but mean the same thing.
+type SemanticCache struct {
+	embedder  llm.Embedder
+	threshold float64
+
+	mu         sync.RWMutex
+	entries    []semanticEntry // oldest first
+	maxEntries int
+	ttl        time.Duration
+
+	// the most recent lookup is remembered so Add does not embed the same prompt twice
+	lastPrompt string
+	lastVector []float64
+}
+
+// NewSemanticCache creates a semantic cache. A threshold of 0 uses DefaultSimilarityThreshold.
+func NewSemanticCache(embedder llm.Embedder, threshold float64) *SemanticCache {
+	if threshold <= 0 {
+		threshold = DefaultSimilarityThreshold
+	}
+	return &SemanticCache{embedder: embedder, threshold: threshold, maxEntries: DefaultMaxSemanticEntries}
+}
+
+// SetMaxEntries sets the number of prompts indexed before the oldest are dropped.
+// A value of 0 or less restores DefaultMaxSemanticEntries.
+func (c *SemanticCache) SetMaxEntries(n int) {
+	if n <= 0 {
+		n = DefaultMaxSemanticEntries
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxEntries = n
+	c.prune(time.Now())
+}
+
+// SetTTL sets how long an indexed query is reused. A ttl of 0 keeps entries until they are dropped by the cap.
+func (c *SemanticCache) SetTTL(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ttl = ttl
+}
+
+// Lookup returns the most similar cached query for the same database, template
+// and schema, if its similarity reaches the threshold. Prompts with different
+// numbers, quoted values or named entities, e.g. "orders over 100" and "orders over
+// 1000" or "orders from Paris" and "orders from Berlin", never match, and neither do
+// prompts missing a value the cached query filters on.
+func (c *SemanticCache) Lookup(key QueryKey) (SemanticMatch, bool, error) {
+	vector, err := c.embed(key.Prompt)
+	if err != nil {
+		return SemanticMatch{}, false, err
+	}
+
+	fingerprint := SchemaFingerprint(key.Schema)
+	literals := promptLiterals(key.Prompt)
+	now := time.Now()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var best SemanticMatch
+	found := false
+	for _, entry := range c.entries {
+		if entry.Database != key.Database || entry.Template != key.Template || entry.Schema != fingerprint {
+			continue
+		}
+		if c.expired(entry, now) || !slices.Equal(literals, promptLiterals(entry.Prompt)) {
+			continue
+		}
+		if bindsMissingValue(entry.Query, entry.Prompt, key.Prompt) {
+			continue
+		}
+		similarity := llm.CosineSimilarity(vector, entry.Vector)
+		if similarity >= c.threshold && similarity > best.Similarity {
+			best = SemanticMatch{Prompt: entry.Prompt, Query: entry.Query, Similarity: similarity}
+			found = true
+		}
+	}
+	return best, found, nil
+}
+
+// Add indexes a validated query under its prompt, replacing the query indexed for the
+// same prompt, database, template and schema
+func (c *SemanticCache) Add(key QueryKey, query string) error {
+	vector, err := c.embed(key.Prompt)
+	if err != nil {
+		return err
+	}
+	entry := semanticEntry{
+		Prompt:    key.Prompt,
+		Query:     query,
+		Database:  key.Database,
+		Template:  key.Template,
+		Schema:    SchemaFingerprint(key.Schema),
+		Vector:    vector,
+		CreatedAt: time.Now(),
+	}
+	normalized := NormalizePrompt(key.Prompt)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = slices.DeleteFunc(c.entries, func(e semanticEntry) bool {
+		return e.Database == entry.Database && e.Template == entry.Template && e.Schema == entry.Schema &&
+			NormalizePrompt(e.Prompt) == normalized
+	})
+	c.entries = append(c.entries, entry)
+	c.prune(entry.CreatedAt)
+	return nil
+}
+
+// prune drops expired entries and the oldest entries above the cap. The caller holds the write lock.
+func (c *SemanticCache) prune(now time.Time) {
+	c.entries = slices.DeleteFunc(c.entries, func(e semanticEntry) bool { return c.expired(e, now) })
+	if c.maxEntries > 0 && len(c.entries) > c.maxEntries {
+		c.entries = append([]semanticEntry(nil), c.entries[len(c.entries)-c.maxEntries:]...)
+	}
+}
+
+// expired reports whether an entry is older than the TTL
+func (c *SemanticCache) expired(e semanticEntry, now time.Time) bool {
+	return c.ttl > 0 && now.Sub(e.CreatedAt) > c.ttl
+}
+
+// Len returns the number of indexed prompts
+func (c *SemanticCache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.entries)
+}
+
+// Save writes the index to a JSON file
+func (c *SemanticCache) Save(path string) error {
+	c.mu.RLock()
+	data, err := json.Marshal(c.entries)
+	c.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode semantic cache: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write semantic cache %s: %w", path, err)
+	}
+	return nil
+}
+
+// Load replaces the index with the contents of a file written by Save.
+// A missing file leaves the index empty.
+func (c *SemanticCache) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read semantic cache %s: %w", path, err)
+	}
+
+	var entries []semanticEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("failed to decode semantic cache %s: %w", path, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = entries
+	c.prune(time.Now())
+	return nil
+}
+
+func (c *SemanticCache) embed(prompt string) ([]float64, error) {
+	normalized := NormalizePrompt(prompt)
+
+	c.mu.RLock()
+	if c.lastPrompt == normalized && c.lastVector != nil {
+		vector := c.lastVector
+		c.mu.RUnlock()
+		return vector, nil
+	}
+	c.mu.RUnlock()
+
+	vector, err := c.embedder.Embed(normalized)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed prompt: %w", err)
+	}
+
+	c.mu.Lock()
+	c.lastPrompt, c.lastVector = normalized, vector
+	c.mu.Unlock()
+	return vector, nil
+}
@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"reflect"
+	"testing"
+)
+
+// constantEmbedder embeds every prompt to the same vector, so only the literal checks decide a match
+type constantEmbedder struct{}
+
+func (constantEmbedder) Embed(string) ([]float64, error) { return []float64{1, 0}, nil }
+
+func TestPromptLiterals(t *testing.T) {
+	tests := []struct {
+		prompt string
+		want   []string
+	}{
+		{"top 10 customers by spend", []string{"10"}},
+		{"ten biggest spending customers", []string{"10"}},
+		{"Twenty-five most recent orders", []string{"25"}},
+		{"orders over two hundred and fifty", []string{"250"}},
+		{"orders over 3 thousand", []string{"3000"}},
+		{"orders between ten and twenty", []string{"10", "20"}},
+		{"orders between 10 and 20", []string{"10", "20"}},
+		{"top 5 three-star products", []string{"5", "3"}},
+		{"orders from Paris", []string{"Paris"}},
+		{"Paris orders. Show New York too", []string{"New", "York"}},
+		{`orders with status 'shipped' over -1.5`, []string{"shipped", "-1.5"}},
+		{"orders from paris", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prompt, func(t *testing.T) {
+			if got := promptLiterals(tt.prompt); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("promptLiterals() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSemanticCacheLookup(t *testing.T) {
+	tests := []struct {
+		name   string
+		cached string
+		query  string
+		prompt string
+		hit    bool
+	}{
+		{
+			name:   "number words",
+			cached: "top 10 customers by spend",
+			query:  "SELECT name FROM customers ORDER BY spend DESC LIMIT 10",
+			prompt: "ten biggest spending customers",
+			hit:    true,
+		},
+		{
+			name:   "mongo field paths are not values",
+			cached: "top 10 customers by spend",
+			query:  `{"operation": "aggregate", "collection": "customers", "pipeline": [{"$sort": {"spend": -1}}, {"$project": {"spend": "$spend"}}, {"$limit": 10}]}`,
+			prompt: "ten biggest spending customers",
+			hit:    true,
+		},
+		{
+			name:   "different numbers",
+			cached: "top 10 customers by spend",
+			query:  "SELECT name FROM customers ORDER BY spend DESC LIMIT 10",
+			prompt: "twenty biggest spending customers",
+		},
+		{
+			name:   "named entities",
+			cached: "orders from Paris",
+			query:  "SELECT * FROM orders WHERE city = 'Paris'",
+			prompt: "orders from Berlin",
+		},
+		{
+			name:   "unquoted lowercase value",
+			cached: "orders from paris",
+			query:  "SELECT * FROM orders WHERE city = 'Paris'",
+			prompt: "orders from berlin",
+		},
+		{
+			name:   "value bound as an argument",
+			cached: "orders from paris",
+			query:  `{"query": "SELECT * FROM orders WHERE city = $1", "args": [{"type": "text", "value": "Paris"}]}`,
+			prompt: "orders from berlin",
+		},
+		{
+			name:   "value in a mongo filter",
+			cached: "orders from paris",
+			query:  `{"operation": "find", "collection": "orders", "filter": {"city": "Paris"}}`,
+			prompt: "orders from berlin",
+		},
+		{
+			name:   "same value reworded",
+			cached: "orders from paris",
+			query:  "SELECT * FROM orders WHERE city = 'Paris'",
+			prompt: "show the orders shipped from paris",
+			hit:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewSemanticCache(constantEmbedder{}, 0)
+			if err := c.Add(QueryKey{Prompt: tt.cached, Database: "shop"}, tt.query); err != nil {
+				t.Fatalf("Add() error = %v", err)
+			}
+			match, ok, err := c.Lookup(QueryKey{Prompt: tt.prompt, Database: "shop"})
+			if err != nil {
+				t.Fatalf("Lookup() error = %v", err)
+			}
+			if ok != tt.hit {
+				t.Fatalf("Lookup() hit = %v, want %v", ok, tt.hit)
+			}
+			if ok && match.Query != tt.query {
+				t.Errorf("Lookup() query = %q, want %q", match.Query, tt.query)
+			}
+		})
+	}
+}
@@ -1,17 +1,65 @@
 package config
 
+import (
+	"crypto/tls"
+	"time"
+)
+
 type DBType string
 
 const (
-	Postgres DBType = "postgres"
-	Mongo    DBType = "mongo"
+	Postgres  DBType = "postgres"
+	Mongo     DBType = "mongo"
+	MySQL     DBType = "mysql" // MySQL and MariaDB
+	SQLite    DBType = "sqlite"
+	Analytics DBType = "analytics" // in-memory SQLite over files and earlier results
 )
 
 type DBConfig struct {
 	Name   string
 	Type   DBType
 	URI    string
-	DBName string // Only used for Mongo
+	DBName string   // Only used for Mongo
+	Files  []string // Files loaded as tables, only used for Analytics
+	Pool   PoolConfig
+
+	// Replicas are Postgres read replicas. SELECT queries go to a replica and
+	// writes to URI, the primary.
+	Replicas []ReplicaConfig
+	// MaxReplicaLag is the replication delay above which reads go to the primary.
+	// For Mongo it is the max staleness of the read preference.
+	MaxReplicaLag time.Duration
+	// ReadPreference is the Mongo read preference mode for reads, e.g. "secondaryPreferred".
+	// Replica set members are discovered from URI.
+	ReadPreference string
+}
+
+// ReplicaConfig describes a read replica
+type ReplicaConfig struct {
+	URI  string
+	Pool PoolConfig
+}
+
+// PoolConfig holds the connection pool and session settings of a database.
+// Zero values keep the defaults of the db package.
+type PoolConfig struct {
+	MaxConns          int32         // maximum pool size
+	MinConns          int32         // connections kept open when idle
+	MaxConnLifetime   time.Duration // Postgres, MySQL and SQLite files
+	MaxConnIdleTime   time.Duration
+	HealthCheckPeriod time.Duration // Postgres only
+	ConnectTimeout    time.Duration
+	PingTimeout       time.Duration // time allowed for the ping that verifies a new connection
+
+	// StatementTimeout is sent as statement_timeout for Postgres and as the
+	// client-side operation timeout for Mongo
+	StatementTimeout time.Duration
+	ApplicationName  string
+	SearchPath       []string // Postgres schemas, in lookup order
+
+	// TLS replaces the TLS settings of the connection string. With Postgres,
+	// connections no longer fall back to plain text.
+	TLS *tls.Config
 }
 
 var RegisteredDBs = map[string]DBConfig{}
@@ -2,27 +2,156 @@
 package prompterdb
 
 import (
+	"crypto/tls"
+	"fmt"
+	"time"
+
 	"github.com/vijaylingoju/prompterdb/config"
 	"github.com/vijaylingoju/prompterdb/db"
 )
 
+// ConnectOption changes the configuration of a database before it is connected
+type ConnectOption func(*config.DBConfig)
+
+// WithPool replaces the pool settings
+func WithPool(pool config.PoolConfig) ConnectOption {
+	return func(cfg *config.DBConfig) { cfg.Pool = pool }
+}
+
+// WithPoolSize sets the minimum and maximum number of pooled connections
+func WithPoolSize(minConns, maxConns int32) ConnectOption {
+	return func(cfg *config.DBConfig) {
+		cfg.Pool.MinConns = minConns
+		cfg.Pool.MaxConns = maxConns
+	}
+}
+
+// WithConnLifetime sets how long connections live and may stay idle
+func WithConnLifetime(maxLifetime, maxIdle time.Duration) ConnectOption {
+	return func(cfg *config.DBConfig) {
+		cfg.Pool.MaxConnLifetime = maxLifetime
+		cfg.Pool.MaxConnIdleTime = maxIdle
+	}
+}
+
+// WithPingTimeout sets the time allowed for the ping that verifies the connection
+func WithPingTimeout(d time.Duration) ConnectOption {
+	return func(cfg *config.DBConfig) { cfg.Pool.PingTimeout = d }
+}
+
+// WithStatementTimeout sets the server-side statement timeout
+func WithStatementTimeout(d time.Duration) ConnectOption {
+	return func(cfg *config.DBConfig) { cfg.Pool.StatementTimeout = d }
+}
+
+// WithApplicationName sets the name the connections report to the server
+func WithApplicationName(name string) ConnectOption {
+	return func(cfg *config.DBConfig) { cfg.Pool.ApplicationName = name }
+}
+
+// WithSearchPath sets the Postgres schema search path
+func WithSearchPath(schemas ...string) ConnectOption {
+	return func(cfg *config.DBConfig) { cfg.Pool.SearchPath = schemas }
+}
+
+// WithReplica adds a Postgres read replica with its own pool settings
+func WithReplica(uri string, pool config.PoolConfig) ConnectOption {
+	return func(cfg *config.DBConfig) {
+		cfg.Replicas = append(cfg.Replicas, config.ReplicaConfig{URI: uri, Pool: pool})
+	}
+}
+
+// WithMaxReplicaLag sets the replication delay above which reads go to the primary
+func WithMaxReplicaLag(d time.Duration) ConnectOption {
+	return func(cfg *config.DBConfig) { cfg.MaxReplicaLag = d }
+}
+
+// WithReadPreference sets the Mongo read preference mode, e.g. "secondaryPreferred"
+func WithReadPreference(mode string) ConnectOption {
+	return func(cfg *config.DBConfig) { cfg.ReadPreference = mode }
+}
+
+// WithTLS sets the TLS configuration of the connections
+func WithTLS(tlsConfig *tls.Config) ConnectOption {
+	return func(cfg *config.DBConfig) { cfg.Pool.TLS = tlsConfig }
+}
+
 // ConnectPostgres connects and registers a Postgres database
-func ConnectPostgres(name, uri string) error {
-	config.RegisterDB(config.DBConfig{
+func ConnectPostgres(name, uri string, opts ...ConnectOption) error {
+	return Connect(config.DBConfig{
 		Name: name,
 		Type: config.Postgres,
 		URI:  uri,
-	})
-	return db.ConnectPostgres(name, uri)
+	}, opts...)
 }
 
 // ConnectMongo connects and registers a Mongo database
-func ConnectMongo(name, uri, dbName string) error {
-	config.RegisterDB(config.DBConfig{
+func ConnectMongo(name, uri, dbName string, opts ...ConnectOption) error {
+	return Connect(config.DBConfig{
 		Name:   name,
 		Type:   config.Mongo,
 		URI:    uri,
 		DBName: dbName,
-	})
-	return db.ConnectMongo(name, uri)
+	}, opts...)
+}
+
+// ConnectMySQL connects and registers a MySQL or MariaDB database
+func ConnectMySQL(name, uri string, opts ...ConnectOption) error {
+	return Connect(config.DBConfig{
+		Name: name,
+		Type: config.MySQL,
+		URI:  uri,
+	}, opts...)
+}
+
+// ConnectSQLite opens and registers the SQLite database at path, or :memory:
+func ConnectSQLite(name, path string, opts ...ConnectOption) error {
+	return Connect(config.DBConfig{
+		Name: name,
+		Type: config.SQLite,
+		URI:  path,
+	}, opts...)
+}
+
+// Connect connects and registers a database described by cfg, using the driver
+// registered for its type
+func Connect(cfg config.DBConfig, opts ...ConnectOption) error {
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	drv, err := db.GetDriver(cfg.Type)
+	if err != nil {
+		return err
+	}
+	// a failed connect leaves the previous registration of the name in place
+	previous, registered := config.RegisteredDBs[cfg.Name]
+	config.RegisterDB(cfg)
+	if err := drv.Connect(cfg); err != nil {
+		if registered {
+			config.RegisteredDBs[cfg.Name] = previous
+		} else {
+			delete(config.RegisteredDBs, cfg.Name)
+		}
+		return err
+	}
+	return nil
+}
+
+// Close closes the connection of a registered database
+func Close(name string) error {
+	cfg, ok := config.RegisteredDBs[name]
+	if !ok {
+		return fmt.Errorf("database %s is not registered", name)
+	}
+	drv, err := db.GetDriver(cfg.Type)
+	if err != nil {
+		return err
+	}
+	return drv.Close(name)
+}
+
+// RegisterDriver makes a database backend available to Connect, Ask and the router
+// for databases of the given type. Registering a built-in type replaces its driver.
+func RegisterDriver(dbType config.DBType, driver db.Driver) {
+	db.RegisterDriver(dbType, driver)
 }
@@ -0,0 +1,143 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/vijaylingoju/prompterdb/config"
+	"github.com/vijaylingoju/prompterdb/llm"
+)
+
+// ErrDriverNotFound is returned when no driver is registered for a DB type
+var ErrDriverNotFound = errors.New("database driver not found")
+
+// Driver is a database backend. Drivers for Postgres, MySQL, SQLite and MongoDB are
+// built in; other backends are added with RegisterDriver.
+type Driver interface {
+	// Connect opens the database described by cfg and keeps its connection under cfg.Name
+	Connect(cfg config.DBConfig) error
+	// Close closes the connection with the given name
+	Close(name string) error
+	// Introspect returns the schema of a connected database, as shown to the LLM
+	Introspect(ctx context.Context, name string) (string, error)
+	// TemplateKey is the directory the driver's prompt and response templates are
+	// loaded from, e.g. system_prompts/<key>/default.tmpl
+	TemplateKey() string
+	// QueryType is the kind of query the LLM writes for the driver
+	QueryType() llm.QueryType
+	// Validate parses a generated query and checks it is safe to run
+	Validate(cfg config.DBConfig, query string, opts ExecOptions) (*Statement, error)
+	// Execute runs a validated statement. Statements that are Pageable return at most
+	// opts.Page.Size rows, starting at opts.Page, with Truncated set when more remain.
+	Execute(ctx context.Context, cfg config.DBConfig, stmt *Statement, opts ExecOptions) (*ResultSet, error)
+}
+
+// RequestPreparer is implemented by drivers that add to the LLM request of a prompt,
+// like the MongoDB driver, which picks the collection the prompt is about
+type RequestPreparer interface {
+	PrepareRequest(cfg config.DBConfig, req *llm.QueryRequest) error
+}
+
+// Statement is a validated query
+type Statement struct {
+	Query      string         // query text, as reported to the caller
+	Args       []llm.QueryArg // arguments bound to the placeholders of a SQL query
+	Values     []interface{}  // Go values of Args passed to the database
+	Collection string         // collection the query runs on, for document databases
+	Pageable   bool           // the statement returns rows that can be read page by page
+	Native     interface{}    // driver-specific form of the query, e.g. *llm.MongoQuery
+}
+
+// ExecOptions are the settings a generated query is validated and run with
+type ExecOptions struct {
+	Guard       QueryGuard       // server-side limits of SQL statements
+	MongoPolicy *llm.MongoPolicy // restrictions of MongoDB queries (default llm.DefaultMongoPolicy)
+	Collection  string           // collection used when a MongoDB query names none
+	Page        Page
+}
+
+// Page selects the rows of a pageable statement
+type Page struct {
+	Size   int         // rows per page; 0 uses RowLimit
+	Offset int64       // rows to skip, for offset pagination
+	Key    string      // ordering column, for keyset pagination
+	After  interface{} // last key value of the previous page
+}
+
+// size returns the page size, or RowLimit when none is set
+func (p Page) size() int {
+	if p.Size > 0 {
+		return p.Size
+	}
+	return RowLimit()
+}
+
+var (
+	// drivers holds the registered drivers by DB type
+	drivers   = make(map[config.DBType]Driver)
+	driversMu sync.RWMutex
+)
+
+func init() {
+	RegisterDriver(config.Postgres, postgresDriver())
+	RegisterDriver(config.MySQL, mysqlDriver())
+	RegisterDriver(config.SQLite, sqliteDriver())
+	RegisterDriver(config.Mongo, mongoDriver{})
+}
+
+// RegisterDriver makes a driver available for databases of the given type.
+// Registering a type again replaces its driver.
+func RegisterDriver(dbType config.DBType, d Driver) {
+	if d == nil {
+		panic("db: RegisterDriver driver is nil")
+	}
+
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	if _, exists := drivers[dbType]; exists {
+		log.Printf("Warning: replacing the driver registered for %s", dbType)
+	}
+	drivers[dbType] = d
+}
+
+// GetDriver returns the driver registered for a DB type
+func GetDriver(dbType config.DBType) (Driver, error) {
+	driversMu.RLock()
+	d, ok := drivers[dbType]
+	driversMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrDriverNotFound, dbType)
+	}
+	return d, nil
+}
+
+// Drivers returns the DB types that have a registered driver, sorted
+func Drivers() []config.DBType {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+
+	types := make([]config.DBType, 0, len(drivers))
+	for t := range drivers {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+// Introspect returns the schema of a registered database using the driver of its type
+func Introspect(ctx context.Context, name string) (string, error) {
+	cfg, ok := config.RegisteredDBs[name]
+	if !ok {
+		return "", fmt.Errorf("database %s is not registered", name)
+	}
+	d, err := GetDriver(cfg.Type)
+	if err != nil {
+		return "", err
+	}
+	return d.Introspect(ctx, name)
+}
@@ -0,0 +1,359 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/vijaylingoju/prompterdb/config"
+	"github.com/vijaylingoju/prompterdb/llm"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// mongoDriver is the driver of MongoDB databases. Generated queries are JSON documents
+// naming an operation, which is run on the collection the prompt is about.
+type mongoDriver struct{}
+
+func (mongoDriver) Connect(cfg config.DBConfig) error {
+	if len(cfg.Replicas) > 0 {
+		log.Printf("Warning: replicas of %s are ignored, MongoDB discovers replica set members from the URI", cfg.Name)
+	}
+	if err := ConnectMongoWithConfig(cfg.Name, cfg.URI, cfg.Pool); err != nil {
+		return err
+	}
+	if cfg.ReadPreference != "" {
+		return SetMongoReadPreference(cfg.Name, cfg.ReadPreference, cfg.MaxReplicaLag)
+	}
+	return nil
+}
+
+func (mongoDriver) Close(name string) error { return CloseMongo(name) }
+
+func (mongoDriver) Introspect(ctx context.Context, name string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return GetMongoSchema(name)
+}
+
+func (mongoDriver) TemplateKey() string { return string(config.Mongo) }
+
+func (mongoDriver) QueryType() llm.QueryType { return llm.QueryTypeMongo }
+
+// PrepareRequest picks the collection the prompt is about and passes it to the
+// templates as .Collection
+func (mongoDriver) PrepareRequest(cfg config.DBConfig, req *llm.QueryRequest) error {
+	collection := MostRelevantMongoCollection(req.Prompt, cfg.Name)
+	if collection == "" {
+		return errors.New("could not infer MongoDB collection name from prompt")
+	}
+	if req.CustomVars == nil {
+		req.CustomVars = make(map[string]interface{})
+	}
+	req.CustomVars["Collection"] = collection
+	return nil
+}
+
+// Validate validates a generated MongoDB query against the policy of opts and parses it.
+// The policy's default $limit is added to aggregation pipelines that are not paged;
+// paged pipelines are bounded by the page size instead, so their rows are not cut short.
+func (mongoDriver) Validate(cfg config.DBConfig, query string, opts ExecOptions) (*Statement, error) {
+	policy := llm.DefaultMongoPolicy()
+	if opts.MongoPolicy != nil {
+		policy = *opts.MongoPolicy
+	}
+	if err := llm.ValidateMongoWithPolicy(query, policy); err != nil {
+		return nil, err
+	}
+	mongoQuery, err := llm.ParseMongoQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("%w\nRaw response: %s", err, query)
+	}
+	// Use the collection picked for the prompt if the query names none
+	if mongoQuery.Collection == "" {
+		mongoQuery.Collection = opts.Collection
+	}
+
+	pageable := mongoQuery.Operation == "find" ||
+		(mongoQuery.Operation == "aggregate" && !(policy.AllowWriteStages && hasWriteStage(mongoQuery.Pipeline)))
+	if mongoQuery.Operation == "aggregate" && !pageable {
+		mongoQuery.Pipeline = llm.EnforcePipelineLimit(mongoQuery.Pipeline, policy.DefaultLimit)
+	}
+	return &Statement{
+		Query:      query,
+		Collection: mongoQuery.Collection,
+		Pageable:   pageable,
+		Native:     mongoQuery,
+	}, nil
+}
+
+// Execute runs one page of a find or aggregate query, or any other operation in full
+func (mongoDriver) Execute(ctx context.Context, cfg config.DBConfig, stmt *Statement, opts ExecOptions) (*ResultSet, error) {
+	q, ok := stmt.Native.(*llm.MongoQuery)
+	if !ok {
+		return nil, errors.New("statement was not validated by the MongoDB driver")
+	}
+	if stmt.Pageable {
+		return runMongoPage(cfg, q, opts.Page)
+	}
+
+	var rows []map[string]interface{}
+	var err error
+	switch q.Operation {
+	case "findOne":
+		rows, err = FindOneMongo(cfg.Name, cfg.DBName, q.Collection, q.Filter, mongoFindOptions(q))
+	case "countDocuments":
+		rows, err = CountMongo(cfg.Name, cfg.DBName, q.Collection, q.Filter)
+	case "estimatedDocumentCount":
+		rows, err = EstimatedCountMongo(cfg.Name, cfg.DBName, q.Collection)
+	case "distinct":
+		rows, err = DistinctMongo(cfg.Name, cfg.DBName, q.Collection, q.Field, q.Filter)
+	case "insert":
+		rows, err = InsertMongo(cfg.Name, cfg.DBName, q.Collection, q.Document)
+	case "insertMany":
+		rows, err = InsertManyMongo(cfg.Name, cfg.DBName, q.Collection, q.DocumentList())
+	case "bulkWrite":
+		models, modelErr := bulkWriteModels(q.Operations)
+		if modelErr != nil {
+			return nil, modelErr
+		}
+		rows, err = BulkWriteMongo(cfg.Name, cfg.DBName, q.Collection, models)
+	case "update":
+		rows, err = UpdateMongo(cfg.Name, cfg.DBName, q.Collection, q.Filter, q.Update)
+	case "delete":
+		rows, err = DeleteMongo(cfg.Name, cfg.DBName, q.Collection, q.Filter)
+	case "aggregate":
+		rows, err = AggregateMongo(cfg.Name, cfg.DBName, q.Collection, q.Pipeline)
+	default:
+		return nil, fmt.Errorf("unsupported Mongo operation: %s", q.Operation)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewResultSet(rows), nil
+}
+
+// runMongoPage runs one page of a find or aggregate query
+func runMongoPage(cfg config.DBConfig, q *llm.MongoQuery, p Page) (*ResultSet, error) {
+	switch q.Operation {
+	case "find":
+		filter, findOpts, limit := mongoFindPage(q, p)
+		return QueryMongoResultSet(cfg.Name, cfg.DBName, q.Collection, filter, findOpts, limit)
+	case "aggregate":
+		return AggregateMongoResultSet(cfg.Name, cfg.DBName, q.Collection, mongoAggregatePage(q, p), p.size())
+	}
+	return nil, fmt.Errorf("mongo operation %s does not support pagination", q.Operation)
+}
+
+// mongoFindPage returns the filter, options and row limit of a page of a find query
+func mongoFindPage(q *llm.MongoQuery, p Page) (bson.M, *FindOptions, int) {
+	findOpts := mongoFindOptions(q)
+	filter := q.Filter
+	limit := p.size()
+	if p.Key != "" {
+		// keep the direction the query sorts the key in
+		direction, op := 1, "$gt"
+		if sortsDescending(q.Sort, p.Key) {
+			direction, op = -1, "$lt"
+		}
+		findOpts.Sort = bson.D{{Key: p.Key, Value: direction}}
+		if p.After != nil {
+			findOpts.Skip = 0
+			after := bson.M{p.Key: bson.M{op: mongoKeyValue(p.Key, p.After)}}
+			filter = after
+			if len(q.Filter) > 0 {
+				filter = bson.M{"$and": bson.A{q.Filter, after}}
+			}
+		}
+	} else {
+		findOpts.Skip += p.Offset
+	}
+	// a limit asked for in the query bounds the pages, and needs no truncation check
+	findOpts.Limit = 0
+	if q.Limit > 0 && p.Key == "" {
+		remaining := q.Limit - p.Offset
+		if remaining <= int64(p.size()) {
+			limit = int(remaining)
+			findOpts.Limit = remaining
+		}
+	}
+	return filter, findOpts, limit
+}
+
+// mongoAggregatePage returns the pipeline of a page of an aggregate query: the query's
+// stages, then the keyset match and sort or the offset, and one row more than the page
+// to tell whether another page follows
+func mongoAggregatePage(q *llm.MongoQuery, p Page) []bson.D {
+	pipeline := append([]bson.D(nil), q.Pipeline...)
+	if p.Key != "" {
+		// keep the direction the pipeline sorts the key in
+		direction, op := 1, "$gt"
+		if pipelineSortsDescending(q.Pipeline, p.Key) {
+			direction, op = -1, "$lt"
+		}
+		if p.After != nil {
+			after := mongoKeyValue(p.Key, p.After)
+			pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{p.Key: bson.M{op: after}}}})
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$sort", Value: bson.D{{Key: p.Key, Value: direction}}}})
+	} else if p.Offset > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$skip", Value: p.Offset}})
+	}
+	return append(pipeline, bson.D{{Key: "$limit", Value: p.size() + 1}})
+}
+
+// pipelineSortsDescending reports whether the last top-level $sort stage of a pipeline
+// orders key descending
+func pipelineSortsDescending(pipeline []bson.D, key string) bool {
+	for i := len(pipeline) - 1; i >= 0; i-- {
+		for _, e := range pipeline[i] {
+			if e.Key != "$sort" {
+				continue
+			}
+			switch sort := e.Value.(type) {
+			case bson.D:
+				return sortsDescending(sort, key)
+			case bson.M:
+				return sortsDescending(bson.D{{Key: key, Value: sort[key]}}, key)
+			}
+			return false
+		}
+	}
+	return false
+}
+
+// sortsDescending reports whether a sort document orders key descending
+func sortsDescending(sort bson.D, key string) bool {
+	for _, e := range sort {
+		if e.Key != key {
+			continue
+		}
+		switch v := e.Value.(type) {
+		case int32:
+			return v < 0
+		case int64:
+			return v < 0
+		case int:
+			return v < 0
+		case float64:
+			return v < 0
+		}
+	}
+	return false
+}
+
+// mongoKeyValue restores the BSON type of a page key value that was normalized for JSON:
+// hex ObjectIDs of _id and RFC 3339 dates
+func mongoKeyValue(key string, v interface{}) interface{} {
+	s, ok := v.(string)
+	if !ok {
+		return v
+	}
+	if key == "_id" {
+		if id, err := primitive.ObjectIDFromHex(s); err == nil {
+			return id
+		}
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t
+	}
+	return v
+}
+
+// hasWriteStage reports whether a pipeline ends in $out or $merge
+func hasWriteStage(pipeline []bson.D) bool {
+	if len(pipeline) == 0 {
+		return false
+	}
+	for _, e := range pipeline[len(pipeline)-1] {
+		if e.Key == "$out" || e.Key == "$merge" {
+			return true
+		}
+	}
+	return false
+}
+
+// mongoFindOptions collects the find options of a find or findOne query
+func mongoFindOptions(q *llm.MongoQuery) *FindOptions {
+	return &FindOptions{
+		Projection: q.Projection,
+		Sort:       q.Sort,
+		Limit:      q.Limit,
+		Skip:       q.Skip,
+		Hint:       q.Hint,
+		Collation:  q.DriverCollation(),
+	}
+}
+
+// bulkWriteModels converts the operations of a bulkWrite query into driver write models
+func bulkWriteModels(operations []bson.M) ([]mongo.WriteModel, error) {
+	models := make([]mongo.WriteModel, 0, len(operations))
+	for i, op := range operations {
+		for name, v := range op {
+			body, ok := v.(bson.M)
+			if !ok {
+				return nil, fmt.Errorf("bulkWrite operation %d: %s must be an object", i, name)
+			}
+			upsert, _ := body["upsert"].(bool)
+			switch name {
+			case "insertOne":
+				models = append(models, mongo.NewInsertOneModel().SetDocument(body["document"]))
+			case "updateOne":
+				models = append(models, mongo.NewUpdateOneModel().
+					SetFilter(body["filter"]).SetUpdate(body["update"]).SetUpsert(upsert))
+			case "updateMany":
+				models = append(models, mongo.NewUpdateManyModel().
+					SetFilter(body["filter"]).SetUpdate(body["update"]).SetUpsert(upsert))
+			case "replaceOne":
+				models = append(models, mongo.NewReplaceOneModel().
+					SetFilter(body["filter"]).SetReplacement(body["replacement"]).SetUpsert(upsert))
+			default:
+				return nil, fmt.Errorf("unsupported bulkWrite operation %d: %s", i, name)
+			}
+		}
+	}
+	return models, nil
+}
+
+// MostRelevantMongoCollection returns the collection of a Mongo database whose schema
+// shares the most words with the prompt, or "" if none does
+func MostRelevantMongoCollection(prompt string, dbName string) string {
+	prompt = strings.ToLower(prompt)
+
+	cfg, ok := config.RegisteredDBs[dbName]
+	if !ok || cfg.Type != config.Mongo {
+		return ""
+	}
+
+	schema, err := GetMongoSchema(dbName)
+	if err != nil || schema == "" {
+		return ""
+	}
+
+	bestMatch := ""
+	highestScore := 0
+
+	lines := strings.Split(schema, "\n")
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		lineLower := strings.ToLower(line)
+		score := 0
+		for _, word := range strings.Fields(prompt) {
+			if strings.Contains(lineLower, word) {
+				score++
+			}
+		}
+		if score > highestScore {
+			highestScore = score
+			bestMatch = strings.SplitN(line, "(", 2)[0]
+		}
+	}
+	return bestMatch
+}
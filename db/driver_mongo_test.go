@@ -0,0 +1,118 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/vijaylingoju/prompterdb/config"
+	"github.com/vijaylingoju/prompterdb/llm"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestValidateDoesNotCapPagedPipelines(t *testing.T) {
+	query := `{"operation": "aggregate", "collection": "orders", "pipeline": [{"$match": {"status": "paid"}}]}`
+	stmt, err := mongoDriver{}.Validate(config.DBConfig{Name: "shop"}, query, ExecOptions{})
+	if err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if !stmt.Pageable {
+		t.Fatal("aggregate statement is not pageable")
+	}
+	q := stmt.Native.(*llm.MongoQuery)
+	for _, stage := range q.Pipeline {
+		for _, e := range stage {
+			if e.Key == "$limit" {
+				t.Fatalf("policy $limit %v was added to a paged pipeline", e.Value)
+			}
+		}
+	}
+
+	// The only limit is one row past the page, which tells whether another page follows
+	pipeline := mongoAggregatePage(q, Page{Size: 5000})
+	if got, want := pipeline[len(pipeline)-1], (bson.D{{Key: "$limit", Value: 5001}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("last stage = %v, want %v", got, want)
+	}
+}
+
+func TestMongoAggregatePage(t *testing.T) {
+	match := bson.D{{Key: "$match", Value: bson.D{{Key: "status", Value: "paid"}}}}
+	tests := []struct {
+		name     string
+		pipeline []bson.D
+		page     Page
+		want     []bson.D
+	}{
+		{
+			name:     "first keyset page",
+			pipeline: []bson.D{match},
+			page:     Page{Size: 10, Key: "total"},
+			want: []bson.D{
+				match,
+				{{Key: "$sort", Value: bson.D{{Key: "total", Value: 1}}}},
+				{{Key: "$limit", Value: 11}},
+			},
+		},
+		{
+			name:     "ascending keyset page",
+			pipeline: []bson.D{match},
+			page:     Page{Size: 10, Key: "total", After: int64(5)},
+			want: []bson.D{
+				match,
+				{{Key: "$match", Value: bson.M{"total": bson.M{"$gt": int64(5)}}}},
+				{{Key: "$sort", Value: bson.D{{Key: "total", Value: 1}}}},
+				{{Key: "$limit", Value: 11}},
+			},
+		},
+		{
+			name:     "descending keyset page",
+			pipeline: []bson.D{match, {{Key: "$sort", Value: bson.D{{Key: "total", Value: int32(-1)}}}}},
+			page:     Page{Size: 10, Key: "total", After: int64(5)},
+			want: []bson.D{
+				match,
+				{{Key: "$sort", Value: bson.D{{Key: "total", Value: int32(-1)}}}},
+				{{Key: "$match", Value: bson.M{"total": bson.M{"$lt": int64(5)}}}},
+				{{Key: "$sort", Value: bson.D{{Key: "total", Value: -1}}}},
+				{{Key: "$limit", Value: 11}},
+			},
+		},
+		{
+			name:     "offset page",
+			pipeline: []bson.D{match},
+			page:     Page{Size: 10, Offset: 20},
+			want: []bson.D{
+				match,
+				{{Key: "$skip", Value: int64(20)}},
+				{{Key: "$limit", Value: 11}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mongoAggregatePage(&llm.MongoQuery{Operation: "aggregate", Pipeline: tt.pipeline}, tt.page)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mongoAggregatePage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMongoFindPageDescending(t *testing.T) {
+	q := &llm.MongoQuery{
+		Operation: "find",
+		Filter:    bson.M{"status": "paid"},
+		Sort:      bson.D{{Key: "total", Value: int32(-1)}},
+	}
+	filter, findOpts, limit := mongoFindPage(q, Page{Size: 10, Key: "total", After: int64(5)})
+
+	wantFilter := bson.M{"$and": bson.A{bson.M{"status": "paid"}, bson.M{"total": bson.M{"$lt": int64(5)}}}}
+	if !reflect.DeepEqual(filter, wantFilter) {
+		t.Errorf("filter = %v, want %v", filter, wantFilter)
+	}
+	if want := (bson.D{{Key: "total", Value: -1}}); !reflect.DeepEqual(findOpts.Sort, want) {
+		t.Errorf("sort = %v, want %v", findOpts.Sort, want)
+	}
+	if limit != 10 {
+		t.Errorf("limit = %d, want 10", limit)
+	}
+}
@@ -0,0 +1,298 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/vijaylingoju/prompterdb/config"
+	"github.com/vijaylingoju/prompterdb/llm"
+)
+
+// sqlDriver is the driver of a SQL database. The built-in SQL databases differ only
+// in their dialect and in the functions that connect to and query them.
+type sqlDriver struct {
+	dialect    llm.SQLDialect
+	connect    func(cfg config.DBConfig) error
+	close      func(name string) error
+	introspect func(name string) (string, error)
+	query      func(ctx context.Context, name, query string, limit int, guard QueryGuard, args ...interface{}) (*ResultSet, error)
+	execute    func(ctx context.Context, name, command string, guard QueryGuard, args ...interface{}) (int64, error)
+}
+
+func postgresDriver() *sqlDriver {
+	return &sqlDriver{
+		dialect: llm.DialectPostgres,
+		connect: func(cfg config.DBConfig) error {
+			if err := ConnectPostgresWithConfig(cfg.Name, cfg.URI, cfg.Pool); err != nil {
+				return err
+			}
+			for _, replica := range cfg.Replicas {
+				if err := ConnectPostgresReplica(cfg.Name, replica.URI, replica.Pool); err != nil {
+					// Do not leave the database half connected
+					if closeErr := ClosePostgres(cfg.Name); closeErr != nil {
+						log.Printf("Warning: could not close %s: %v", cfg.Name, closeErr)
+					}
+					return err
+				}
+			}
+			if len(cfg.Replicas) > 0 {
+				SetMaxReplicaLag(cfg.Name, cfg.MaxReplicaLag)
+			}
+			return nil
+		},
+		close:      ClosePostgres,
+		introspect: GetPostgresSchema,
+		query:      QueryPostgresGuarded,
+		execute:    ExecuteGuarded,
+	}
+}
+
+func mysqlDriver() *sqlDriver {
+	return &sqlDriver{
+		dialect: llm.DialectMySQL,
+		connect: func(cfg config.DBConfig) error {
+			warnReplicasIgnored(cfg)
+			return ConnectMySQLWithConfig(cfg.Name, cfg.URI, cfg.Pool)
+		},
+		close:      CloseMySQL,
+		introspect: GetMySQLSchema,
+		query:      QueryMySQLGuarded,
+		execute:    ExecuteMySQLGuarded,
+	}
+}
+
+func sqliteDriver() *sqlDriver {
+	return &sqlDriver{
+		dialect: llm.DialectSQLite,
+		connect: func(cfg config.DBConfig) error {
+			warnReplicasIgnored(cfg)
+			return ConnectSQLiteWithConfig(cfg.Name, cfg.URI, cfg.Pool)
+		},
+		close:      CloseSQLite,
+		introspect: GetSQLiteSchema,
+		query:      QuerySQLiteGuarded,
+		execute:    ExecuteSQLiteGuarded,
+	}
+}
+
+// warnReplicasIgnored logs that the replicas of a database without replica support are not used
+func warnReplicasIgnored(cfg config.DBConfig) {
+	if len(cfg.Replicas) > 0 {
+		log.Printf("Warning: replicas of %s are ignored, read replicas are supported for Postgres only", cfg.Name)
+	}
+}
+
+func (d *sqlDriver) Connect(cfg config.DBConfig) error { return d.connect(cfg) }
+
+func (d *sqlDriver) Close(name string) error { return d.close(name) }
+
+func (d *sqlDriver) Introspect(ctx context.Context, name string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return d.introspect(name)
+}
+
+func (d *sqlDriver) TemplateKey() string { return string(d.dialect) }
+
+func (d *sqlDriver) QueryType() llm.QueryType { return llm.QueryTypeSQL }
+
+// Validate parses a generated SQL query, validates it and its arguments for the
+// dialect, and converts the arguments to the values to bind
+func (d *sqlDriver) Validate(cfg config.DBConfig, query string, opts ExecOptions) (*Statement, error) {
+	sqlQuery, err := llm.ParseSQLQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if err := llm.ValidateSQLDialect(sqlQuery.Query, d.dialect); err != nil {
+		return nil, err
+	}
+	if err := llm.ValidateSQLArgsDialect(*sqlQuery, d.dialect); err != nil {
+		return nil, err
+	}
+	if err := checkArgColumns(cfg.Name, sqlQuery.Args); err != nil {
+		return nil, err
+	}
+	values, err := sqlQuery.Values()
+	if err != nil {
+		return nil, err
+	}
+	return &Statement{
+		Query:    sqlQuery.Query,
+		Args:     sqlQuery.Args,
+		Values:   values,
+		Pageable: strings.HasPrefix(strings.ToLower(strings.TrimSpace(sqlQuery.Query)), "select"),
+	}, nil
+}
+
+// Execute runs one page of a SELECT query, or a command that returns no rows, under
+// opts.Guard. Commands return a single row with the number of rows affected.
+func (d *sqlDriver) Execute(ctx context.Context, cfg config.DBConfig, stmt *Statement, opts ExecOptions) (*ResultSet, error) {
+	if !stmt.Pageable {
+		rowsAffected, err := d.execute(ctx, cfg.Name, stmt.Query, opts.Guard, stmt.Values...)
+		if err != nil {
+			return nil, err
+		}
+		return NewResultSet([]map[string]interface{}{{"rows_affected": rowsAffected}}), nil
+	}
+
+	query, args := d.pageQuery(stmt, opts.Page)
+	return d.query(ctx, cfg.Name, query, opts.Page.size(), opts.Guard, args...)
+}
+
+// pageQuery limits a SELECT query to a page in the database. Offset pages add LIMIT and
+// OFFSET to the query itself, so its ORDER BY applies: MariaDB ignores the order of a
+// derived table. Queries with their own LIMIT, and keyset pages, are wrapped in a
+// subquery ordered by the page key instead. The key keeps the direction the query
+// orders it by, and must be unique: rows that tie on the key at a page boundary are skipped.
+func (d *sqlDriver) pageQuery(stmt *Statement, p Page) (string, []interface{}) {
+	args := append([]interface{}(nil), stmt.Values...)
+	query := strings.TrimRight(strings.TrimSpace(stmt.Query), ";")
+	if p.Key == "" && !orderEndPattern.MatchString(maskSQL(query, d.dialect)) {
+		// a newline ends a trailing -- comment of the query
+		paged := fmt.Sprintf("%s\nLIMIT %d", query, p.size()+1)
+		if p.Offset > 0 {
+			paged += fmt.Sprintf(" OFFSET %d", p.Offset)
+		}
+		return paged, args
+	}
+
+	paged := "SELECT * FROM (" + query + "\n) AS prompterdb_page"
+	if p.Key != "" {
+		key := d.dialect.QuoteIdentifier(p.Key)
+		op, order := ">", ""
+		if orderedDescending(query, p.Key, d.dialect) {
+			op, order = "<", " DESC"
+		}
+		if p.After != nil {
+			args = append(args, p.After)
+			paged += fmt.Sprintf(" WHERE %s %s %s", key, op, d.dialect.Placeholder(len(args)))
+		}
+		paged += " ORDER BY " + key + order
+	}
+	paged += fmt.Sprintf(" LIMIT %d", p.size()+1)
+	if p.Key == "" && p.Offset > 0 {
+		paged += fmt.Sprintf(" OFFSET %d", p.Offset)
+	}
+	return paged, args
+}
+
+var (
+	orderByPattern   = regexp.MustCompile(`\border\s+by\b`)
+	orderEndPattern  = regexp.MustCompile(`\b(limit|offset|fetch|for)\b`)
+	identifierQuotes = "\"`[]"
+)
+
+// orderedDescending reports whether the top-level ORDER BY of a query sorts by key descending
+func orderedDescending(query, key string, dialect llm.SQLDialect) bool {
+	masked := maskSQL(query, dialect)
+	matches := orderByPattern.FindAllStringIndex(masked, -1)
+	if len(matches) == 0 {
+		return false
+	}
+	start := matches[len(matches)-1][1]
+	end := len(query)
+	if loc := orderEndPattern.FindStringIndex(masked[start:]); loc != nil {
+		end = start + loc[0]
+	}
+
+	for from := start; from < end; {
+		to := strings.IndexByte(masked[from:end], ',')
+		if to < 0 {
+			to = end
+		} else {
+			to += from
+		}
+		fields := strings.Fields(query[from:to])
+		if len(fields) > 0 {
+			column := strings.Trim(fields[0], identifierQuotes)
+			if i := strings.LastIndexByte(column, '.'); i >= 0 {
+				column = strings.Trim(column[i+1:], identifierQuotes)
+			}
+			if strings.EqualFold(column, key) {
+				return len(fields) > 1 && strings.EqualFold(fields[1], "desc")
+			}
+		}
+		from = to + 1
+	}
+	return false
+}
+
+// maskSQL returns a lowercase copy of a query of the same length in which quoted
+// literals, comments and parenthesized expressions are blanked out, so clauses of
+// the top-level statement can be found by position. MySQL strings may escape quotes
+// with a backslash.
+func maskSQL(query string, dialect llm.SQLDialect) string {
+	b := []byte(query)
+	depth := 0
+	for i := 0; i < len(b); i++ {
+		switch c := b[i]; {
+		case 'A' <= c && c <= 'Z' && depth == 0:
+			b[i] = c + 'a' - 'A'
+		case c == '\'' || c == '"' || c == '`':
+			j := i + 1
+			for j < len(b) && b[j] != c {
+				if b[j] == '\\' && dialect == llm.DialectMySQL {
+					j++
+				}
+				j++
+			}
+			blank(b, i, j+1)
+			i = j
+		case c == '-' && i+1 < len(b) && b[i+1] == '-':
+			j := i
+			for j < len(b) && b[j] != '\n' {
+				j++
+			}
+			blank(b, i, j)
+			i = j
+		case c == '/' && i+1 < len(b) && b[i+1] == '*':
+			j := strings.Index(string(b[i+2:]), "*/")
+			if j < 0 {
+				j = len(b)
+			} else {
+				j += i + 4
+			}
+			blank(b, i, j)
+			i = j - 1
+		case c == '(':
+			depth++
+			b[i] = ' '
+		case c == ')':
+			depth--
+			b[i] = ' '
+		case depth > 0:
+			b[i] = ' '
+		}
+	}
+	return string(b)
+}
+
+// blank replaces b[from:to] with spaces, clamped to the length of b
+func blank(b []byte, from, to int) {
+	for i := from; i < to && i < len(b); i++ {
+		b[i] = ' '
+	}
+}
+
+// checkArgColumns validates bound arguments against the types of the columns they refer to.
+// Arguments whose column cannot be resolved, e.g. because the model used an alias, are skipped.
+func checkArgColumns(dbName string, args []llm.QueryArg) error {
+	for i, arg := range args {
+		table, column, ok := strings.Cut(arg.Column, ".")
+		if !ok {
+			continue
+		}
+		goType, err := GetColumnType(dbName, table, column)
+		if err != nil {
+			continue
+		}
+		if err := arg.CheckType(goType); err != nil {
+			return fmt.Errorf("argument $%d: %w", i+1, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrQueryTooExpensive is returned when the planner's estimated cost of a query exceeds QueryGuard.MaxCost
+var ErrQueryTooExpensive = errors.New("query exceeds the maximum estimated cost")
+
+// QueryGuard holds the server-side limits a generated statement runs under. The
+// settings are applied with SET LOCAL, so they last for the statement's transaction
+// only. Zero values leave the session's setting unchanged.
+type QueryGuard struct {
+	StatementTimeout         time.Duration
+	IdleInTransactionTimeout time.Duration
+	WorkMem                  string // memory per sort or hash operation, e.g. "64MB"
+	// ReadOnly runs every statement in a read-only transaction, so writes fail.
+	// SELECT queries always run read-only.
+	ReadOnly bool
+	// MaxCost rejects statements whose EXPLAIN total cost is higher, before they run.
+	// 0 disables the check.
+	MaxCost float64
+}
+
+// DefaultQueryGuard returns the guard used for generated SQL unless another one is configured
+func DefaultQueryGuard() QueryGuard {
+	return QueryGuard{
+		StatementTimeout:         30 * time.Second,
+		IdleInTransactionTimeout: 10 * time.Second,
+	}
+}
+
+// settings returns the configuration parameters set by the guard
+func (g QueryGuard) settings() [][2]string {
+	var settings [][2]string
+	if g.StatementTimeout > 0 {
+		settings = append(settings, [2]string{"statement_timeout", strconv.FormatInt(g.StatementTimeout.Milliseconds(), 10)})
+	}
+	if g.IdleInTransactionTimeout > 0 {
+		settings = append(settings, [2]string{"idle_in_transaction_session_timeout", strconv.FormatInt(g.IdleInTransactionTimeout.Milliseconds(), 10)})
+	}
+	if g.WorkMem != "" {
+		settings = append(settings, [2]string{"work_mem", g.WorkMem})
+	}
+	return settings
+}
+
+// clientTimeout is the client-side deadline for a guarded statement, a little
+// longer than the server-side timeout so the server reports the cancellation
+func (g QueryGuard) clientTimeout() time.Duration {
+	if g.StatementTimeout+5*time.Second > 30*time.Second {
+		return g.StatementTimeout + 5*time.Second
+	}
+	return 30 * time.Second
+}
+
+// beginGuarded starts a transaction on the named pool with the guard's settings,
+// and checks the estimated cost of the statement
+func beginGuarded(ctx context.Context, name, statement string, guard QueryGuard, readOnly bool, args []interface{}) (pgx.Tx, error) {
+	if name == "" {
+		return nil, errors.New("connection name cannot be empty")
+	}
+	if statement == "" {
+		return nil, errors.New("query cannot be empty")
+	}
+
+	// read-only statements may run on a replica
+	var pool *pgxpool.Pool
+	var err error
+	if readOnly {
+		pool, err = readPool(ctx, name)
+	} else {
+		pool, err = primaryPool(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	txOptions := pgx.TxOptions{}
+	if readOnly || guard.ReadOnly {
+		txOptions.AccessMode = pgx.ReadOnly
+	}
+	tx, err := pool.BeginTx(ctx, txOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	for _, setting := range guard.settings() {
+		// set_config(..., true) is SET LOCAL with a bound value
+		if _, err := tx.Exec(ctx, "SELECT set_config($1, $2, true)", setting[0], setting[1]); err != nil {
+			_ = tx.Rollback(ctx)
+			return nil, fmt.Errorf("failed to set %s: %w", setting[0], err)
+		}
+	}
+
+	if guard.MaxCost > 0 {
+		cost, err := explainCost(ctx, tx, statement, args)
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return nil, err
+		}
+		if cost > guard.MaxCost {
+			_ = tx.Rollback(ctx)
+			return nil, fmt.Errorf("%w: estimated cost %.0f is above %.0f", ErrQueryTooExpensive, cost, guard.MaxCost)
+		}
+	}
+	return tx, nil
+}
+
+// explainCost returns the planner's estimated total cost of a statement without running it
+func explainCost(ctx context.Context, tx pgx.Tx, statement string, args []interface{}) (float64, error) {
+	var plan []byte
+	if err := tx.QueryRow(ctx, "EXPLAIN (FORMAT JSON) "+statement, args...).Scan(&plan); err != nil {
+		return 0, fmt.Errorf("failed to explain query: %w", err)
+	}
+	var plans []struct {
+		Plan struct {
+			TotalCost float64 `json:"Total Cost"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal(plan, &plans); err != nil {
+		return 0, fmt.Errorf("failed to read query plan: %w", err)
+	}
+	if len(plans) == 0 {
+		return 0, errors.New("failed to read query plan: EXPLAIN returned no plan")
+	}
+	return plans[0].Plan.TotalCost, nil
+}
+
+// ExplainCost returns the planner's estimated total cost of a statement on the named database
+func ExplainCost(name, statement string, args ...interface{}) (float64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := beginGuarded(ctx, name, statement, QueryGuard{}, true, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+	return explainCost(ctx, tx, statement, args)
+}
+
+// QueryPostgresGuarded executes a query in a read-only transaction under guard and
+// returns at most limit rows with their column types. A limit of 0 uses RowLimit.
+func QueryPostgresGuarded(ctx context.Context, name, query string, limit int, guard QueryGuard, args ...interface{}) (*ResultSet, error) {
+	if limit <= 0 {
+		limit = RowLimit()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, guard.clientTimeout())
+	defer cancel()
+
+	tx, err := beginGuarded(ctx, name, query, guard, true, args)
+	if err != nil {
+		return nil, err
+	}
+	// nothing to commit; rolling back also ends the SET LOCAL settings
+	defer tx.Rollback(context.Background())
+
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %w", err)
+	}
+	it := &pgRowIterator{
+		rows:    rows,
+		columns: postgresColumns(rows.FieldDescriptions(), tx.Conn().TypeMap()),
+		cancel:  cancel,
+	}
+	return collectResultSet(it, limit)
+}
+
+// ExecuteGuarded executes a SQL command that doesn't return rows in a transaction under guard.
+// The transaction is committed when the command succeeds.
+func ExecuteGuarded(ctx context.Context, name, command string, guard QueryGuard, args ...interface{}) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, guard.clientTimeout())
+	defer cancel()
+
+	tx, err := beginGuarded(ctx, name, command, guard, false, args)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(context.Background())
+
+	tag, err := tx.Exec(ctx, command, args...)
+	if err != nil {
+		return 0, fmt.Errorf("execution failed: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
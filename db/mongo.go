@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
 	"sync"
 	"time"
 
@@ -31,6 +32,12 @@ var (
 )
 
 func ConnectMongo(name, uri string) error {
+	return ConnectMongoWithConfig(name, uri, config.PoolConfig{})
+}
+
+// ConnectMongoWithConfig connects to MongoDB with the given pool settings.
+// Settings left at zero use the defaults.
+func ConnectMongoWithConfig(name, uri string, poolCfg config.PoolConfig) error {
 	if name == "" {
 		return errors.New("connection name cannot be empty")
 	}
@@ -45,18 +52,17 @@ func ConnectMongo(name, uri string) error {
 		return nil
 	}
 
-	clientOptions := options.Client().ApplyURI(uri).
-		SetMaxPoolSize(maxPoolSize).
-		SetMinPoolSize(minPoolSize).
-		SetServerSelectionTimeout(defaultTimeout).
-		SetConnectTimeout(defaultTimeout)
+	clientOptions, err := mongoClientOptions(uri, poolCfg)
+	if err != nil {
+		return err
+	}
 
 	client, err := mongo.Connect(context.Background(), clientOptions)
 	if err != nil {
 		return fmt.Errorf("failed to connect to MongoDB %s: %w", name, err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), durationOr(poolCfg.PingTimeout, defaultPingTimeout))
 	defer cancel()
 	if err := client.Ping(ctx, readpref.Primary()); err != nil {
 		_ = client.Disconnect(ctx)
@@ -70,6 +76,47 @@ func ConnectMongo(name, uri string) error {
 	return nil
 }
 
+// mongoClientOptions builds the client options for a URI and pool settings
+func mongoClientOptions(uri string, poolCfg config.PoolConfig) (*options.ClientOptions, error) {
+	maxPool, minPool := uint64(maxPoolSize), uint64(minPoolSize)
+	if poolCfg.MaxConns > 0 {
+		maxPool = uint64(poolCfg.MaxConns)
+	}
+	if poolCfg.MinConns > 0 {
+		minPool = uint64(poolCfg.MinConns)
+	} else if minPool > maxPool {
+		minPool = maxPool
+	}
+	if minPool > maxPool {
+		return nil, fmt.Errorf("MinConns (%d) cannot exceed MaxConns (%d)", minPool, maxPool)
+	}
+
+	clientOptions := options.Client().ApplyURI(uri).
+		SetMaxPoolSize(maxPool).
+		SetMinPoolSize(minPool).
+		SetServerSelectionTimeout(defaultTimeout).
+		SetConnectTimeout(durationOr(poolCfg.ConnectTimeout, defaultTimeout))
+	if poolCfg.MaxConnIdleTime > 0 {
+		clientOptions.SetMaxConnIdleTime(poolCfg.MaxConnIdleTime)
+	}
+	if poolCfg.StatementTimeout > 0 {
+		clientOptions.SetTimeout(poolCfg.StatementTimeout)
+	}
+	if poolCfg.ApplicationName != "" {
+		clientOptions.SetAppName(poolCfg.ApplicationName)
+	}
+	if poolCfg.TLS != nil {
+		clientOptions.SetTLSConfig(poolCfg.TLS.Clone())
+	}
+	if len(poolCfg.SearchPath) > 0 {
+		log.Printf("Warning: search_path has no effect on MongoDB connections")
+	}
+	if err := clientOptions.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid MongoDB options: %w", err)
+	}
+	return clientOptions, nil
+}
+
 func CloseMongo(name string) error {
 	mongoMu.Lock()
 	defer mongoMu.Unlock()
@@ -88,6 +135,7 @@ func CloseMongo(name string) error {
 
 	delete(MongoClients, name)
 	delete(MongoDBs, name)
+	delete(mongoReadPrefs, name)
 	return nil
 }
 
@@ -104,44 +152,57 @@ func CloseAllMongo() error {
 		cancel()
 		delete(MongoClients, name)
 		delete(MongoDBs, name)
+		delete(mongoReadPrefs, name)
 	}
 	return lastErr
 }
 
-func QueryMongo(name, dbName, collection string, filter bson.M) ([]map[string]interface{}, error) {
-	if name == "" {
-		return nil, errors.New("connection name cannot be empty")
+// FindOptions are the optional settings of a MongoDB find operation
+type FindOptions struct {
+	Projection bson.M
+	Sort       bson.D // ordered sort specification
+	Limit      int64  // 0 means no limit
+	Skip       int64
+	Hint       interface{} // index name or ordered index key document
+	Collation  *options.Collation
+}
+
+// toDriverOptions converts the find options to the driver's options
+func (o *FindOptions) toDriverOptions() *options.FindOptions {
+	findOpts := options.Find()
+	if o == nil {
+		return findOpts
 	}
-	if dbName == "" {
-		return nil, ErrInvalidDBName
+	if len(o.Projection) > 0 {
+		findOpts.SetProjection(o.Projection)
 	}
-	if collection == "" {
-		return nil, ErrInvalidCollection
+	if len(o.Sort) > 0 {
+		findOpts.SetSort(o.Sort)
 	}
-
-	mongoMu.RLock()
-	client, ok := MongoClients[name]
-	mongoMu.RUnlock()
-	if !ok {
-		return nil, fmt.Errorf("%w: %s", ErrClientNotFound, name)
+	if o.Limit > 0 {
+		findOpts.SetLimit(o.Limit)
 	}
+	if o.Skip > 0 {
+		findOpts.SetSkip(o.Skip)
+	}
+	if o.Hint != nil {
+		findOpts.SetHint(o.Hint)
+	}
+	if o.Collation != nil {
+		findOpts.SetCollation(o.Collation)
+	}
+	return findOpts
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	coll := client.Database(dbName).Collection(collection)
-	cur, err := coll.Find(ctx, filter)
+// QueryMongo runs a find on a collection. opts may be nil.
+// At most RowLimit documents are returned; use QueryMongoLimit to learn whether documents were dropped.
+func QueryMongo(name, dbName, collection string, filter bson.M, opts *FindOptions) ([]map[string]interface{}, error) {
+	results, truncated, err := QueryMongoLimit(name, dbName, collection, filter, opts, 0)
 	if err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return []map[string]interface{}{}, nil
-		}
-		return nil, fmt.Errorf("MongoDB find failed: %w", err)
+		return nil, err
 	}
-	defer cur.Close(ctx)
-
-	var results []map[string]interface{}
-	if err := cur.All(ctx, &results); err != nil {
-		return nil, fmt.Errorf("failed to decode MongoDB results: %w", err)
+	if truncated {
+		log.Printf("Warning: find on %s.%s matched more than %d documents, the result was truncated", dbName, collection, RowLimit())
 	}
 	return results, nil
 }
@@ -221,9 +282,194 @@ func DeleteMongo(name, dbName, collection string, filter map[string]interface{})
 	}, nil
 }
 
-func AggregateMongo(name, dbName, collection string, pipeline []bson.M) ([]map[string]interface{}, error) {
-	if name == "" || dbName == "" || collection == "" {
-		return nil, errors.New("invalid aggregate parameters")
+// AggregateMongo runs an aggregation pipeline, given as []bson.M, []bson.D or mongo.Pipeline.
+// At most RowLimit documents are returned.
+func AggregateMongo(name, dbName, collection string, pipeline interface{}) ([]map[string]interface{}, error) {
+	results, truncated, err := AggregateMongoLimit(name, dbName, collection, pipeline, 0)
+	if err != nil {
+		return nil, err
+	}
+	if truncated {
+		log.Printf("Warning: aggregate on %s.%s produced more than %d documents, the result was truncated", dbName, collection, RowLimit())
+	}
+	return results, nil
+}
+
+// FindOneMongo returns the first document matching filter, or no rows if none matches.
+// The limit of opts is ignored.
+func FindOneMongo(name, dbName, collection string, filter bson.M, opts *FindOptions) ([]map[string]interface{}, error) {
+	coll, err := mongoReadCollection(name, dbName, collection)
+	if err != nil {
+		return nil, err
+	}
+
+	findOneOpts := options.FindOne()
+	if opts != nil {
+		if len(opts.Projection) > 0 {
+			findOneOpts.SetProjection(opts.Projection)
+		}
+		if len(opts.Sort) > 0 {
+			findOneOpts.SetSort(opts.Sort)
+		}
+		if opts.Skip > 0 {
+			findOneOpts.SetSkip(opts.Skip)
+		}
+		if opts.Hint != nil {
+			findOneOpts.SetHint(opts.Hint)
+		}
+		if opts.Collation != nil {
+			findOneOpts.SetCollation(opts.Collation)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var doc map[string]interface{}
+	if err := coll.FindOne(ctx, filter, findOneOpts).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return []map[string]interface{}{}, nil
+		}
+		return nil, fmt.Errorf("MongoDB findOne failed: %w", err)
+	}
+	return []map[string]interface{}{normalizeMap(doc)}, nil
+}
+
+// CountMongo counts the documents matching filter
+func CountMongo(name, dbName, collection string, filter bson.M) ([]map[string]interface{}, error) {
+	coll, err := mongoReadCollection(name, dbName, collection)
+	if err != nil {
+		return nil, err
+	}
+	if filter == nil {
+		filter = bson.M{}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	count, err := coll.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("MongoDB countDocuments failed: %w", err)
+	}
+	return []map[string]interface{}{{"count": count}}, nil
+}
+
+// EstimatedCountMongo returns the collection's document count from its metadata
+func EstimatedCountMongo(name, dbName, collection string) ([]map[string]interface{}, error) {
+	coll, err := mongoReadCollection(name, dbName, collection)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	count, err := coll.EstimatedDocumentCount(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("MongoDB estimatedDocumentCount failed: %w", err)
+	}
+	return []map[string]interface{}{{"count": count}}, nil
+}
+
+// DistinctMongo returns the distinct values of field among the documents matching filter,
+// one row per value
+func DistinctMongo(name, dbName, collection, field string, filter bson.M) ([]map[string]interface{}, error) {
+	if field == "" {
+		return nil, errors.New("distinct field cannot be empty")
+	}
+	coll, err := mongoReadCollection(name, dbName, collection)
+	if err != nil {
+		return nil, err
+	}
+	if filter == nil {
+		filter = bson.M{}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	values, err := coll.Distinct(ctx, field, filter)
+	if err != nil {
+		return nil, fmt.Errorf("MongoDB distinct failed: %w", err)
+	}
+
+	results := make([]map[string]interface{}, len(values))
+	for i, v := range values {
+		results[i] = map[string]interface{}{field: NormalizeMongoValue(v)}
+	}
+	return results, nil
+}
+
+// InsertManyMongo inserts several documents in order
+func InsertManyMongo(name, dbName, collection string, documents []map[string]interface{}) ([]map[string]interface{}, error) {
+	if len(documents) == 0 {
+		return nil, errors.New("no documents to insert")
+	}
+	coll, err := mongoCollection(name, dbName, collection)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make([]interface{}, len(documents))
+	for i, doc := range documents {
+		docs[i] = doc
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	res, err := coll.InsertMany(ctx, docs, options.InsertMany().SetOrdered(true))
+	if err != nil {
+		return nil, fmt.Errorf("MongoDB insertMany failed: %w", err)
+	}
+
+	return []map[string]interface{}{
+		{"status": "success", "operation": "insertMany", "inserted": len(res.InsertedIDs)},
+	}, nil
+}
+
+// BulkWriteMongo runs an ordered bulk write; it stops at the first failing operation
+func BulkWriteMongo(name, dbName, collection string, models []mongo.WriteModel) ([]map[string]interface{}, error) {
+	if len(models) == 0 {
+		return nil, errors.New("no bulk write operations")
+	}
+	coll, err := mongoCollection(name, dbName, collection)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	res, err := coll.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(true))
+	if err != nil {
+		return nil, fmt.Errorf("MongoDB bulkWrite failed: %w", err)
+	}
+
+	return []map[string]interface{}{
+		{
+			"status":    "success",
+			"operation": "bulkWrite",
+			"inserted":  res.InsertedCount,
+			"matched":   res.MatchedCount,
+			"modified":  res.ModifiedCount,
+			"upserted":  res.UpsertedCount,
+			"deleted":   res.DeletedCount,
+		},
+	}, nil
+}
+
+// mongoCollection validates the parameters and returns the collection handle
+func mongoCollection(name, dbName, collection string) (*mongo.Collection, error) {
+	if name == "" {
+		return nil, errors.New("connection name cannot be empty")
+	}
+	if dbName == "" {
+		return nil, ErrInvalidDBName
+	}
+	if collection == "" {
+		return nil, ErrInvalidCollection
 	}
 
 	mongoMu.RLock()
@@ -232,19 +478,22 @@ func AggregateMongo(name, dbName, collection string, pipeline []bson.M) ([]map[s
 	if !ok {
 		return nil, fmt.Errorf("%w: %s", ErrClientNotFound, name)
 	}
+	return client.Database(dbName).Collection(collection), nil
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	cursor, err := client.Database(dbName).Collection(collection).Aggregate(ctx, pipeline)
+// mongoReadCollection returns the collection handle for reads, using the
+// connection's read preference when one is set
+func mongoReadCollection(name, dbName, collection string) (*mongo.Collection, error) {
+	coll, err := mongoCollection(name, dbName, collection)
 	if err != nil {
-		return nil, fmt.Errorf("MongoDB aggregate failed: %w", err)
+		return nil, err
 	}
-	defer cursor.Close(ctx)
 
-	var results []map[string]interface{}
-	if err := cursor.All(ctx, &results); err != nil {
-		return nil, fmt.Errorf("failed to decode MongoDB results: %w", err)
+	mongoMu.RLock()
+	rp, ok := mongoReadPrefs[name]
+	mongoMu.RUnlock()
+	if !ok {
+		return coll, nil
 	}
-	return results, nil
+	return coll.Database().Collection(collection, options.Collection().SetReadPreference(rp)), nil
 }
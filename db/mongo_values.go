@@ -0,0 +1,70 @@
+package db
+
+import (
+	"encoding/base64"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// NormalizeMongoValue converts BSON values into JSON-friendly Go values:
+// ObjectIDs become hex strings, dates RFC 3339 strings in UTC, decimals
+// strings, and nested documents and arrays are converted recursively
+func NormalizeMongoValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case primitive.ObjectID:
+		return value.Hex()
+	case primitive.DateTime:
+		return value.Time().UTC().Format(time.RFC3339Nano)
+	case time.Time:
+		return value.UTC().Format(time.RFC3339Nano)
+	case primitive.Timestamp:
+		return time.Unix(int64(value.T), 0).UTC().Format(time.RFC3339)
+	case primitive.Decimal128:
+		return value.String()
+	case primitive.Binary:
+		return base64.StdEncoding.EncodeToString(value.Data)
+	case primitive.Regex:
+		return value.String()
+	case primitive.Null, primitive.Undefined:
+		return nil
+	case bson.M:
+		return normalizeMap(value)
+	case map[string]interface{}:
+		return normalizeMap(value)
+	case bson.D:
+		m := make(map[string]interface{}, len(value))
+		for _, e := range value {
+			m[e.Key] = NormalizeMongoValue(e.Value)
+		}
+		return m
+	case bson.A:
+		return normalizeSlice(value)
+	case []interface{}:
+		return normalizeSlice(value)
+	}
+	return v
+}
+
+// normalizeDocuments normalizes every value of the documents in place
+func normalizeDocuments(docs []map[string]interface{}) []map[string]interface{} {
+	for i, doc := range docs {
+		docs[i] = normalizeMap(doc)
+	}
+	return docs
+}
+
+func normalizeMap(m map[string]interface{}) map[string]interface{} {
+	for k, v := range m {
+		m[k] = NormalizeMongoValue(v)
+	}
+	return m
+}
+
+func normalizeSlice(values []interface{}) []interface{} {
+	for i, v := range values {
+		values[i] = NormalizeMongoValue(v)
+	}
+	return values
+}
@@ -0,0 +1,456 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/vijaylingoju/prompterdb/config"
+)
+
+var (
+	// mysqlDBs holds the MySQL connection pools
+	mysqlDBs   = make(map[string]*sql.DB)
+	mysqlDBsMu sync.RWMutex
+
+	// ErrMySQLNotFound is returned when a MySQL connection is not found
+	ErrMySQLNotFound = errors.New("mysql connection not found")
+)
+
+// ConnectMySQL establishes a connection to MySQL or MariaDB with the given name and URI.
+// The URI is a driver DSN such as user:pass@tcp(host:3306)/dbname, or a mysql:// URL.
+func ConnectMySQL(name, uri string) error {
+	return ConnectMySQLWithConfig(name, uri, config.PoolConfig{})
+}
+
+// ConnectMySQLWithConfig establishes a connection to MySQL with the given pool and
+// session settings. Settings left at zero use the defaults.
+func ConnectMySQLWithConfig(name, uri string, poolCfg config.PoolConfig) error {
+	if name == "" {
+		return errors.New("connection name cannot be empty")
+	}
+
+	mysqlDBsMu.Lock()
+	defer mysqlDBsMu.Unlock()
+
+	if _, exists := mysqlDBs[name]; exists {
+		return nil // Already connected
+	}
+
+	cfg, err := mysqlConfig(uri, poolCfg)
+	if err != nil {
+		return err
+	}
+	conn, err := openMySQL(cfg, poolCfg)
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlUnknownVariable && cfg.Params["max_execution_time"] != "" {
+		// MariaDB names the statement timeout max_statement_time, in seconds
+		delete(cfg.Params, "max_execution_time")
+		cfg.Params["max_statement_time"] = strconv.FormatFloat(poolCfg.StatementTimeout.Seconds(), 'f', -1, 64)
+		conn, err = openMySQL(cfg, poolCfg)
+	}
+	if err != nil {
+		return err
+	}
+
+	mysqlDBs[name] = conn
+	return nil
+}
+
+// mysqlUnknownVariable is the MySQL error number for an unknown system variable
+const mysqlUnknownVariable = 1193
+
+// openMySQL opens a connection pool and verifies it with a ping
+func openMySQL(cfg *mysql.Config, poolCfg config.PoolConfig) (*sql.DB, error) {
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MySQL configuration: %w", err)
+	}
+
+	conn := sql.OpenDB(connector)
+	maxConns := int(defaultMaxConns)
+	if poolCfg.MaxConns > 0 {
+		maxConns = int(poolCfg.MaxConns)
+	}
+	idleConns := min(int(defaultMinConns), maxConns)
+	if poolCfg.MinConns > 0 {
+		idleConns = int(poolCfg.MinConns)
+	}
+	conn.SetMaxOpenConns(maxConns)
+	conn.SetMaxIdleConns(idleConns)
+	conn.SetConnMaxLifetime(durationOr(poolCfg.MaxConnLifetime, defaultMaxConnLifetime))
+	conn.SetConnMaxIdleTime(durationOr(poolCfg.MaxConnIdleTime, defaultMaxConnIdleTime))
+
+	// Verify the connection
+	ctx, cancel := context.WithTimeout(context.Background(), durationOr(poolCfg.PingTimeout, defaultPingTimeout))
+	defer cancel()
+
+	if err := conn.PingContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to ping MySQL server: %w", err)
+	}
+	return conn, nil
+}
+
+// mysqlConfig parses a DSN or mysql:// URL and applies the pool settings to it
+func mysqlConfig(uri string, poolCfg config.PoolConfig) (*mysql.Config, error) {
+	dsn := uri
+	if strings.HasPrefix(uri, "mysql://") {
+		u, err := url.Parse(uri)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse MySQL connection string: %w", err)
+		}
+		host := u.Host
+		if u.Port() == "" {
+			host += ":3306"
+		}
+		password, _ := u.User.Password()
+		dsn = fmt.Sprintf("%s:%s@tcp(%s)%s", u.User.Username(), password, host, u.Path)
+		if u.RawQuery != "" {
+			dsn += "?" + u.RawQuery
+		}
+	}
+
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse MySQL connection string: %w", err)
+	}
+	cfg.ParseTime = true
+	if cfg.Params == nil {
+		cfg.Params = map[string]string{}
+	}
+
+	if poolCfg.ConnectTimeout > 0 {
+		cfg.Timeout = poolCfg.ConnectTimeout
+	}
+	if poolCfg.StatementTimeout > 0 {
+		// MySQL limits SELECT statements only; ConnectMySQLWithConfig switches to MariaDB's variable
+		cfg.Params["max_execution_time"] = strconv.FormatInt(poolCfg.StatementTimeout.Milliseconds(), 10)
+	}
+	if poolCfg.ApplicationName != "" {
+		cfg.ConnectionAttributes = "program_name:" + poolCfg.ApplicationName
+	}
+	if poolCfg.TLS != nil {
+		cfg.TLS = poolCfg.TLS.Clone()
+		if cfg.TLS.ServerName == "" && !cfg.TLS.InsecureSkipVerify {
+			cfg.TLS.ServerName, _, _ = strings.Cut(cfg.Addr, ":")
+		}
+	}
+	if len(poolCfg.SearchPath) > 0 {
+		log.Printf("Warning: search_path has no effect on MySQL connections")
+	}
+	return cfg, nil
+}
+
+// CloseMySQL closes the MySQL connection with the given name
+func CloseMySQL(name string) error {
+	mysqlDBsMu.Lock()
+	defer mysqlDBsMu.Unlock()
+
+	conn, exists := mysqlDBs[name]
+	if !exists {
+		return nil // Already closed
+	}
+
+	delete(mysqlDBs, name)
+	return conn.Close()
+}
+
+// CloseAllMySQL closes all MySQL connections
+func CloseAllMySQL() error {
+	mysqlDBsMu.Lock()
+	defer mysqlDBsMu.Unlock()
+
+	var lastErr error
+	for name, conn := range mysqlDBs {
+		if err := conn.Close(); err != nil {
+			lastErr = fmt.Errorf("error closing MySQL connection %s: %w", name, err)
+		}
+		delete(mysqlDBs, name)
+	}
+	return lastErr
+}
+
+// mysqlDB returns the connection pool with the given name
+func mysqlDB(name string) (*sql.DB, error) {
+	if name == "" {
+		return nil, errors.New("connection name cannot be empty")
+	}
+
+	mysqlDBsMu.RLock()
+	conn, ok := mysqlDBs[name]
+	mysqlDBsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrMySQLNotFound, name)
+	}
+	return conn, nil
+}
+
+// StreamMySQL executes a query and returns an iterator over its rows.
+// args are bound to the ? placeholders of the query.
+func StreamMySQL(ctx context.Context, name, query string, args ...interface{}) (RowIterator, error) {
+	if query == "" {
+		return nil, errors.New("query cannot be empty")
+	}
+	conn, err := mysqlDB(name)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %w", err)
+	}
+	return newSQLRowIterator(rows, mysqlColumn, mysqlValue)
+}
+
+// QueryMySQL executes a query on the specified MySQL database.
+// At most RowLimit rows are returned.
+func QueryMySQL(name, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	rs, err := QueryMySQLResultSet(name, query, 0, args...)
+	if err != nil {
+		return nil, err
+	}
+	if rs.Truncated {
+		log.Printf("Warning: query on %s returned more than %d rows, the result was truncated", name, RowLimit())
+	}
+	return rs.Maps(), nil
+}
+
+// QueryMySQLResultSet executes a query and returns at most limit rows with
+// their column types. A limit of 0 uses RowLimit.
+func QueryMySQLResultSet(name, query string, limit int, args ...interface{}) (*ResultSet, error) {
+	if limit <= 0 {
+		limit = RowLimit()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	it, err := StreamMySQL(ctx, name, query, args...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	it.(*sqlRowIterator).cancel = cancel
+	return collectResultSet(it, limit)
+}
+
+// ExecuteMySQL executes a SQL command that doesn't return rows
+func ExecuteMySQL(name, command string, args ...interface{}) (int64, error) {
+	return ExecuteMySQLGuarded(context.Background(), name, command, QueryGuard{}, args...)
+}
+
+// QueryMySQLGuarded executes a query in a read-only transaction under guard and returns
+// at most limit rows. StatementTimeout, ReadOnly and MaxCost apply; the other limits are
+// PostgreSQL settings.
+func QueryMySQLGuarded(ctx context.Context, name, query string, limit int, guard QueryGuard, args ...interface{}) (*ResultSet, error) {
+	if limit <= 0 {
+		limit = RowLimit()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, guard.clientTimeout())
+	defer cancel()
+
+	tx, release, err := beginMySQLGuarded(ctx, name, query, guard, true, args)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %w", err)
+	}
+	it, err := newSQLRowIterator(rows, mysqlColumn, mysqlValue)
+	if err != nil {
+		return nil, err
+	}
+	it.cancel = cancel
+	return collectResultSet(it, limit)
+}
+
+// ExecuteMySQLGuarded executes a SQL command that doesn't return rows in a transaction
+// under guard. The transaction is committed when the command succeeds.
+func ExecuteMySQLGuarded(ctx context.Context, name, command string, guard QueryGuard, args ...interface{}) (int64, error) {
+	if command == "" {
+		return 0, errors.New("command cannot be empty")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, guard.clientTimeout())
+	defer cancel()
+
+	tx, release, err := beginMySQLGuarded(ctx, name, command, guard, false, args)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	res, err := tx.ExecContext(ctx, command, args...)
+	if err != nil {
+		return 0, fmt.Errorf("execution failed: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// beginMySQLGuarded starts a transaction with the guard's statement timeout on a dedicated
+// connection and checks the estimated cost of the statement. release rolls back the
+// transaction, if still open, and returns the connection to the pool.
+func beginMySQLGuarded(ctx context.Context, name, statement string, guard QueryGuard, readOnly bool, args []interface{}) (*sql.Tx, func(), error) {
+	if statement == "" {
+		return nil, nil, errors.New("query cannot be empty")
+	}
+	pool, err := mysqlDB(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	conn, err := pool.Conn(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+
+	timeoutVar := ""
+	if guard.StatementTimeout > 0 {
+		timeoutVar, err = setMySQLStatementTimeout(ctx, conn, guard.StatementTimeout)
+		if err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+	}
+
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{ReadOnly: readOnly || guard.ReadOnly})
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	release := func() {
+		_ = tx.Rollback()
+		if timeoutVar != "" {
+			resetCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			// the connection goes back to the pool, so restore the session default
+			if _, err := conn.ExecContext(resetCtx, "SET SESSION "+timeoutVar+" = DEFAULT"); err != nil {
+				// ErrBadConn makes database/sql discard the connection
+				_ = conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+			}
+		}
+		conn.Close()
+	}
+
+	if guard.MaxCost > 0 {
+		cost, ok, err := mysqlExplainCost(ctx, tx, statement, args)
+		if err != nil {
+			release()
+			return nil, nil, err
+		}
+		if !ok {
+			log.Printf("Warning: %s does not report a query cost, the cost limit is not applied", name)
+		} else if cost > guard.MaxCost {
+			release()
+			return nil, nil, fmt.Errorf("%w: estimated cost %.0f is above %.0f", ErrQueryTooExpensive, cost, guard.MaxCost)
+		}
+	}
+	return tx, release, nil
+}
+
+// setMySQLStatementTimeout limits the statements of a session and returns the variable
+// it set: max_execution_time on MySQL, which applies to SELECT, or max_statement_time on MariaDB
+func setMySQLStatementTimeout(ctx context.Context, conn *sql.Conn, timeout time.Duration) (string, error) {
+	if _, err := conn.ExecContext(ctx, "SET SESSION max_execution_time = ?", timeout.Milliseconds()); err == nil {
+		return "max_execution_time", nil
+	}
+	if _, err := conn.ExecContext(ctx, "SET SESSION max_statement_time = ?", timeout.Seconds()); err != nil {
+		return "", fmt.Errorf("failed to set statement timeout: %w", err)
+	}
+	return "max_statement_time", nil
+}
+
+// mysqlExplainCost returns the optimizer's estimated cost of a statement. ok is false
+// when the server's plan has no cost, as with MariaDB.
+func mysqlExplainCost(ctx context.Context, tx *sql.Tx, statement string, args []interface{}) (float64, bool, error) {
+	var plan string
+	if err := tx.QueryRowContext(ctx, "EXPLAIN FORMAT=JSON "+statement, args...).Scan(&plan); err != nil {
+		return 0, false, fmt.Errorf("failed to explain query: %w", err)
+	}
+	var parsed struct {
+		QueryBlock struct {
+			CostInfo struct {
+				QueryCost string `json:"query_cost"`
+			} `json:"cost_info"`
+		} `json:"query_block"`
+	}
+	if err := json.Unmarshal([]byte(plan), &parsed); err != nil {
+		return 0, false, fmt.Errorf("failed to read query plan: %w", err)
+	}
+	if parsed.QueryBlock.CostInfo.QueryCost == "" {
+		return 0, false, nil
+	}
+	cost, err := strconv.ParseFloat(parsed.QueryBlock.CostInfo.QueryCost, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read query cost: %w", err)
+	}
+	return cost, true, nil
+}
+
+// mysqlColumn describes a column of a MySQL result
+func mysqlColumn(t *sql.ColumnType) Column {
+	dbType := strings.ToLower(t.DatabaseTypeName())
+	return Column{Name: t.Name(), DBType: dbType, Type: mysqlLogicalType(dbType)}
+}
+
+// mysqlLogicalType maps a MySQL type name to its logical type
+func mysqlLogicalType(dbType string) LogicalType {
+	switch strings.TrimPrefix(dbType, "unsigned ") {
+	case "tinyint", "smallint", "mediumint", "int", "bigint", "decimal", "float", "double", "year":
+		return TypeNumber
+	case "date", "datetime", "timestamp", "time":
+		return TypeTime
+	case "json":
+		return TypeJSON
+	}
+	return TypeString
+}
+
+// mysqlValue converts a value scanned from MySQL. The text protocol returns most
+// values as bytes, so they are parsed according to the column type. Decimals are
+// kept as strings so no precision is lost.
+func mysqlValue(c Column, v interface{}) interface{} {
+	b, ok := v.([]byte)
+	if !ok {
+		return v
+	}
+	s := string(b)
+
+	switch strings.TrimPrefix(c.DBType, "unsigned ") {
+	case "tinyint", "smallint", "mediumint", "int", "bigint", "year":
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i
+		}
+		return s // unsigned values beyond int64
+	case "float", "double":
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	case "json":
+		var decoded interface{}
+		if err := json.Unmarshal(b, &decoded); err == nil {
+			return decoded
+		}
+	case "blob", "tinyblob", "mediumblob", "longblob", "binary", "varbinary", "bit", "geometry":
+		return b
+	}
+	return s
+}
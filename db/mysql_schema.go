@@ -0,0 +1,139 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vijaylingoju/prompterdb/cache"
+)
+
+// GetMySQLSchema fetches the schema of the connected MySQL database from information_schema
+func GetMySQLSchema(dbName string) (string, error) {
+	// Check cache first
+	if schema, ok := cache.GetCachedSchema(dbName); ok {
+		return schema, nil
+	}
+
+	conn, err := mysqlDB(dbName)
+	if err != nil {
+		return "", err
+	}
+
+	query := `
+        SELECT
+            c.table_name,
+            c.column_name,
+            c.data_type,
+            c.column_type,
+            c.is_nullable,
+            c.character_maximum_length,
+            c.numeric_precision,
+            c.numeric_scale,
+            c.column_default,
+            c.column_key = 'PRI' AS is_primary_key
+        FROM
+            information_schema.columns c
+            JOIN information_schema.tables t
+                ON c.table_name = t.table_name
+                AND c.table_schema = t.table_schema
+        WHERE
+            c.table_schema = DATABASE()
+            AND t.table_type = 'BASE TABLE'
+        ORDER BY
+            c.table_name,
+            c.ordinal_position
+    `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return "", fmt.Errorf("error querying schema: %w", err)
+	}
+	defer rows.Close()
+
+	tableSchemas := make(map[string][]SchemaInfo)
+	for rows.Next() {
+		var info SchemaInfo
+		var columnType string
+		var maxLength, precision, scale sql.NullInt64
+		var defaultVal sql.NullString
+
+		err := rows.Scan(
+			&info.TableName,
+			&info.ColumnName,
+			&info.DataType,
+			&columnType,
+			&info.IsNullable,
+			&maxLength,
+			&precision,
+			&scale,
+			&defaultVal,
+			&info.IsPrimaryKey,
+		)
+		if err != nil {
+			return "", fmt.Errorf("error scanning schema row: %w", err)
+		}
+
+		info.DataType = strings.ToLower(info.DataType)
+		if strings.EqualFold(columnType, "tinyint(1)") {
+			info.DataType = "boolean" // MySQL's BOOLEAN
+		}
+		info.MaxLength = nullIntPtr(maxLength)
+		info.Precision = nullIntPtr(precision)
+		info.Scale = nullIntPtr(scale)
+		if defaultVal.Valid {
+			info.DefaultValue = &defaultVal.String
+		}
+
+		tableSchemas[info.TableName] = append(tableSchemas[info.TableName], info)
+	}
+
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("error iterating schema rows: %w", err)
+	}
+
+	schemaStr := formatSchema(tableSchemas, mapMySQLTypeToGoType)
+
+	// Cache the schema
+	cache.CacheSchema(dbName, schemaStr)
+
+	return schemaStr, nil
+}
+
+// mapMySQLTypeToGoType converts MySQL data types to Go types
+func mapMySQLTypeToGoType(col SchemaInfo) string {
+	switch col.DataType {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint", "year":
+		return "int64"
+	case "decimal", "numeric", "float", "double", "real":
+		return "float64"
+	case "boolean", "bool":
+		return "bool"
+	case "json":
+		return "map[string]interface{}"
+	case "date", "datetime", "timestamp":
+		return "time.Time"
+	case "char", "varchar", "tinytext", "text", "mediumtext", "longtext", "enum", "set", "time":
+		if col.MaxLength != nil && *col.MaxLength > 0 && col.DataType == "varchar" {
+			return fmt.Sprintf("string // max length: %d", *col.MaxLength)
+		}
+		return "string"
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob", "bit":
+		return "[]byte"
+	default:
+		return col.DataType + " // unknown type"
+	}
+}
+
+func nullIntPtr(n sql.NullInt64) *int {
+	if !n.Valid {
+		return nil
+	}
+	i := int(n.Int64)
+	return &i
+}
@@ -5,11 +5,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/vijaylingoju/prompterdb/config"
 )
 
 const (
@@ -18,6 +22,7 @@ const (
 	defaultMaxConnLifetime   = time.Hour
 	defaultMaxConnIdleTime   = time.Minute * 30
 	defaultHealthCheckPeriod = time.Minute
+	defaultPingTimeout       = 5 * time.Second
 )
 
 var (
@@ -31,6 +36,12 @@ var (
 
 // ConnectPostgres establishes a connection to PostgreSQL with the given name and URI
 func ConnectPostgres(name, uri string) error {
+	return ConnectPostgresWithConfig(name, uri, config.PoolConfig{})
+}
+
+// ConnectPostgresWithConfig establishes a connection to PostgreSQL with the given pool
+// and session settings. Settings left at zero use the defaults.
+func ConnectPostgresWithConfig(name, uri string, poolCfg config.PoolConfig) error {
 	if name == "" {
 		return errors.New("connection name cannot be empty")
 	}
@@ -43,38 +54,96 @@ func ConnectPostgres(name, uri string) error {
 		return nil // Already connected
 	}
 
-	// Parse the connection string
-	config, err := pgxpool.ParseConfig(uri)
+	pool, err := newPostgresPool(uri, poolCfg)
 	if err != nil {
-		return fmt.Errorf("failed to parse PostgreSQL connection string: %w", err)
+		return err
 	}
 
-	// Configure connection pool
-	config.MaxConns = defaultMaxConns
-	config.MinConns = defaultMinConns
-	config.MaxConnLifetime = defaultMaxConnLifetime
-	config.MaxConnIdleTime = defaultMaxConnIdleTime
-	config.HealthCheckPeriod = defaultHealthCheckPeriod
+	pgPools[name] = pool
+	return nil
+}
+
+// newPostgresPool creates a connection pool and verifies it with a ping
+func newPostgresPool(uri string, poolCfg config.PoolConfig) (*pgxpool.Pool, error) {
+	// Parse the connection string
+	pgConfig, err := pgxpool.ParseConfig(uri)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse PostgreSQL connection string: %w", err)
+	}
+	if err := applyPostgresPoolConfig(pgConfig, poolCfg); err != nil {
+		return nil, err
+	}
 
 	// Create a new connection pool
-	pool, err := pgxpool.NewWithConfig(context.Background(), config)
+	pool, err := pgxpool.NewWithConfig(context.Background(), pgConfig)
 	if err != nil {
-		return fmt.Errorf("failed to create PostgreSQL connection pool: %w", err)
+		return nil, fmt.Errorf("failed to create PostgreSQL connection pool: %w", err)
 	}
 
 	// Verify the connection
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), durationOr(poolCfg.PingTimeout, defaultPingTimeout))
 	defer cancel()
 
 	if err := pool.Ping(ctx); err != nil {
 		pool.Close()
-		return fmt.Errorf("failed to ping PostgreSQL server: %w", err)
+		return nil, fmt.Errorf("failed to ping PostgreSQL server: %w", err)
 	}
+	return pool, nil
+}
 
-	pgPools[name] = pool
+// applyPostgresPoolConfig sets the pool and session settings on a parsed configuration
+func applyPostgresPoolConfig(pgConfig *pgxpool.Config, poolCfg config.PoolConfig) error {
+	pgConfig.MaxConns = defaultMaxConns
+	if poolCfg.MaxConns > 0 {
+		pgConfig.MaxConns = poolCfg.MaxConns
+	}
+	pgConfig.MinConns = min(defaultMinConns, pgConfig.MaxConns)
+	if poolCfg.MinConns > 0 {
+		pgConfig.MinConns = poolCfg.MinConns
+	}
+	if pgConfig.MinConns > pgConfig.MaxConns {
+		return fmt.Errorf("MinConns (%d) cannot exceed MaxConns (%d)", pgConfig.MinConns, pgConfig.MaxConns)
+	}
+	pgConfig.MaxConnLifetime = durationOr(poolCfg.MaxConnLifetime, defaultMaxConnLifetime)
+	pgConfig.MaxConnIdleTime = durationOr(poolCfg.MaxConnIdleTime, defaultMaxConnIdleTime)
+	pgConfig.HealthCheckPeriod = durationOr(poolCfg.HealthCheckPeriod, defaultHealthCheckPeriod)
+
+	connConfig := pgConfig.ConnConfig
+	if poolCfg.ConnectTimeout > 0 {
+		connConfig.ConnectTimeout = poolCfg.ConnectTimeout
+	}
+	if poolCfg.StatementTimeout > 0 {
+		connConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(poolCfg.StatementTimeout.Milliseconds(), 10)
+	}
+	if poolCfg.ApplicationName != "" {
+		connConfig.RuntimeParams["application_name"] = poolCfg.ApplicationName
+	}
+	if len(poolCfg.SearchPath) > 0 {
+		schemas := make([]string, len(poolCfg.SearchPath))
+		for i, schema := range poolCfg.SearchPath {
+			schemas[i] = pgx.Identifier{schema}.Sanitize()
+		}
+		connConfig.RuntimeParams["search_path"] = strings.Join(schemas, ", ")
+	}
+	if poolCfg.TLS != nil {
+		tlsConfig := poolCfg.TLS.Clone()
+		if tlsConfig.ServerName == "" && !tlsConfig.InsecureSkipVerify {
+			tlsConfig.ServerName = connConfig.Host
+		}
+		connConfig.TLSConfig = tlsConfig
+		connConfig.Fallbacks = nil
+	}
 	return nil
 }
 
+// durationOr returns d, or def when d is not set
+func durationOr(d, def time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	return def
+}
+
 // ClosePostgres closes the PostgreSQL connection with the given name
 func ClosePostgres(name string) error {
 	pgPoolsMu.Lock()
@@ -87,6 +156,7 @@ func ClosePostgres(name string) error {
 
 	pool.Close()
 	delete(pgPools, name)
+	closeReplicas(name)
 	return nil
 }
 
@@ -99,73 +169,29 @@ func CloseAllPostgres() error {
 	for name, pool := range pgPools {
 		pool.Close()
 		delete(pgPools, name)
+		closeReplicas(name)
 	}
 
 	return lastErr
 }
 
-// QueryPostgres executes a query on the specified PostgreSQL database
-func QueryPostgres(name, query string) ([]map[string]interface{}, error) {
-	// Input validation
-	if name == "" {
-		return nil, errors.New("connection name cannot be empty")
-	}
-	if query == "" {
-		return nil, errors.New("query cannot be empty")
-	}
-
-	// Get pool with read lock
-	pgPoolsMu.RLock()
-	pool, ok := pgPools[name]
-	pgPoolsMu.RUnlock()
-
-	if !ok {
-		return nil, fmt.Errorf("%w: %s", ErrPoolNotFound, name)
-	}
-
-	// Create context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	// Execute query
-	rows, err := pool.Query(ctx, query)
+// QueryPostgres executes a query on the specified PostgreSQL database.
+// args are bound to the $n placeholders of the query.
+// At most RowLimit rows are returned; use QueryPostgresLimit to learn whether rows were dropped.
+func QueryPostgres(name, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	results, truncated, err := QueryPostgresLimit(name, query, 0, args...)
 	if err != nil {
-		return nil, fmt.Errorf("query execution failed: %w", err)
+		return nil, err
 	}
-	defer rows.Close()
-
-	// Get column information
-	fieldDescriptions := rows.FieldDescriptions()
-	columns := make([]string, len(fieldDescriptions))
-	for i, fd := range fieldDescriptions {
-		columns[i] = string(fd.Name)
+	if truncated {
+		log.Printf("Warning: query on %s returned more than %d rows, the result was truncated", name, RowLimit())
 	}
-
-	// Process results
-	var results []map[string]interface{}
-	for rows.Next() {
-		values, err := rows.Values()
-		if err != nil {
-			return nil, fmt.Errorf("error reading row values: %w", err)
-		}
-
-		row := make(map[string]interface{})
-		for i, col := range columns {
-			row[col] = values[i]
-		}
-		results = append(results, row)
-	}
-
-	// Check for errors from iterating over rows
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating query results: %w", err)
-	}
-
 	return results, nil
 }
 
-// Execute executes a SQL command that doesn't return rows
-func Execute(name, command string) (int64, error) {
+// Execute executes a SQL command that doesn't return rows.
+// args are bound to the $n placeholders of the command.
+func Execute(name, command string, args ...interface{}) (int64, error) {
 	if name == "" {
 		return 0, errors.New("connection name cannot be empty")
 	}
@@ -184,7 +210,7 @@ func Execute(name, command string) (int64, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	tag, err := pool.Exec(ctx, command)
+	tag, err := pool.Exec(ctx, command, args...)
 	if err != nil {
 		return 0, fmt.Errorf("execution failed: %w", err)
 	}
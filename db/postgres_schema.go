@@ -5,10 +5,12 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/vijaylingoju/prompterdb/cache"
+	"github.com/vijaylingoju/prompterdb/config"
 )
 
 // SchemaInfo represents database schema information
@@ -84,8 +86,6 @@ func GetPostgresSchema(dbName string) (string, error) {
 	}
 	defer rows.Close()
 
-	// Build schema string
-	var schemaBuilder strings.Builder
 	tableSchemas := make(map[string][]SchemaInfo)
 
 	// First pass: collect all schema information
@@ -119,8 +119,28 @@ func GetPostgresSchema(dbName string) (string, error) {
 		return "", fmt.Errorf("error iterating schema rows: %w", err)
 	}
 
-	// Second pass: generate schema string
-	for tableName, columns := range tableSchemas {
+	schemaStr := formatSchema(tableSchemas, func(col SchemaInfo) string {
+		return mapPgTypeToGoType(col.DataType, col)
+	})
+
+	// Cache the schema
+	cache.CacheSchema(dbName, schemaStr)
+
+	return schemaStr, nil
+}
+
+// formatSchema writes the tables and columns of a schema for LLM prompts,
+// with each column's type given by goType
+func formatSchema(tableSchemas map[string][]SchemaInfo, goType func(SchemaInfo) string) string {
+	tableNames := make([]string, 0, len(tableSchemas))
+	for tableName := range tableSchemas {
+		tableNames = append(tableNames, tableName)
+	}
+	sort.Strings(tableNames)
+
+	var schemaBuilder strings.Builder
+	for _, tableName := range tableNames {
+		columns := tableSchemas[tableName]
 		if schemaBuilder.Len() > 0 {
 			schemaBuilder.WriteString("\n\n")
 		}
@@ -136,8 +156,7 @@ func GetPostgresSchema(dbName string) (string, error) {
 			schemaBuilder.WriteString(fmt.Sprintf("    %s ", col.ColumnName))
 
 			// Data type with precision/scale if applicable
-			typeStr := mapPgTypeToGoType(col.DataType, col)
-			schemaBuilder.WriteString(typeStr)
+			schemaBuilder.WriteString(goType(col))
 
 			// Nullable
 			if col.IsNullable == "NO" {
@@ -157,13 +176,7 @@ func GetPostgresSchema(dbName string) (string, error) {
 
 		schemaBuilder.WriteString("\n)")
 	}
-
-	schemaStr := schemaBuilder.String()
-
-	// Cache the schema
-	cache.CacheSchema(dbName, schemaStr)
-
-	return schemaStr, nil
+	return schemaBuilder.String()
 }
 
 // mapPgTypeToGoType converts PostgreSQL data types to Go types
@@ -201,13 +214,21 @@ func mapPgTypeToGoType(pgType string, col SchemaInfo) string {
 	}
 }
 
+// sqlSchema returns the schema of a SQL database, introspected by the driver of its type
+func sqlSchema(dbName string) (string, error) {
+	if _, ok := config.RegisteredDBs[dbName]; ok {
+		return Introspect(context.Background(), dbName)
+	}
+	return GetPostgresSchema(dbName)
+}
+
 // GetTableSchema returns the schema for a specific table
 func GetTableSchema(dbName, tableName string) (string, error) {
 	if dbName == "" || tableName == "" {
 		return "", errors.New("database name and table name are required")
 	}
 
-	schema, err := GetPostgresSchema(dbName)
+	schema, err := sqlSchema(dbName)
 	if err != nil {
 		return "", fmt.Errorf("failed to get schema: %w", err)
 	}
@@ -245,7 +266,7 @@ func GetColumnType(dbName, tableName, columnName string) (string, error) {
 	}
 
 	// Get the full schema
-	schema, err := GetPostgresSchema(dbName)
+	schema, err := sqlSchema(dbName)
 	if err != nil {
 		return "", fmt.Errorf("failed to get schema: %w", err)
 	}
@@ -0,0 +1,255 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/vijaylingoju/prompterdb/config"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+const (
+	// DefaultMaxReplicaLag is the replication delay above which reads go to the primary
+	DefaultMaxReplicaLag = 10 * time.Second
+	// replicaLagTTL is how long a measured replica lag is reused before it is checked again
+	replicaLagTTL = 5 * time.Second
+	// replicaLagTimeout bounds a lag check, so a stuck replica does not hold up reads
+	replicaLagTimeout = 2 * time.Second
+)
+
+// replicaLagQuery returns the replication delay of a standby in seconds. A standby
+// that has replayed all the WAL it received is current even if the primary has been idle.
+const replicaLagQuery = `
+SELECT CASE
+    WHEN NOT pg_is_in_recovery() THEN 0
+    WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+    ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+END::float8`
+
+// pgReplica is a read replica pool with its last measured lag
+type pgReplica struct {
+	uri       string
+	pool      *pgxpool.Pool
+	mu        sync.Mutex
+	lag       time.Duration
+	err       error
+	checkedAt time.Time
+}
+
+// pgReplicaSet holds the replicas of a named database. replicas and maxLag are
+// guarded by pgPoolsMu; replicas is replaced, never changed in place.
+type pgReplicaSet struct {
+	replicas []*pgReplica
+	maxLag   time.Duration
+	next     atomic.Uint64
+}
+
+// pgReplicas holds the read replicas by database name, guarded by pgPoolsMu
+var pgReplicas = make(map[string]*pgReplicaSet)
+
+// ConnectPostgresReplica connects a read replica of the named database. SELECT
+// queries are spread over the replicas; Execute and BeginTx always use the primary.
+func ConnectPostgresReplica(name, uri string, poolCfg config.PoolConfig) error {
+	if name == "" {
+		return errors.New("connection name cannot be empty")
+	}
+
+	if replicas, _ := replicaSnapshot(name); hasReplica(replicas, uri) {
+		return nil // Already connected
+	}
+
+	// Dial without the lock, so reads of other databases are not held up
+	pool, err := newPostgresPool(uri, poolCfg)
+	if err != nil {
+		return fmt.Errorf("replica of %s: %w", name, err)
+	}
+
+	pgPoolsMu.Lock()
+	defer pgPoolsMu.Unlock()
+
+	set, exists := pgReplicas[name]
+	if !exists {
+		set = &pgReplicaSet{maxLag: DefaultMaxReplicaLag}
+		pgReplicas[name] = set
+	}
+	if hasReplica(set.replicas, uri) {
+		pool.Close() // Connected concurrently
+		return nil
+	}
+	replicas := make([]*pgReplica, len(set.replicas), len(set.replicas)+1)
+	copy(replicas, set.replicas)
+	set.replicas = append(replicas, &pgReplica{uri: uri, pool: pool})
+	return nil
+}
+
+// hasReplica reports whether replicas include one connected to uri
+func hasReplica(replicas []*pgReplica, uri string) bool {
+	for _, r := range replicas {
+		if r.uri == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// replicaSnapshot returns the replicas and the lag limit of the named database
+func replicaSnapshot(name string) ([]*pgReplica, time.Duration) {
+	pgPoolsMu.RLock()
+	defer pgPoolsMu.RUnlock()
+	set := pgReplicas[name]
+	if set == nil {
+		return nil, DefaultMaxReplicaLag
+	}
+	return set.replicas, set.maxLag
+}
+
+// SetMaxReplicaLag sets the replication delay above which reads of the named
+// database go to the primary. A lag of 0 or less restores DefaultMaxReplicaLag.
+func SetMaxReplicaLag(name string, lag time.Duration) {
+	if lag <= 0 {
+		lag = DefaultMaxReplicaLag
+	}
+	pgPoolsMu.Lock()
+	defer pgPoolsMu.Unlock()
+
+	set, exists := pgReplicas[name]
+	if !exists {
+		set = &pgReplicaSet{}
+		pgReplicas[name] = set
+	}
+	set.maxLag = lag
+}
+
+// closeReplicas closes the replicas of a database. The caller holds pgPoolsMu.
+func closeReplicas(name string) {
+	if set, exists := pgReplicas[name]; exists {
+		for _, r := range set.replicas {
+			r.pool.Close()
+		}
+		delete(pgReplicas, name)
+	}
+}
+
+// readPool returns the pool a read of the named database should use: the next
+// replica within the lag limit, or the primary when there is none
+func readPool(ctx context.Context, name string) (*pgxpool.Pool, error) {
+	// Copy what is needed under the lock, closeReplicas and ConnectPostgresReplica change it
+	pgPoolsMu.RLock()
+	primary, ok := pgPools[name]
+	set := pgReplicas[name]
+	var replicas []*pgReplica
+	var maxLag time.Duration
+	if set != nil {
+		replicas, maxLag = set.replicas, set.maxLag
+	}
+	pgPoolsMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrPoolNotFound, name)
+	}
+	if len(replicas) == 0 {
+		return primary, nil
+	}
+
+	start := set.next.Add(1)
+	for i := range replicas {
+		r := replicas[(start+uint64(i))%uint64(len(replicas))]
+		lag, err := r.currentLag(ctx)
+		if err != nil {
+			log.Printf("Warning: could not check replica lag of %s: %v", name, err)
+			continue
+		}
+		if lag <= maxLag {
+			return r.pool, nil
+		}
+	}
+	log.Printf("Warning: no replica of %s is within %s of the primary, reading from the primary", name, maxLag)
+	return primary, nil
+}
+
+// primaryPool returns the primary pool of the named database
+func primaryPool(name string) (*pgxpool.Pool, error) {
+	pgPoolsMu.RLock()
+	pool, ok := pgPools[name]
+	pgPoolsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrPoolNotFound, name)
+	}
+	return pool, nil
+}
+
+// currentLag returns the replica's lag, measuring it again once the last check is older than replicaLagTTL
+func (r *pgReplica) currentLag(ctx context.Context) (time.Duration, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checkedAt) < replicaLagTTL {
+		return r.lag, r.err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, replicaLagTimeout)
+	defer cancel()
+	var seconds float64
+	r.err = r.pool.QueryRow(ctx, replicaLagQuery).Scan(&seconds)
+	r.lag = time.Duration(seconds * float64(time.Second))
+	r.checkedAt = time.Now()
+	return r.lag, r.err
+}
+
+// ReplicaLag returns the measured lag of each replica of the named database, in the order they were connected
+func ReplicaLag(ctx context.Context, name string) ([]time.Duration, error) {
+	replicas, _ := replicaSnapshot(name)
+	if len(replicas) == 0 {
+		return nil, nil
+	}
+
+	lags := make([]time.Duration, len(replicas))
+	for i, r := range replicas {
+		lag, err := r.currentLag(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("replica %d of %s: %w", i+1, name, err)
+		}
+		lags[i] = lag
+	}
+	return lags, nil
+}
+
+// minMaxStaleness is the smallest maxStalenessSeconds MongoDB accepts
+const minMaxStaleness = 90 * time.Second
+
+// mongoReadPrefs holds the read preference of each Mongo connection, guarded by mongoMu
+var mongoReadPrefs = make(map[string]*readpref.ReadPref)
+
+// SetMongoReadPreference sets the members of the replica set that reads of the named
+// connection go to, e.g. "secondaryPreferred". Writes always go to the primary.
+// Secondaries more than maxStaleness behind are skipped; MongoDB requires at least 90s.
+func SetMongoReadPreference(name, mode string, maxStaleness time.Duration) error {
+	readMode, err := readpref.ModeFromString(mode)
+	if err != nil {
+		return fmt.Errorf("invalid MongoDB read preference %q: %w", mode, err)
+	}
+
+	var prefOpts []readpref.Option
+	if maxStaleness > 0 && readMode != readpref.PrimaryMode {
+		if maxStaleness < minMaxStaleness {
+			log.Printf("Warning: MongoDB max staleness of %s is below the minimum, using %s", maxStaleness, minMaxStaleness)
+			maxStaleness = minMaxStaleness
+		}
+		prefOpts = append(prefOpts, readpref.WithMaxStaleness(maxStaleness))
+	}
+	rp, err := readpref.New(readMode, prefOpts...)
+	if err != nil {
+		return fmt.Errorf("invalid MongoDB read preference %q: %w", mode, err)
+	}
+
+	mongoMu.Lock()
+	defer mongoMu.Unlock()
+	mongoReadPrefs[name] = rp
+	return nil
+}
@@ -0,0 +1,237 @@
+package db
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LogicalType is the database-independent kind of a result column
+type LogicalType string
+
+const (
+	TypeNumber LogicalType = "number"
+	TypeString LogicalType = "string"
+	TypeTime   LogicalType = "time"
+	TypeBool   LogicalType = "bool"
+	TypeJSON   LogicalType = "json" // objects, arrays and JSON columns
+)
+
+// Column describes a column of a result set
+type Column struct {
+	Name   string      `json:"name"`
+	DBType string      `json:"db_type"`       // type name reported by the database, e.g. int8 or objectId
+	OID    uint32      `json:"oid,omitempty"` // PostgreSQL type OID
+	Type   LogicalType `json:"type"`
+}
+
+// ResultSet holds query results with ordered, typed columns.
+// Each row has one value per column, in column order.
+type ResultSet struct {
+	Columns   []Column        `json:"columns"`
+	Rows      [][]interface{} `json:"rows"`
+	Truncated bool            `json:"truncated,omitempty"` // more rows were available than returned
+}
+
+// ColumnNames returns the column names in order
+func (r *ResultSet) ColumnNames() []string {
+	names := make([]string, len(r.Columns))
+	for i, c := range r.Columns {
+		names[i] = c.Name
+	}
+	return names
+}
+
+// ColumnIndex returns the position of a column, or -1 if there is none with that name
+func (r *ResultSet) ColumnIndex(name string) int {
+	for i, c := range r.Columns {
+		if c.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Maps returns the rows as maps keyed by column name
+func (r *ResultSet) Maps() []map[string]interface{} {
+	maps := make([]map[string]interface{}, len(r.Rows))
+	for i, row := range r.Rows {
+		m := make(map[string]interface{}, len(r.Columns))
+		for j, c := range r.Columns {
+			if j < len(row) {
+				m[c.Name] = row[j]
+			}
+		}
+		maps[i] = m
+	}
+	return maps
+}
+
+// NewResultSet builds a result set from rows that only exist as maps. Columns are
+// sorted by name, since maps carry no order, and typed from their first non-nil value.
+func NewResultSet(rows []map[string]interface{}) *ResultSet {
+	rs := &ResultSet{}
+	seen := map[string]bool{}
+	var names []string
+	for _, row := range rows {
+		for name := range row {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		column := Column{Name: name, Type: TypeString}
+		for _, row := range rows {
+			if v := row[name]; v != nil {
+				column.DBType, column.Type = InferType(v)
+				break
+			}
+		}
+		rs.Columns = append(rs.Columns, column)
+	}
+
+	for _, row := range rows {
+		values := make([]interface{}, len(names))
+		for i, name := range names {
+			values[i] = row[name]
+		}
+		rs.Rows = append(rs.Rows, values)
+	}
+	return rs
+}
+
+// resultBuilder collects rows whose columns may differ from row to row, as
+// documents do, keeping columns in the order they are first seen
+type resultBuilder struct {
+	rs    ResultSet
+	index map[string]int
+}
+
+func (b *resultBuilder) add(columns []Column, values []interface{}) {
+	if b.index == nil {
+		b.index = map[string]int{}
+	}
+	row := make([]interface{}, len(b.rs.Columns), len(b.rs.Columns)+len(columns))
+	for i, c := range columns {
+		j, ok := b.index[c.Name]
+		if !ok {
+			j = len(b.rs.Columns)
+			b.index[c.Name] = j
+			b.rs.Columns = append(b.rs.Columns, c)
+			row = append(row, nil)
+		}
+		row[j] = values[i]
+	}
+	b.rs.Rows = append(b.rs.Rows, row)
+}
+
+// result pads earlier rows to the final number of columns
+func (b *resultBuilder) result() *ResultSet {
+	for i, row := range b.rs.Rows {
+		for len(row) < len(b.rs.Columns) {
+			row = append(row, nil)
+		}
+		b.rs.Rows[i] = row
+	}
+	return &b.rs
+}
+
+// postgresColumns describes the fields of a PostgreSQL result
+func postgresColumns(fields []pgconn.FieldDescription, typeMap *pgtype.Map) []Column {
+	if typeMap == nil {
+		typeMap = pgtype.NewMap()
+	}
+	columns := make([]Column, len(fields))
+	for i, fd := range fields {
+		dbType := "unknown"
+		if t, ok := typeMap.TypeForOID(fd.DataTypeOID); ok {
+			dbType = t.Name
+		}
+		columns[i] = Column{
+			Name:   fd.Name,
+			DBType: dbType,
+			OID:    fd.DataTypeOID,
+			Type:   postgresLogicalType(dbType),
+		}
+	}
+	return columns
+}
+
+// postgresLogicalType maps a PostgreSQL type name to its logical type
+func postgresLogicalType(dbType string) LogicalType {
+	if strings.HasPrefix(dbType, "_") {
+		return TypeJSON // arrays
+	}
+	switch dbType {
+	case "int2", "int4", "int8", "float4", "float8", "numeric", "oid", "money":
+		return TypeNumber
+	case "bool":
+		return TypeBool
+	case "date", "time", "timetz", "timestamp", "timestamptz":
+		return TypeTime
+	case "json", "jsonb":
+		return TypeJSON
+	}
+	return TypeString
+}
+
+// mongoColumns describes the fields of a document from their BSON values
+func mongoColumns(doc bson.D) []Column {
+	columns := make([]Column, len(doc))
+	for i, e := range doc {
+		dbType, logical := bsonValueType(e.Value)
+		columns[i] = Column{Name: e.Key, DBType: dbType, Type: logical}
+	}
+	return columns
+}
+
+// bsonValueType returns the BSON type name and logical type of a decoded value
+func bsonValueType(v interface{}) (string, LogicalType) {
+	switch v.(type) {
+	case primitive.ObjectID:
+		return "objectId", TypeString
+	case primitive.DateTime, primitive.Timestamp:
+		return "date", TypeTime
+	case primitive.Decimal128:
+		return "decimal", TypeNumber
+	case int32:
+		return "int", TypeNumber
+	case int64:
+		return "long", TypeNumber
+	case float64:
+		return "double", TypeNumber
+	case bool:
+		return "bool", TypeBool
+	case string:
+		return "string", TypeString
+	case bson.D, bson.M, map[string]interface{}:
+		return "object", TypeJSON
+	case bson.A, []interface{}:
+		return "array", TypeJSON
+	case primitive.Binary:
+		return "binData", TypeString
+	case nil, primitive.Null:
+		return "null", TypeString
+	}
+	return "unknown", TypeString
+}
+
+// InferType returns a type name and the logical type of a value of unknown origin
+func InferType(v interface{}) (string, LogicalType) {
+	switch v.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return "number", TypeNumber
+	case time.Time:
+		return "time", TypeTime
+	}
+	return bsonValueType(v)
+}
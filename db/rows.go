@@ -0,0 +1,336 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// DefaultRowLimit is the maximum number of rows a query returns unless SetDefaultRowLimit changes it
+const DefaultRowLimit = 10000
+
+var rowLimit atomic.Int64
+
+func init() {
+	rowLimit.Store(DefaultRowLimit)
+}
+
+// SetDefaultRowLimit sets the maximum number of rows QueryPostgres and QueryMongo return.
+// A limit of 0 or less restores DefaultRowLimit.
+func SetDefaultRowLimit(limit int) {
+	if limit <= 0 {
+		limit = DefaultRowLimit
+	}
+	rowLimit.Store(int64(limit))
+}
+
+// RowLimit returns the current default row limit
+func RowLimit() int {
+	return int(rowLimit.Load())
+}
+
+// RowIterator streams the rows of a query without loading them all into memory.
+// Close must be called when done, even after Next returns false.
+type RowIterator interface {
+	Next() bool
+	// Row returns the current row keyed by column name
+	Row() map[string]interface{}
+	// Columns describes the values of the current row, in order. For documents
+	// the columns are those of the current document.
+	Columns() []Column
+	// Values returns the current row in the order of Columns
+	Values() []interface{}
+	Err() error
+	Close() error
+}
+
+// collectResultSet reads at most limit rows from it, marking the result
+// truncated when more rows were available
+func collectResultSet(it RowIterator, limit int) (*ResultSet, error) {
+	defer it.Close()
+
+	var b resultBuilder
+	for it.Next() {
+		if len(b.rs.Rows) == limit {
+			b.rs.Truncated = true
+			break
+		}
+		b.add(it.Columns(), it.Values())
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return b.result(), nil
+}
+
+// pgRowIterator streams the rows of a pgx query
+type pgRowIterator struct {
+	rows    pgx.Rows
+	columns []Column
+	values  []interface{}
+	err     error
+	done    bool
+	cancel  context.CancelFunc
+}
+
+// StreamPostgres executes a query and returns an iterator over its rows. The query
+// runs on a read replica when the database has one within the lag limit.
+// The query runs until the iterator is closed or ctx is done; closing it early
+// reads and discards the remaining rows, so cancel ctx first to abandon a large result.
+func StreamPostgres(ctx context.Context, name, query string, args ...interface{}) (RowIterator, error) {
+	if name == "" {
+		return nil, errors.New("connection name cannot be empty")
+	}
+	if query == "" {
+		return nil, errors.New("query cannot be empty")
+	}
+
+	pool, err := readPool(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %w", err)
+	}
+
+	var typeMap *pgtype.Map
+	if conn := rows.Conn(); conn != nil {
+		typeMap = conn.TypeMap()
+	}
+	return &pgRowIterator{rows: rows, columns: postgresColumns(rows.FieldDescriptions(), typeMap)}, nil
+}
+
+func (it *pgRowIterator) Next() bool {
+	if it.err != nil || !it.rows.Next() {
+		it.done = true
+		return false
+	}
+	values, err := it.rows.Values()
+	if err != nil {
+		it.err = fmt.Errorf("error reading row values: %w", err)
+		return false
+	}
+	it.values = values
+	return true
+}
+
+func (it *pgRowIterator) Row() map[string]interface{} {
+	row := make(map[string]interface{}, len(it.columns))
+	for i, col := range it.columns {
+		row[col.Name] = it.values[i]
+	}
+	return row
+}
+
+func (it *pgRowIterator) Columns() []Column { return it.columns }
+
+func (it *pgRowIterator) Values() []interface{} { return it.values }
+
+func (it *pgRowIterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	if err := it.rows.Err(); err != nil {
+		return fmt.Errorf("error iterating query results: %w", err)
+	}
+	return nil
+}
+
+func (it *pgRowIterator) Close() error {
+	if it.cancel != nil {
+		if !it.done {
+			// abandon the rest of the result instead of draining it
+			it.cancel()
+		}
+		defer it.cancel()
+	}
+	it.rows.Close()
+	return nil
+}
+
+// mongoRowIterator streams the documents of a Mongo cursor
+type mongoRowIterator struct {
+	ctx     context.Context
+	cursor  *mongo.Cursor
+	columns []Column
+	values  []interface{}
+	err     error
+	cancel  context.CancelFunc
+}
+
+// StreamMongo runs a find and returns an iterator over the matching documents.
+// Values are normalized with NormalizeMongoValue. opts may be nil.
+func StreamMongo(ctx context.Context, name, dbName, collection string, filter bson.M, opts *FindOptions) (RowIterator, error) {
+	coll, err := mongoReadCollection(name, dbName, collection)
+	if err != nil {
+		return nil, err
+	}
+	if filter == nil {
+		filter = bson.M{}
+	}
+
+	cursor, err := coll.Find(ctx, filter, opts.toDriverOptions())
+	if err != nil {
+		return nil, fmt.Errorf("MongoDB find failed: %w", err)
+	}
+	return &mongoRowIterator{ctx: ctx, cursor: cursor}, nil
+}
+
+// StreamAggregateMongo runs an aggregation pipeline and returns an iterator over its results
+func StreamAggregateMongo(ctx context.Context, name, dbName, collection string, pipeline interface{}) (RowIterator, error) {
+	coll, err := mongoReadCollection(name, dbName, collection)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("MongoDB aggregate failed: %w", err)
+	}
+	return &mongoRowIterator{ctx: ctx, cursor: cursor}, nil
+}
+
+func (it *mongoRowIterator) Next() bool {
+	if it.err != nil || !it.cursor.Next(it.ctx) {
+		return false
+	}
+	// decode into a bson.D so the columns keep the field order of the document
+	var doc bson.D
+	if err := it.cursor.Decode(&doc); err != nil {
+		it.err = fmt.Errorf("failed to decode MongoDB results: %w", err)
+		return false
+	}
+	it.columns = mongoColumns(doc)
+	it.values = make([]interface{}, len(doc))
+	for i, e := range doc {
+		it.values[i] = NormalizeMongoValue(e.Value)
+	}
+	return true
+}
+
+func (it *mongoRowIterator) Row() map[string]interface{} {
+	row := make(map[string]interface{}, len(it.columns))
+	for i, col := range it.columns {
+		row[col.Name] = it.values[i]
+	}
+	return row
+}
+
+func (it *mongoRowIterator) Columns() []Column { return it.columns }
+
+func (it *mongoRowIterator) Values() []interface{} { return it.values }
+
+func (it *mongoRowIterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.cursor.Err()
+}
+
+func (it *mongoRowIterator) Close() error {
+	err := it.cursor.Close(context.Background())
+	if it.cancel != nil {
+		it.cancel()
+	}
+	return err
+}
+
+// QueryPostgresLimit executes a query and returns at most limit rows,
+// reporting whether the query had more. A limit of 0 uses RowLimit.
+func QueryPostgresLimit(name, query string, limit int, args ...interface{}) ([]map[string]interface{}, bool, error) {
+	rs, err := QueryPostgresResultSet(name, query, limit, args...)
+	if err != nil {
+		return nil, false, err
+	}
+	return rs.Maps(), rs.Truncated, nil
+}
+
+// QueryPostgresResultSet executes a query and returns at most limit rows with
+// their column types. A limit of 0 uses RowLimit.
+func QueryPostgresResultSet(name, query string, limit int, args ...interface{}) (*ResultSet, error) {
+	if limit <= 0 {
+		limit = RowLimit()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	it, err := StreamPostgres(ctx, name, query, args...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	it.(*pgRowIterator).cancel = cancel
+	return collectResultSet(it, limit)
+}
+
+// QueryMongoLimit runs a find and returns at most limit documents,
+// reporting whether more matched. A limit of 0 uses RowLimit; opts may be nil.
+func QueryMongoLimit(name, dbName, collection string, filter bson.M, opts *FindOptions, limit int) ([]map[string]interface{}, bool, error) {
+	rs, err := QueryMongoResultSet(name, dbName, collection, filter, opts, limit)
+	if err != nil {
+		return nil, false, err
+	}
+	return rs.Maps(), rs.Truncated, nil
+}
+
+// QueryMongoResultSet runs a find and returns at most limit documents as a result set
+// whose columns are the document fields in the order first seen. A limit of 0 uses RowLimit.
+func QueryMongoResultSet(name, dbName, collection string, filter bson.M, opts *FindOptions, limit int) (*ResultSet, error) {
+	if limit <= 0 {
+		limit = RowLimit()
+	}
+	findOpts := FindOptions{}
+	if opts != nil {
+		findOpts = *opts
+	}
+	if findOpts.Limit > 0 && findOpts.Limit <= int64(limit) {
+		limit = int(findOpts.Limit)
+	} else {
+		// fetch one document past the limit to detect truncation
+		findOpts.Limit = int64(limit) + 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	it, err := StreamMongo(ctx, name, dbName, collection, filter, &findOpts)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	it.(*mongoRowIterator).cancel = cancel
+	return collectResultSet(it, limit)
+}
+
+// AggregateMongoLimit runs an aggregation pipeline and returns at most limit documents,
+// reporting whether it produced more. A limit of 0 uses RowLimit.
+func AggregateMongoLimit(name, dbName, collection string, pipeline interface{}, limit int) ([]map[string]interface{}, bool, error) {
+	rs, err := AggregateMongoResultSet(name, dbName, collection, pipeline, limit)
+	if err != nil {
+		return nil, false, err
+	}
+	return rs.Maps(), rs.Truncated, nil
+}
+
+// AggregateMongoResultSet runs an aggregation pipeline and returns at most limit
+// documents as a result set. A limit of 0 uses RowLimit.
+func AggregateMongoResultSet(name, dbName, collection string, pipeline interface{}, limit int) (*ResultSet, error) {
+	if limit <= 0 {
+		limit = RowLimit()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	it, err := StreamAggregateMongo(ctx, name, dbName, collection, pipeline)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	it.(*mongoRowIterator).cancel = cancel
+	return collectResultSet(it, limit)
+}
@@ -0,0 +1,525 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vijaylingoju/prompterdb/cache"
+	"github.com/vijaylingoju/prompterdb/config"
+	"github.com/vijaylingoju/prompterdb/llm"
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+)
+
+var (
+	// sqliteDBs holds the SQLite connection pools
+	sqliteDBs   = make(map[string]*sqliteDB)
+	sqliteDBsMu sync.RWMutex
+
+	// ErrSQLiteNotFound is returned when a SQLite connection is not found
+	ErrSQLiteNotFound = errors.New("sqlite connection not found")
+)
+
+// sqliteBusyTimeout is how long a statement waits for a lock held by another connection
+const sqliteBusyTimeout = 5 * time.Second
+
+// sqliteDB is a SQLite connection pool. SQLite has no server to enforce a statement
+// timeout, so it is applied to the context of each query.
+type sqliteDB struct {
+	*sql.DB
+	statementTimeout time.Duration
+}
+
+// ConnectSQLite opens the SQLite database at path with the given name. The path is a
+// file name, a file: URI, or :memory: for a private in-memory database, optionally
+// prefixed with sqlite://.
+func ConnectSQLite(name, path string) error {
+	return ConnectSQLiteWithConfig(name, path, config.PoolConfig{})
+}
+
+// ConnectSQLiteWithConfig opens a SQLite database with the given pool settings.
+// Settings left at zero use the defaults.
+func ConnectSQLiteWithConfig(name, path string, poolCfg config.PoolConfig) error {
+	if name == "" {
+		return errors.New("connection name cannot be empty")
+	}
+	path = strings.TrimPrefix(path, "sqlite://")
+	if path == "" {
+		return errors.New("database path cannot be empty")
+	}
+
+	sqliteDBsMu.Lock()
+	defer sqliteDBsMu.Unlock()
+
+	if _, exists := sqliteDBs[name]; exists {
+		return nil // Already connected
+	}
+
+	conn, err := sql.Open("sqlite", sqliteDSN(path))
+	if err != nil {
+		return fmt.Errorf("invalid SQLite configuration: %w", err)
+	}
+
+	if isSQLiteMemory(path) {
+		// an in-memory database lives as long as its connection, and a second
+		// connection to :memory: would open a new, empty database, so keep exactly one
+		conn.SetMaxOpenConns(1)
+		conn.SetMaxIdleConns(1)
+		conn.SetConnMaxLifetime(0)
+		conn.SetConnMaxIdleTime(0)
+	} else {
+		maxConns := int(defaultMaxConns)
+		if poolCfg.MaxConns > 0 {
+			maxConns = int(poolCfg.MaxConns)
+		}
+		idleConns := min(int(defaultMinConns), maxConns)
+		if poolCfg.MinConns > 0 {
+			idleConns = int(poolCfg.MinConns)
+		}
+		conn.SetMaxOpenConns(maxConns)
+		conn.SetMaxIdleConns(idleConns)
+		conn.SetConnMaxLifetime(durationOr(poolCfg.MaxConnLifetime, defaultMaxConnLifetime))
+		conn.SetConnMaxIdleTime(durationOr(poolCfg.MaxConnIdleTime, defaultMaxConnIdleTime))
+	}
+	if poolCfg.TLS != nil || len(poolCfg.SearchPath) > 0 {
+		log.Printf("Warning: TLS and search_path have no effect on SQLite connections")
+	}
+
+	// Verify the database can be opened
+	ctx, cancel := context.WithTimeout(context.Background(), durationOr(poolCfg.PingTimeout, defaultPingTimeout))
+	defer cancel()
+
+	if err := conn.PingContext(ctx); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to open SQLite database: %w", err)
+	}
+
+	sqliteDBs[name] = &sqliteDB{DB: conn, statementTimeout: poolCfg.StatementTimeout}
+	return nil
+}
+
+// sqliteDSN adds the busy timeout and foreign key enforcement to a path, unless it sets them
+func sqliteDSN(dsn string) string {
+	for _, pragma := range []string{
+		fmt.Sprintf("busy_timeout(%d)", sqliteBusyTimeout.Milliseconds()),
+		"foreign_keys(1)",
+	} {
+		name, _, _ := strings.Cut(pragma, "(")
+		if strings.Contains(dsn, name) {
+			continue
+		}
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		dsn += sep + "_pragma=" + pragma
+	}
+	return dsn
+}
+
+// isSQLiteMemory reports whether a path names an in-memory database
+func isSQLiteMemory(path string) bool {
+	return path == ":memory:" || strings.HasPrefix(path, "file::memory:") || strings.Contains(path, "mode=memory")
+}
+
+// CloseSQLite closes the SQLite connection with the given name
+func CloseSQLite(name string) error {
+	sqliteDBsMu.Lock()
+	defer sqliteDBsMu.Unlock()
+
+	conn, exists := sqliteDBs[name]
+	if !exists {
+		return nil // Already closed
+	}
+
+	delete(sqliteDBs, name)
+	return conn.Close()
+}
+
+// CloseAllSQLite closes all SQLite connections
+func CloseAllSQLite() error {
+	sqliteDBsMu.Lock()
+	defer sqliteDBsMu.Unlock()
+
+	var lastErr error
+	for name, conn := range sqliteDBs {
+		if err := conn.Close(); err != nil {
+			lastErr = fmt.Errorf("error closing SQLite connection %s: %w", name, err)
+		}
+		delete(sqliteDBs, name)
+	}
+	return lastErr
+}
+
+// sqliteConn returns the connection pool with the given name
+func sqliteConn(name string) (*sqliteDB, error) {
+	if name == "" {
+		return nil, errors.New("connection name cannot be empty")
+	}
+
+	sqliteDBsMu.RLock()
+	conn, ok := sqliteDBs[name]
+	sqliteDBsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSQLiteNotFound, name)
+	}
+	return conn, nil
+}
+
+// StreamSQLite executes a query and returns an iterator over its rows.
+// args are bound to the ? placeholders of the query.
+func StreamSQLite(ctx context.Context, name, query string, args ...interface{}) (RowIterator, error) {
+	if query == "" {
+		return nil, errors.New("query cannot be empty")
+	}
+	conn, err := sqliteConn(name)
+	if err != nil {
+		return nil, err
+	}
+
+	cancel := context.CancelFunc(func() {})
+	if conn.statementTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, conn.statementTimeout)
+	}
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("query execution failed: %w", err)
+	}
+	it, err := newSQLRowIterator(rows, sqliteColumn, sqliteValue)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	it.cancel = cancel
+	return it, nil
+}
+
+// QuerySQLite executes a query on the specified SQLite database.
+// At most RowLimit rows are returned.
+func QuerySQLite(name, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	rs, err := QuerySQLiteResultSet(name, query, 0, args...)
+	if err != nil {
+		return nil, err
+	}
+	if rs.Truncated {
+		log.Printf("Warning: query on %s returned more than %d rows, the result was truncated", name, RowLimit())
+	}
+	return rs.Maps(), nil
+}
+
+// QuerySQLiteResultSet executes a query and returns at most limit rows with
+// their column types. A limit of 0 uses RowLimit.
+func QuerySQLiteResultSet(name, query string, limit int, args ...interface{}) (*ResultSet, error) {
+	if limit <= 0 {
+		limit = RowLimit()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	it, err := StreamSQLite(ctx, name, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return collectResultSet(it, limit)
+}
+
+// ExecuteSQLite executes a SQL command that doesn't return rows
+func ExecuteSQLite(name, command string, args ...interface{}) (int64, error) {
+	return ExecuteSQLiteGuarded(context.Background(), name, command, QueryGuard{}, args...)
+}
+
+// QuerySQLiteGuarded executes a query in a read-only transaction under guard and returns
+// at most limit rows. StatementTimeout and ReadOnly apply; SQLite reports no query cost,
+// so MaxCost is not checked, and the other limits are PostgreSQL settings.
+func QuerySQLiteGuarded(ctx context.Context, name, query string, limit int, guard QueryGuard, args ...interface{}) (*ResultSet, error) {
+	if limit <= 0 {
+		limit = RowLimit()
+	}
+
+	ctx, cancel := sqliteGuardContext(ctx, guard)
+	defer cancel()
+
+	tx, release, err := beginSQLiteGuarded(ctx, name, query, guard, true)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %w", err)
+	}
+	it, err := newSQLRowIterator(rows, sqliteColumn, sqliteValue)
+	if err != nil {
+		return nil, err
+	}
+	return collectResultSet(it, limit)
+}
+
+// ExecuteSQLiteGuarded executes a SQL command that doesn't return rows in a transaction
+// under guard. The transaction is committed when the command succeeds.
+func ExecuteSQLiteGuarded(ctx context.Context, name, command string, guard QueryGuard, args ...interface{}) (int64, error) {
+	if command == "" {
+		return 0, errors.New("command cannot be empty")
+	}
+
+	ctx, cancel := sqliteGuardContext(ctx, guard)
+	defer cancel()
+
+	tx, release, err := beginSQLiteGuarded(ctx, name, command, guard, false)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	res, err := tx.ExecContext(ctx, command, args...)
+	if err != nil {
+		return 0, fmt.Errorf("execution failed: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// sqliteGuardContext limits ctx to the guard's statement timeout. The driver interrupts
+// the statement when the context is done.
+func sqliteGuardContext(ctx context.Context, guard QueryGuard) (context.Context, context.CancelFunc) {
+	if guard.StatementTimeout > 0 {
+		return context.WithTimeout(ctx, guard.StatementTimeout)
+	}
+	return context.WithTimeout(ctx, guard.clientTimeout())
+}
+
+// beginSQLiteGuarded starts a transaction on a dedicated connection, which rejects writes
+// through PRAGMA query_only when readOnly is set, since SQLite ignores read-only
+// transaction options. release rolls back the transaction, if still open, and returns
+// the connection to the pool.
+func beginSQLiteGuarded(ctx context.Context, name, statement string, guard QueryGuard, readOnly bool) (*sql.Tx, func(), error) {
+	if statement == "" {
+		return nil, nil, errors.New("query cannot be empty")
+	}
+	pool, err := sqliteConn(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if guard.MaxCost > 0 {
+		log.Printf("Warning: %s does not report a query cost, the cost limit is not applied", name)
+	}
+
+	conn, err := pool.Conn(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+
+	queryOnly := readOnly || guard.ReadOnly
+	if queryOnly {
+		if _, err := conn.ExecContext(ctx, "PRAGMA query_only = ON"); err != nil {
+			conn.Close()
+			return nil, nil, fmt.Errorf("failed to make connection read-only: %w", err)
+		}
+	}
+
+	release := func() {
+		if queryOnly {
+			resetCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			// the connection goes back to the pool, so allow writes again
+			if _, err := conn.ExecContext(resetCtx, "PRAGMA query_only = OFF"); err != nil {
+				// ErrBadConn makes database/sql discard the connection
+				_ = conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+			}
+		}
+		conn.Close()
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		release()
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	return tx, func() {
+		_ = tx.Rollback()
+		release()
+	}, nil
+}
+
+// sqliteColumn describes a column of a SQLite result from its declared type.
+// Expressions have no declared type and are typed from their first value.
+func sqliteColumn(t *sql.ColumnType) Column {
+	dbType := strings.ToLower(t.DatabaseTypeName())
+	return Column{Name: t.Name(), DBType: dbType, Type: sqliteLogicalType(dbType)}
+}
+
+// sqliteLogicalType maps a declared SQLite type to its logical type, following
+// SQLite's type affinity rules
+func sqliteLogicalType(dbType string) LogicalType {
+	switch {
+	case strings.Contains(dbType, "bool"):
+		return TypeBool
+	case strings.Contains(dbType, "json"):
+		return TypeJSON
+	case strings.Contains(dbType, "date"), strings.Contains(dbType, "time"):
+		return TypeTime
+	case strings.Contains(dbType, "int"):
+		return TypeNumber
+	case strings.Contains(dbType, "char"), strings.Contains(dbType, "clob"), strings.Contains(dbType, "text"),
+		strings.Contains(dbType, "blob"), dbType == "":
+		return TypeString
+	}
+	return TypeNumber // REAL and NUMERIC affinity
+}
+
+// sqliteValue converts a value scanned from SQLite. The driver returns integers, floats,
+// text, blobs and times, so booleans and JSON are decoded according to the declared type.
+func sqliteValue(c Column, v interface{}) interface{} {
+	switch c.Type {
+	case TypeBool:
+		if i, ok := v.(int64); ok {
+			return i != 0
+		}
+	case TypeJSON:
+		if s, ok := v.(string); ok {
+			var decoded interface{}
+			if err := json.Unmarshal([]byte(s), &decoded); err == nil {
+				return decoded
+			}
+		}
+	}
+	return v
+}
+
+// LoadSQLiteTable creates a table holding the rows of rs, replacing any table of the same
+// name. Column types are declared from the logical types of the columns, and the cached
+// schema of the database is dropped so it is introspected again.
+func LoadSQLiteTable(ctx context.Context, name, table string, rs *ResultSet) error {
+	if table == "" {
+		return errors.New("table name cannot be empty")
+	}
+	if rs == nil || len(rs.Columns) == 0 {
+		return fmt.Errorf("no columns to load into %s", table)
+	}
+	conn, err := sqliteConn(name)
+	if err != nil {
+		return err
+	}
+
+	quote := llm.DialectSQLite.QuoteIdentifier
+	definitions := make([]string, len(rs.Columns))
+	placeholders := make([]string, len(rs.Columns))
+	for i, c := range rs.Columns {
+		definitions[i] = quote(c.Name) + " " + sqliteDeclaredType(rs, i)
+		placeholders[i] = "?"
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DROP TABLE IF EXISTS "+quote(table)); err != nil {
+		return fmt.Errorf("failed to replace table %s: %w", table, err)
+	}
+	create := fmt.Sprintf("CREATE TABLE %s (%s)", quote(table), strings.Join(definitions, ", "))
+	if _, err := tx.ExecContext(ctx, create); err != nil {
+		return fmt.Errorf("failed to create table %s: %w", table, err)
+	}
+
+	insert, err := tx.PrepareContext(ctx, fmt.Sprintf("INSERT INTO %s VALUES (%s)", quote(table), strings.Join(placeholders, ", ")))
+	if err != nil {
+		return fmt.Errorf("failed to prepare insert into %s: %w", table, err)
+	}
+	defer insert.Close()
+
+	values := make([]interface{}, len(rs.Columns))
+	for n, row := range rs.Rows {
+		for i := range values {
+			values[i] = nil
+			if i < len(row) {
+				values[i] = sqliteStorable(row[i])
+			}
+		}
+		if _, err := insert.ExecContext(ctx, values...); err != nil {
+			return fmt.Errorf("failed to insert row %d into %s: %w", n+1, table, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit: %w", err)
+	}
+	cache.RemoveSchema(name)
+	return nil
+}
+
+// sqliteDeclaredType returns the declared SQLite type of column i of rs. Numbers are
+// INTEGER when every value is a whole Go integer, and REAL otherwise.
+func sqliteDeclaredType(rs *ResultSet, i int) string {
+	switch rs.Columns[i].Type {
+	case TypeNumber:
+		for _, row := range rs.Rows {
+			if i >= len(row) || row[i] == nil {
+				continue
+			}
+			switch row[i].(type) {
+			case int, int8, int16, int32, int64, uint8, uint16, uint32:
+			default:
+				return "REAL"
+			}
+		}
+		return "INTEGER"
+	case TypeTime:
+		return "DATETIME"
+	case TypeBool:
+		return "BOOLEAN"
+	case TypeJSON:
+		return "JSON"
+	}
+	return "TEXT"
+}
+
+// sqliteStorable converts a result value to a value SQLite can store. Documents and
+// arrays are stored as JSON text.
+func sqliteStorable(v interface{}) interface{} {
+	switch x := v.(type) {
+	case nil, int64, float64, bool, string, []byte, time.Time:
+		return v
+	case int:
+		return int64(x)
+	case int8:
+		return int64(x)
+	case int16:
+		return int64(x)
+	case int32:
+		return int64(x)
+	case uint8:
+		return int64(x)
+	case uint16:
+		return int64(x)
+	case uint32:
+		return int64(x)
+	case float32:
+		return float64(x)
+	case map[string]interface{}, []interface{}:
+	case driver.Valuer:
+		if value, err := x.Value(); err == nil {
+			return sqliteStorable(value)
+		}
+	case fmt.Stringer:
+		return x.String()
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
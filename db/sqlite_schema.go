@@ -0,0 +1,147 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vijaylingoju/prompterdb/cache"
+)
+
+// GetSQLiteSchema fetches the schema of a SQLite database from sqlite_master and pragma table_info
+func GetSQLiteSchema(dbName string) (string, error) {
+	// Check cache first
+	if schema, ok := cache.GetCachedSchema(dbName); ok {
+		return schema, nil
+	}
+
+	conn, err := sqliteConn(dbName)
+	if err != nil {
+		return "", err
+	}
+
+	query := `
+        SELECT
+            m.name,
+            p.name,
+            p.type,
+            p."notnull",
+            p.dflt_value,
+            p.pk > 0
+        FROM
+            sqlite_master m
+            JOIN pragma_table_info(m.name) p
+        WHERE
+            m.type = 'table'
+            AND m.name NOT LIKE 'sqlite_%'
+        ORDER BY
+            m.name,
+            p.cid
+    `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return "", fmt.Errorf("error querying schema: %w", err)
+	}
+	defer rows.Close()
+
+	tableSchemas := make(map[string][]SchemaInfo)
+	for rows.Next() {
+		var info SchemaInfo
+		var declared string
+		var notNull bool
+		var defaultVal sql.NullString
+
+		err := rows.Scan(
+			&info.TableName,
+			&info.ColumnName,
+			&declared,
+			&notNull,
+			&defaultVal,
+			&info.IsPrimaryKey,
+		)
+		if err != nil {
+			return "", fmt.Errorf("error scanning schema row: %w", err)
+		}
+
+		info.DataType, info.MaxLength, info.Precision, info.Scale = parseSQLiteType(declared)
+		info.IsNullable = "YES"
+		if notNull {
+			info.IsNullable = "NO"
+		}
+		if defaultVal.Valid {
+			info.DefaultValue = &defaultVal.String
+		}
+
+		tableSchemas[info.TableName] = append(tableSchemas[info.TableName], info)
+	}
+
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("error iterating schema rows: %w", err)
+	}
+
+	schemaStr := formatSchema(tableSchemas, mapSQLiteTypeToGoType)
+
+	// Cache the schema
+	cache.CacheSchema(dbName, schemaStr)
+
+	return schemaStr, nil
+}
+
+// parseSQLiteType splits a declared type such as VARCHAR(20) or DECIMAL(10,2) into its
+// lowercase name and its length, or precision and scale
+func parseSQLiteType(declared string) (dataType string, maxLength, precision, scale *int) {
+	name, params, _ := strings.Cut(strings.ToLower(strings.TrimSpace(declared)), "(")
+	dataType = strings.TrimSpace(name)
+
+	var sizes []*int
+	for _, p := range strings.Split(strings.TrimSuffix(strings.TrimSpace(params), ")"), ",") {
+		if n, err := strconv.Atoi(strings.TrimSpace(p)); err == nil {
+			sizes = append(sizes, &n)
+		}
+	}
+	if len(sizes) == 0 {
+		return dataType, nil, nil, nil
+	}
+	if sqliteLogicalType(dataType) == TypeString {
+		return dataType, sizes[0], nil, nil
+	}
+	precision = sizes[0]
+	if len(sizes) > 1 {
+		scale = sizes[1]
+	}
+	return dataType, nil, precision, scale
+}
+
+// mapSQLiteTypeToGoType converts a declared SQLite type to a Go type. SQLite accepts any
+// type name, so the type is mapped by the same affinity rules SQLite applies.
+func mapSQLiteTypeToGoType(col SchemaInfo) string {
+	switch sqliteLogicalType(col.DataType) {
+	case TypeBool:
+		return "bool"
+	case TypeJSON:
+		return "map[string]interface{}"
+	case TypeTime:
+		return "time.Time"
+	case TypeNumber:
+		if strings.Contains(col.DataType, "int") {
+			return "int64"
+		}
+		return "float64"
+	}
+	switch {
+	case strings.Contains(col.DataType, "blob"):
+		return "[]byte"
+	case col.DataType == "":
+		return "any // no declared type"
+	case col.MaxLength != nil && *col.MaxLength > 0:
+		return fmt.Sprintf("string // max length: %d", *col.MaxLength)
+	}
+	return "string"
+}
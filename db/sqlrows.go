@@ -0,0 +1,91 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// sqlRowIterator streams the rows of a database/sql query. convert turns the
+// driver's value of a column into the value reported for it.
+type sqlRowIterator struct {
+	rows    *sql.Rows
+	columns []Column
+	convert func(Column, interface{}) interface{}
+	values  []interface{}
+	err     error
+	done    bool
+	cancel  context.CancelFunc
+}
+
+// newSQLRowIterator describes the columns of rows with describe and returns an iterator over them
+func newSQLRowIterator(rows *sql.Rows, describe func(*sql.ColumnType) Column, convert func(Column, interface{}) interface{}) (*sqlRowIterator, error) {
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		rows.Close()
+		return nil, fmt.Errorf("error reading column types: %w", err)
+	}
+	columns := make([]Column, len(types))
+	for i, t := range types {
+		columns[i] = describe(t)
+	}
+	return &sqlRowIterator{rows: rows, columns: columns, convert: convert}, nil
+}
+
+func (it *sqlRowIterator) Next() bool {
+	if it.err != nil || !it.rows.Next() {
+		it.done = true
+		return false
+	}
+	raw := make([]interface{}, len(it.columns))
+	dest := make([]interface{}, len(it.columns))
+	for i := range raw {
+		dest[i] = &raw[i]
+	}
+	if err := it.rows.Scan(dest...); err != nil {
+		it.err = fmt.Errorf("error reading row values: %w", err)
+		return false
+	}
+	for i, c := range it.columns {
+		raw[i] = it.convert(c, raw[i])
+		if c.DBType == "" && raw[i] != nil {
+			// columns without a declared type, such as SQLite expressions, are typed from their first value
+			it.columns[i].DBType, it.columns[i].Type = InferType(raw[i])
+		}
+	}
+	it.values = raw
+	return true
+}
+
+func (it *sqlRowIterator) Row() map[string]interface{} {
+	row := make(map[string]interface{}, len(it.columns))
+	for i, col := range it.columns {
+		row[col.Name] = it.values[i]
+	}
+	return row
+}
+
+func (it *sqlRowIterator) Columns() []Column { return it.columns }
+
+func (it *sqlRowIterator) Values() []interface{} { return it.values }
+
+func (it *sqlRowIterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	if err := it.rows.Err(); err != nil {
+		return fmt.Errorf("error iterating query results: %w", err)
+	}
+	return nil
+}
+
+func (it *sqlRowIterator) Close() error {
+	if it.cancel != nil {
+		if !it.done {
+			// abandon the rest of the result instead of draining it
+			it.cancel()
+		}
+		defer it.cancel()
+	}
+	return it.rows.Close()
+}
@@ -0,0 +1,40 @@
+package prompterdb
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/vijaylingoju/prompterdb/config"
+	"github.com/vijaylingoju/prompterdb/db"
+)
+
+// failingDriver refuses every connection
+type failingDriver struct {
+	db.Driver
+}
+
+var errRefused = errors.New("connection refused")
+
+func (failingDriver) Connect(config.DBConfig) error { return errRefused }
+
+func TestConnectFailureKeepsRegistration(t *testing.T) {
+	saved := config.RegisteredDBs
+	config.RegisteredDBs = map[string]config.DBConfig{
+		"shop": {Name: "shop", Type: config.SQLite, URI: "shop.db"},
+	}
+	defer func() { config.RegisteredDBs = saved }()
+	db.RegisterDriver("failing", failingDriver{})
+
+	if err := Connect(config.DBConfig{Name: "shop", Type: "failing", URI: "other"}); !errors.Is(err, errRefused) {
+		t.Fatalf("Connect() error = %v, want %v", err, errRefused)
+	}
+	if err := Connect(config.DBConfig{Name: "crm", Type: "failing"}); !errors.Is(err, errRefused) {
+		t.Fatalf("Connect() error = %v, want %v", err, errRefused)
+	}
+
+	want := map[string]config.DBConfig{"shop": {Name: "shop", Type: config.SQLite, URI: "shop.db"}}
+	if !reflect.DeepEqual(config.RegisteredDBs, want) {
+		t.Errorf("RegisteredDBs = %v, want %v", config.RegisteredDBs, want)
+	}
+}
@@ -122,19 +122,13 @@ func (r *Router) RoutePrompt(ctx context.Context, prompt string) (config.DBConfi
 
 // calculateDBMatchScore calculates how well a database matches the given keywords
 func (r *Router) calculateDBMatchScore(ctx context.Context, cfg config.DBConfig, keywords []string) (int, error) {
-	// Get schema based on DB type
-	var schema string
-	var err error
-
-	switch cfg.Type {
-	case config.Postgres:
-		schema, err = db.GetPostgresSchema(cfg.Name)
-	case config.Mongo:
-		schema, err = db.GetMongoSchema(cfg.Name)
-	default:
-		return 0, fmt.Errorf("unsupported database type: %s", cfg.Type)
+	// Get schema from the driver of the DB type
+	drv, err := db.GetDriver(cfg.Type)
+	if err != nil {
+		return 0, fmt.Errorf("unsupported database type: %w", err)
 	}
 
+	schema, err := drv.Introspect(ctx, cfg.Name)
 	if err != nil {
 		return 0, fmt.Errorf("error getting schema for %s: %w", cfg.Name, err)
 	}
@@ -0,0 +1,288 @@
+// Package examples keeps a curated set of question/query pairs that are
+// injected into system prompts as few-shot examples.
+package examples
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/vijaylingoju/prompterdb/llm"
+)
+
+// DefaultK is the number of examples selected per request when none is given
+const DefaultK = 3
+
+// Store holds few-shot examples and selects the ones most similar to a question
+type Store struct {
+	mu       sync.RWMutex
+	examples []llm.Example
+	vectors  [][]float64 // embeddings parallel to examples, filled lazily
+	embedder llm.Embedder
+	// generation counts SetEmbedder calls, so vectors of a replaced embedder are not stored
+	generation int
+	path       string // JSON Lines file that Record appends to
+}
+
+// NewStore creates an empty example store
+func NewStore() *Store {
+	return &Store{}
+}
+
+// SetEmbedder makes TopK rank examples by embedding similarity instead of word overlap
+func (s *Store) SetEmbedder(embedder llm.Embedder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.embedder = embedder
+	s.vectors = make([][]float64, len(s.examples))
+	s.generation++
+}
+
+// SetRecordFile sets the JSON Lines file that Record appends confirmed examples to
+func (s *Store) SetRecordFile(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.path = path
+}
+
+// Add adds an example to the store
+func (s *Store) Add(example llm.Example) error {
+	if strings.TrimSpace(example.Question) == "" || strings.TrimSpace(example.Query) == "" {
+		return errors.New("example requires a question and a query")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.examples = append(s.examples, example)
+	s.vectors = append(s.vectors, nil)
+	return nil
+}
+
+// Record adds a confirmed example and appends it to the record file, if one is set
+func (s *Store) Record(example llm.Example) error {
+	if err := s.Add(example); err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	path := s.path
+	s.mu.RUnlock()
+	if path == "" {
+		return nil
+	}
+
+	line, err := json.Marshal(example)
+	if err != nil {
+		return fmt.Errorf("failed to encode example: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open example file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write example file %s: %w", path, err)
+	}
+	return nil
+}
+
+// LoadFile loads examples from a JSON array (.json) or JSON Lines (.jsonl) file
+func (s *Store) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open example file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var loaded []llm.Example
+	if filepath.Ext(path) == ".jsonl" {
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for lineNo := 1; scanner.Scan(); lineNo++ {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			var example llm.Example
+			if err := json.Unmarshal([]byte(line), &example); err != nil {
+				return fmt.Errorf("invalid example at %s:%d: %w", path, lineNo, err)
+			}
+			loaded = append(loaded, example)
+		}
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("failed to read example file %s: %w", path, err)
+		}
+	} else if err := json.NewDecoder(f).Decode(&loaded); err != nil {
+		return fmt.Errorf("invalid example file %s: %w", path, err)
+	}
+
+	for i, example := range loaded {
+		if err := s.Add(example); err != nil {
+			return fmt.Errorf("invalid example %d in %s: %w", i+1, path, err)
+		}
+	}
+	return nil
+}
+
+// LoadDir loads every .json and .jsonl file in a directory tree
+func (s *Store) LoadDir(dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("error walking path %s: %w", path, err)
+		}
+		if info.IsDir() {
+			return nil
+		}
+		switch filepath.Ext(path) {
+		case ".json", ".jsonl":
+			return s.LoadFile(path)
+		}
+		return nil
+	})
+}
+
+// Len returns the number of examples in the store
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.examples)
+}
+
+// TopK returns the k examples most similar to question. Only examples whose
+// Database is empty or equal to one of databases are considered.
+func (s *Store) TopK(question string, k int, databases ...string) []llm.Example {
+	if k <= 0 {
+		k = DefaultK
+	}
+
+	// Copy the examples under the lock; embedding calls the network and runs without it
+	s.mu.RLock()
+	embedder, generation := s.embedder, s.generation
+	examples := s.examples[:len(s.examples):len(s.examples)]
+	vectors := append([][]float64(nil), s.vectors...)
+	s.mu.RUnlock()
+
+	var questionVector []float64
+	if embedder != nil {
+		vector, err := embedder.Embed(question)
+		if err != nil {
+			log.Printf("Warning: could not embed question, falling back to word overlap: %v", err)
+		} else {
+			questionVector = vector
+			s.embedMissing(embedder, generation, examples, vectors, databases)
+		}
+	}
+	questionWords := words(question)
+
+	type scored struct {
+		example llm.Example
+		score   float64
+	}
+	var candidates []scored
+	for i, example := range examples {
+		if !matchesDatabase(example.Database, databases) {
+			continue
+		}
+
+		var score float64
+		if questionVector != nil && vectors[i] != nil {
+			score = llm.CosineSimilarity(questionVector, vectors[i])
+		} else {
+			score = overlap(questionWords, words(example.Question))
+		}
+		if score > 0 {
+			candidates = append(candidates, scored{example, score})
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].score > candidates[j].score })
+	if len(candidates) > k {
+		candidates = candidates[:k]
+	}
+
+	selected := make([]llm.Example, len(candidates))
+	for i, c := range candidates {
+		selected[i] = c.example
+	}
+	return selected
+}
+
+// embedMissing computes the embeddings missing from vectors for the examples of
+// databases, without holding the lock, and stores them in the store unless the
+// embedder was replaced in the meantime
+func (s *Store) embedMissing(embedder llm.Embedder, generation int, examples []llm.Example, vectors [][]float64, databases []string) {
+	computed := make(map[int][]float64)
+	for i, example := range examples {
+		if vectors[i] != nil || !matchesDatabase(example.Database, databases) {
+			continue
+		}
+		vector, err := embedder.Embed(example.Question)
+		if err != nil {
+			log.Printf("Warning: could not embed example %q: %v", example.Question, err)
+			continue
+		}
+		vectors[i] = vector
+		computed[i] = vector
+	}
+	if len(computed) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.generation != generation {
+		return
+	}
+	for i, vector := range computed {
+		if s.vectors[i] == nil {
+			s.vectors[i] = vector
+		}
+	}
+}
+
+func matchesDatabase(database string, databases []string) bool {
+	if database == "" || len(databases) == 0 {
+		return true
+	}
+	for _, d := range databases {
+		if strings.EqualFold(database, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// words returns the set of lowercase words in text
+func words(text string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		set[word] = true
+	}
+	return set
+}
+
+// overlap returns the Jaccard similarity of two word sets
+func overlap(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for word := range a {
+		if b[word] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
@@ -0,0 +1,40 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+
+	"github.com/vijaylingoju/prompterdb/db"
+)
+
+// csvWriter writes a header row followed by one record per row
+type csvWriter struct {
+	w       *csv.Writer
+	columns int
+}
+
+func newCSVWriter(w io.Writer, columns []db.Column) (*csvWriter, error) {
+	cw := &csvWriter{w: csv.NewWriter(w), columns: len(columns)}
+	header := make([]string, len(columns))
+	for i, c := range columns {
+		header[i] = c.Name
+	}
+	if err := cw.w.Write(header); err != nil {
+		return nil, fmt.Errorf("failed to write CSV header: %w", err)
+	}
+	return cw, nil
+}
+
+func (cw *csvWriter) WriteRow(values []interface{}) error {
+	record := make([]string, cw.columns)
+	for i := 0; i < cw.columns && i < len(values); i++ {
+		record[i] = text(values[i])
+	}
+	return cw.w.Write(record)
+}
+
+func (cw *csvWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
@@ -0,0 +1,399 @@
+// Package export writes query results to CSV, JSON Lines, Parquet and Excel files.
+package export
+
+import (
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/vijaylingoju/prompterdb/db"
+)
+
+// Format is an export file format
+type Format string
+
+const (
+	CSV     Format = "csv"
+	NDJSON  Format = "ndjson" // JSON Lines, one object per row
+	Parquet Format = "parquet"
+	XLSX    Format = "xlsx"
+)
+
+// SampleSize is the number of rows WriteIterator reads before fixing the columns of a
+// CSV, Parquet or XLSX file. Document fields first seen after the sample are dropped.
+const SampleSize = 1000
+
+// ParseFormat returns the format for a name or file extension such as "csv" or ".jsonl"
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(strings.TrimPrefix(name, ".")) {
+	case "csv":
+		return CSV, nil
+	case "ndjson", "jsonl", "jsonlines":
+		return NDJSON, nil
+	case "parquet":
+		return Parquet, nil
+	case "xlsx", "excel":
+		return XLSX, nil
+	}
+	return "", fmt.Errorf("unsupported export format: %s", name)
+}
+
+// Extension returns the file extension of the format, including the dot
+func (f Format) Extension() string {
+	return "." + string(f)
+}
+
+// flattens reports whether nested documents are flattened into dotted columns
+func (f Format) flattens() bool {
+	return f != NDJSON
+}
+
+// Writer writes rows to an export file one at a time
+type Writer interface {
+	// WriteRow writes a row whose values are in the order of the writer's columns
+	WriteRow(values []interface{}) error
+	// Close finishes the file. It does not close the underlying io.Writer.
+	Close() error
+}
+
+// NewWriter creates a writer for rows with the given columns
+func NewWriter(w io.Writer, format Format, columns []db.Column) (Writer, error) {
+	switch format {
+	case CSV:
+		return newCSVWriter(w, columns)
+	case NDJSON:
+		return newNDJSONWriter(w, columns), nil
+	case Parquet:
+		return newParquetWriter(w, columns)
+	case XLSX:
+		return newXLSXWriter(w, columns)
+	}
+	return nil, fmt.Errorf("unsupported export format: %s", format)
+}
+
+// Write writes a result set. For every format except NDJSON, nested documents
+// are flattened into columns named with dotted paths.
+func Write(w io.Writer, format Format, rs *db.ResultSet) error {
+	if format.flattens() {
+		rs = Flatten(rs)
+	}
+	ew, err := NewWriter(w, format, rs.Columns)
+	if err != nil {
+		return err
+	}
+	for i, row := range rs.Rows {
+		if err := ew.WriteRow(row); err != nil {
+			ew.Close()
+			return fmt.Errorf("failed to write row %d: %w", i+1, err)
+		}
+	}
+	return ew.Close()
+}
+
+// WriteFile writes a result set to a file in the format given by its extension
+func WriteFile(path string, rs *db.ResultSet) error {
+	format, err := ParseFormat(filepath.Ext(path))
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create export file %s: %w", path, err)
+	}
+	if err := Write(f, format, rs); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WriteIterator streams the rows of it to w and returns the number of rows written.
+// It closes the iterator.
+func WriteIterator(w io.Writer, format Format, it db.RowIterator) (int64, error) {
+	defer it.Close()
+
+	// Collect a sample to fix the columns; documents may add fields from row to row
+	var sample db.ResultSet
+	index := map[string]int{}
+	for len(sample.Rows) < SampleSize && it.Next() {
+		sample.Rows = append(sample.Rows, mergeRow(&sample, index, it.Columns(), it.Values()))
+	}
+	if err := it.Err(); err != nil {
+		return 0, err
+	}
+	for i, row := range sample.Rows {
+		for len(row) < len(sample.Columns) {
+			row = append(row, nil)
+		}
+		sample.Rows[i] = row
+	}
+
+	out := &sample
+	if format.flattens() {
+		out = Flatten(&sample)
+	}
+	ew, err := NewWriter(w, format, out.Columns)
+	if err != nil {
+		return 0, err
+	}
+
+	var written int64
+	for _, row := range out.Rows {
+		if err := ew.WriteRow(row); err != nil {
+			ew.Close()
+			return written, fmt.Errorf("failed to write row %d: %w", written+1, err)
+		}
+		written++
+	}
+
+	positions := make(map[string]int, len(out.Columns))
+	for i, c := range out.Columns {
+		positions[c.Name] = i
+	}
+	dropped := map[string]bool{}
+	for it.Next() {
+		fields := map[string]interface{}{}
+		columns, values := it.Columns(), it.Values()
+		for i, c := range columns {
+			if format.flattens() {
+				flattenValue(c.Name, c.DBType, values[i], fields)
+			} else {
+				fields[c.Name] = values[i]
+			}
+		}
+
+		row := make([]interface{}, len(out.Columns))
+		for name, v := range fields {
+			if i, ok := positions[name]; ok {
+				row[i] = v
+			} else if !dropped[name] {
+				dropped[name] = true
+				log.Printf("Warning: field %s first appeared after the first %d rows and is not exported", name, SampleSize)
+			}
+		}
+		if err := ew.WriteRow(row); err != nil {
+			ew.Close()
+			return written, fmt.Errorf("failed to write row %d: %w", written+1, err)
+		}
+		written++
+	}
+	if err := it.Err(); err != nil {
+		ew.Close()
+		return written, err
+	}
+	return written, ew.Close()
+}
+
+// mergeRow aligns a row to the columns of rs, adding columns it has not seen yet
+func mergeRow(rs *db.ResultSet, index map[string]int, columns []db.Column, values []interface{}) []interface{} {
+	row := make([]interface{}, len(rs.Columns))
+	for i, c := range columns {
+		j, ok := index[c.Name]
+		if !ok {
+			j = len(rs.Columns)
+			index[c.Name] = j
+			rs.Columns = append(rs.Columns, c)
+			row = append(row, nil)
+		}
+		for len(row) <= j {
+			row = append(row, nil)
+		}
+		row[j] = values[i]
+	}
+	return row
+}
+
+// Flatten replaces document columns with one column per nested field, named with
+// its dotted path, e.g. address.city. Arrays and JSON columns are kept as they are.
+func Flatten(rs *db.ResultSet) *db.ResultSet {
+	nested := false
+	for _, c := range rs.Columns {
+		if c.DBType == "object" {
+			nested = true
+			break
+		}
+	}
+	if !nested {
+		return rs
+	}
+
+	flatRows := make([]map[string]interface{}, len(rs.Rows))
+	for i, row := range rs.Rows {
+		fields := map[string]interface{}{}
+		for j, c := range rs.Columns {
+			if j < len(row) {
+				flattenValue(c.Name, c.DBType, row[j], fields)
+			}
+		}
+		flatRows[i] = fields
+	}
+
+	out := &db.ResultSet{Truncated: rs.Truncated}
+	for _, c := range rs.Columns {
+		if c.DBType != "object" {
+			out.Columns = append(out.Columns, c)
+			continue
+		}
+		// nested fields, sorted since normalized documents carry no order
+		var names []string
+		seen := map[string]bool{}
+		for _, fields := range flatRows {
+			for name := range fields {
+				if strings.HasPrefix(name, c.Name+".") && !seen[name] {
+					seen[name] = true
+					names = append(names, name)
+				}
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			column := db.Column{Name: name, DBType: "unknown", Type: db.TypeString}
+			for _, fields := range flatRows {
+				if v := fields[name]; v != nil {
+					column.DBType, column.Type = db.InferType(v)
+					break
+				}
+			}
+			out.Columns = append(out.Columns, column)
+		}
+	}
+
+	for _, fields := range flatRows {
+		row := make([]interface{}, len(out.Columns))
+		for i, c := range out.Columns {
+			row[i] = fields[c.Name]
+		}
+		out.Rows = append(out.Rows, row)
+	}
+	return out
+}
+
+// flattenValue stores v under name, expanding documents into dotted paths
+func flattenValue(name, dbType string, v interface{}, fields map[string]interface{}) {
+	doc, ok := v.(map[string]interface{})
+	if !ok || dbType != "object" {
+		fields[name] = v
+		return
+	}
+	for key, child := range doc {
+		childType := ""
+		if _, isDoc := child.(map[string]interface{}); isDoc {
+			childType = "object"
+		}
+		flattenValue(name+"."+key, childType, child, fields)
+	}
+}
+
+// normalize converts driver values to plain Go values: nil, string, bool, int64, float64,
+// json.Number, time.Time, maps and slices
+func normalize(v interface{}) interface{} {
+	switch x := v.(type) {
+	case nil, string, bool, int64, float64, json.Number, time.Time:
+		return v
+	case int:
+		return int64(x)
+	case int8:
+		return int64(x)
+	case int16:
+		return int64(x)
+	case int32:
+		return int64(x)
+	case uint8:
+		return int64(x)
+	case uint16:
+		return int64(x)
+	case uint32:
+		return int64(x)
+	case uint64:
+		return strconv.FormatUint(x, 10)
+	case float32:
+		return float64(x)
+	case []byte:
+		return base64.StdEncoding.EncodeToString(x)
+	case [16]byte:
+		// uuid
+		return fmt.Sprintf("%x-%x-%x-%x-%x", x[0:4], x[4:6], x[6:8], x[8:10], x[10:16])
+	case pgtype.Numeric:
+		value, err := x.Value()
+		s, ok := value.(string)
+		if err != nil || !ok {
+			return nil
+		}
+		if x.NaN || x.InfinityModifier != pgtype.Finite {
+			return s
+		}
+		// keep the exact decimal instead of rounding through float64
+		return json.Number(s)
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(x))
+		for k, child := range x {
+			m[k] = normalize(child)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(x))
+		for i, child := range x {
+			s[i] = normalize(child)
+		}
+		return s
+	case driver.Valuer:
+		value, err := x.Value()
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return normalize(value)
+	case fmt.Stringer:
+		return x.String()
+	}
+	return v
+}
+
+// text formats a value for a text cell
+func text(v interface{}) string {
+	switch x := normalize(v).(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case json.Number:
+		return string(x)
+	case time.Time:
+		return x.Format(time.RFC3339Nano)
+	case bool:
+		return strconv.FormatBool(x)
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(x)
+		if err != nil {
+			return fmt.Sprint(x)
+		}
+		return string(data)
+	default:
+		return fmt.Sprint(x)
+	}
+}
+
+// timeValue converts a time value, or an RFC 3339 string as MongoDB dates are normalized to
+func timeValue(v interface{}) (time.Time, bool) {
+	switch x := normalize(v).(type) {
+	case time.Time:
+		return x, true
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, x)
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,58 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/vijaylingoju/prompterdb/db"
+)
+
+// ndjsonWriter writes one JSON object per line, with keys in column order
+type ndjsonWriter struct {
+	w       *bufio.Writer
+	columns []db.Column
+	buf     bytes.Buffer
+}
+
+func newNDJSONWriter(w io.Writer, columns []db.Column) *ndjsonWriter {
+	return &ndjsonWriter{w: bufio.NewWriter(w), columns: columns}
+}
+
+func (nw *ndjsonWriter) WriteRow(values []interface{}) error {
+	nw.buf.Reset()
+	nw.buf.WriteByte('{')
+	for i, c := range nw.columns {
+		if i > 0 {
+			nw.buf.WriteByte(',')
+		}
+		key, err := json.Marshal(c.Name)
+		if err != nil {
+			return err
+		}
+		nw.buf.Write(key)
+		nw.buf.WriteByte(':')
+
+		var v interface{}
+		if i < len(values) {
+			v = normalize(values[i])
+		}
+		if t, ok := v.(time.Time); ok {
+			v = t.Format(time.RFC3339Nano)
+		}
+		value, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		nw.buf.Write(value)
+	}
+	nw.buf.WriteString("}\n")
+	_, err := nw.w.Write(nw.buf.Bytes())
+	return err
+}
+
+func (nw *ndjsonWriter) Close() error {
+	return nw.w.Flush()
+}
@@ -0,0 +1,213 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/vijaylingoju/prompterdb/db"
+)
+
+// parquetKind is how the values of a column are stored in Parquet
+type parquetKind int
+
+const (
+	parquetString parquetKind = iota
+	parquetJSON
+	parquetInt64
+	parquetDouble
+	parquetBool
+	parquetTimestamp
+)
+
+// parquetRowGroupSize is the number of rows buffered before a row group is written
+const parquetRowGroupSize = 10000
+
+// parquetWriter writes rows to a Parquet file with one optional column per result column.
+// Parquet orders the columns of a schema by name.
+type parquetWriter struct {
+	w       *parquet.Writer
+	kinds   []parquetKind
+	leaf    []int // position of each result column among the Parquet columns
+	names   []string
+	pending []parquet.Row
+}
+
+func newParquetWriter(w io.Writer, columns []db.Column) (*parquetWriter, error) {
+	group := parquet.Group{}
+	kinds := make([]parquetKind, len(columns))
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		if _, exists := group[c.Name]; exists {
+			return nil, fmt.Errorf("duplicate column name %s", c.Name)
+		}
+		kinds[i] = parquetKindOf(c)
+		names[i] = c.Name
+		group[c.Name] = parquet.Optional(parquetNode(kinds[i]))
+	}
+
+	schema := parquet.NewSchema("result", group)
+	leaf := make([]int, len(columns))
+	for i, name := range names {
+		column, ok := schema.Lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("column %s missing from Parquet schema", name)
+		}
+		leaf[i] = column.ColumnIndex
+	}
+
+	return &parquetWriter{
+		w:     parquet.NewWriter(w, schema),
+		kinds: kinds,
+		leaf:  leaf,
+		names: names,
+	}, nil
+}
+
+// parquetKindOf chooses the Parquet storage for a column. Decimals are stored as
+// strings so no precision is lost.
+func parquetKindOf(c db.Column) parquetKind {
+	switch c.Type {
+	case db.TypeNumber:
+		switch c.DBType {
+		case "int2", "int4", "int8", "oid", "int", "long":
+			return parquetInt64
+		case "numeric", "decimal", "money":
+			return parquetString
+		}
+		return parquetDouble
+	case db.TypeBool:
+		return parquetBool
+	case db.TypeTime:
+		if c.DBType == "time" || c.DBType == "timetz" {
+			return parquetString // time of day
+		}
+		return parquetTimestamp
+	case db.TypeJSON:
+		return parquetJSON
+	}
+	return parquetString
+}
+
+func parquetNode(kind parquetKind) parquet.Node {
+	switch kind {
+	case parquetInt64:
+		return parquet.Leaf(parquet.Int64Type)
+	case parquetDouble:
+		return parquet.Leaf(parquet.DoubleType)
+	case parquetBool:
+		return parquet.Leaf(parquet.BooleanType)
+	case parquetTimestamp:
+		return parquet.Timestamp(parquet.Microsecond)
+	case parquetJSON:
+		return parquet.JSON()
+	}
+	return parquet.String()
+}
+
+func (pw *parquetWriter) WriteRow(values []interface{}) error {
+	row := make(parquet.Row, len(pw.kinds))
+	for i, kind := range pw.kinds {
+		var v interface{}
+		if i < len(values) {
+			v = normalize(values[i])
+		}
+		value, err := parquetValue(kind, v)
+		if err != nil {
+			return fmt.Errorf("column %s: %w", pw.names[i], err)
+		}
+		if value.IsNull() {
+			row[pw.leaf[i]] = value.Level(0, 0, pw.leaf[i])
+		} else {
+			row[pw.leaf[i]] = value.Level(0, 1, pw.leaf[i])
+		}
+	}
+
+	pw.pending = append(pw.pending, row)
+	if len(pw.pending) >= parquetRowGroupSize {
+		return pw.flush()
+	}
+	return nil
+}
+
+func (pw *parquetWriter) flush() error {
+	if len(pw.pending) == 0 {
+		return nil
+	}
+	if _, err := pw.w.WriteRows(pw.pending); err != nil {
+		return fmt.Errorf("failed to write Parquet rows: %w", err)
+	}
+	pw.pending = pw.pending[:0]
+	return nil
+}
+
+func (pw *parquetWriter) Close() error {
+	if err := pw.flush(); err != nil {
+		return err
+	}
+	return pw.w.Close()
+}
+
+// parquetValue converts a normalized value to the Parquet value of a column
+func parquetValue(kind parquetKind, v interface{}) (parquet.Value, error) {
+	if v == nil {
+		return parquet.NullValue(), nil
+	}
+
+	switch kind {
+	case parquetInt64:
+		switch n := v.(type) {
+		case int64:
+			return parquet.Int64Value(n), nil
+		case float64:
+			if n == math.Trunc(n) {
+				return parquet.Int64Value(int64(n)), nil
+			}
+		case json.Number:
+			if i, err := n.Int64(); err == nil {
+				return parquet.Int64Value(i), nil
+			}
+		case string:
+			if i, err := strconv.ParseInt(n, 10, 64); err == nil {
+				return parquet.Int64Value(i), nil
+			}
+		}
+		return parquet.Value{}, fmt.Errorf("cannot store %v (%T) as an integer", v, v)
+	case parquetDouble:
+		switch n := v.(type) {
+		case float64:
+			return parquet.DoubleValue(n), nil
+		case int64:
+			return parquet.DoubleValue(float64(n)), nil
+		case json.Number:
+			if f, err := n.Float64(); err == nil {
+				return parquet.DoubleValue(f), nil
+			}
+		case string:
+			if f, err := strconv.ParseFloat(n, 64); err == nil {
+				return parquet.DoubleValue(f), nil
+			}
+		}
+		return parquet.Value{}, fmt.Errorf("cannot store %v (%T) as a number", v, v)
+	case parquetBool:
+		if b, ok := v.(bool); ok {
+			return parquet.BooleanValue(b), nil
+		}
+		return parquet.Value{}, fmt.Errorf("cannot store %v (%T) as a boolean", v, v)
+	case parquetTimestamp:
+		if t, ok := timeValue(v); ok {
+			return parquet.Int64Value(t.UnixMicro()), nil
+		}
+		return parquet.Value{}, fmt.Errorf("cannot store %v (%T) as a timestamp", v, v)
+	case parquetJSON:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return parquet.Value{}, err
+		}
+		return parquet.ByteArrayValue(data), nil
+	}
+	return parquet.ByteArrayValue([]byte(text(v))), nil
+}
@@ -0,0 +1,117 @@
+package export
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/vijaylingoju/prompterdb/db"
+	"github.com/xuri/excelize/v2"
+)
+
+// xlsxSheet is the name of the worksheet results are written to
+const xlsxSheet = "Results"
+
+// xlsxWriter streams rows into a single worksheet. The workbook is written to the
+// output when the writer is closed.
+type xlsxWriter struct {
+	out       io.Writer
+	file      *excelize.File
+	stream    *excelize.StreamWriter
+	columns   []db.Column
+	row       int
+	dateStyle int
+}
+
+func newXLSXWriter(w io.Writer, columns []db.Column) (*xlsxWriter, error) {
+	f := excelize.NewFile()
+	if err := f.SetSheetName("Sheet1", xlsxSheet); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to create worksheet: %w", err)
+	}
+	dateFormat := "yyyy-mm-dd hh:mm:ss"
+	dateStyle, err := f.NewStyle(&excelize.Style{CustomNumFmt: &dateFormat})
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to create date style: %w", err)
+	}
+	stream, err := f.NewStreamWriter(xlsxSheet)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to create worksheet writer: %w", err)
+	}
+
+	xw := &xlsxWriter{out: w, file: f, stream: stream, columns: columns, row: 1, dateStyle: dateStyle}
+	header := make([]interface{}, len(columns))
+	for i, c := range columns {
+		header[i] = c.Name
+	}
+	if err := xw.setRow(header); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return xw, nil
+}
+
+func (xw *xlsxWriter) WriteRow(values []interface{}) error {
+	if xw.row > excelize.TotalRows {
+		return errors.New("result exceeds the maximum number of rows in a worksheet")
+	}
+	cells := make([]interface{}, len(xw.columns))
+	for i := range xw.columns {
+		if i < len(values) {
+			cells[i] = xw.cell(xw.columns[i], values[i])
+		}
+	}
+	return xw.setRow(cells)
+}
+
+// cell converts a value to a worksheet cell. Dates get a date format; decimals are
+// stored as numbers when they fit a float64 and as text otherwise.
+func (xw *xlsxWriter) cell(c db.Column, v interface{}) interface{} {
+	if c.Type == db.TypeTime {
+		if t, ok := timeValue(v); ok {
+			return excelize.Cell{StyleID: xw.dateStyle, Value: t.UTC()}
+		}
+	}
+	switch x := normalize(v).(type) {
+	case nil:
+		return nil
+	case string, bool, int64, float64:
+		return x
+	case json.Number:
+		if f, err := x.Float64(); err == nil {
+			return f
+		}
+		return string(x)
+	case time.Time:
+		return excelize.Cell{StyleID: xw.dateStyle, Value: x.UTC()}
+	default:
+		return text(x)
+	}
+}
+
+func (xw *xlsxWriter) setRow(cells []interface{}) error {
+	name, err := excelize.CoordinatesToCellName(1, xw.row)
+	if err != nil {
+		return err
+	}
+	if err := xw.stream.SetRow(name, cells); err != nil {
+		return fmt.Errorf("failed to write worksheet row %d: %w", xw.row, err)
+	}
+	xw.row++
+	return nil
+}
+
+func (xw *xlsxWriter) Close() error {
+	defer xw.file.Close()
+	if err := xw.stream.Flush(); err != nil {
+		return fmt.Errorf("failed to finish worksheet: %w", err)
+	}
+	if err := xw.file.Write(xw.out); err != nil {
+		return fmt.Errorf("failed to write workbook: %w", err)
+	}
+	return nil
+}
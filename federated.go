@@ -0,0 +1,511 @@
+package prompterdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/vijaylingoju/prompterdb/config"
+	"github.com/vijaylingoju/prompterdb/db"
+	"github.com/vijaylingoju/prompterdb/llm"
+	"github.com/vijaylingoju/prompterdb/templates"
+)
+
+// maxPlanSteps is the largest number of sub-queries a federated plan may have
+const maxPlanSteps = 8
+
+// FederatedPlan is how a prompt spanning several databases is answered: one sub-query
+// per step, whose results are joined in memory
+type FederatedPlan struct {
+	Steps []*PlanStep `json:"steps"`
+	Joins []*PlanJoin `json:"joins,omitempty"`
+	// Merge appends the step results instead of joining them, e.g. for the same
+	// kind of record kept in several databases
+	Merge bool `json:"merge,omitempty"`
+}
+
+// PlanStep is a sub-question answered by one database
+type PlanStep struct {
+	Name     string `json:"name"` // how joins refer to the step's result
+	Database string `json:"database"`
+	Prompt   string `json:"prompt"`
+
+	// Set once the step has run
+	Query     string `json:"query,omitempty"`
+	Rows      int    `json:"rows,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// PlanJoin joins the result of the Right step to the rows joined so far, which
+// include the Left step. Rows of the left side without a match are kept unless Type is "inner".
+type PlanJoin struct {
+	Left     string `json:"left"`
+	Right    string `json:"right"`
+	LeftKey  string `json:"left_key"`
+	RightKey string `json:"right_key"`
+	Type     string `json:"type,omitempty"`   // "left" (default) or "inner"
+	Source   string `json:"source,omitempty"` // how the keys were found: "plan", "declared" or "inferred"
+}
+
+// JoinKey declares that a column of one database's results refers to a column of another's,
+// e.g. orders.customer_id in Postgres to _id of the customers collection in Mongo
+type JoinKey struct {
+	LeftDatabase  string
+	LeftColumn    string
+	RightDatabase string
+	RightColumn   string
+}
+
+// FederatedResult is the outcome of an AskFederated call
+type FederatedResult struct {
+	Prompt string
+	Plan   *FederatedPlan
+	Rows   []map[string]interface{}
+	// Result holds the joined rows with ordered, typed columns
+	Result *db.ResultSet
+	// Steps holds the result of each step, in plan order
+	Steps []*AskResult
+	// Truncated reports that a step had more rows than were read, so the join may be incomplete
+	Truncated bool
+	Usage     llm.Usage // tokens consumed by planning and by every step
+	Cost      float64
+}
+
+// PlanFederated asks the LLM to split a prompt into sub-questions, one per database,
+// and how to join their results. The plan is validated but not run.
+func PlanFederated(ctx context.Context, userPrompt string, llmClient llm.LLM, opts AskOptions) (*FederatedPlan, error) {
+	if _, err := useDefaultTemplates(llmClient); err != nil {
+		return nil, err
+	}
+	plan, _, err := planFederated(ctx, userPrompt, llmClient, opts)
+	return plan, err
+}
+
+// AskFederated answers a prompt that needs data from several databases, e.g. orders
+// from Postgres with customer profiles from Mongo. The planned sub-queries are generated,
+// validated and run like Ask queries, and their results are joined on the keys named by
+// the plan, declared in opts.JoinKeys, or inferred from column names, in that order.
+// Prompts that need a single database are answered by that database alone.
+func AskFederated(ctx context.Context, userPrompt string, llmClient llm.LLM, opts AskOptions) (*FederatedResult, error) {
+	tm, err := useDefaultTemplates(llmClient)
+	if err != nil {
+		return nil, err
+	}
+	plan, planResult, err := planFederated(ctx, userPrompt, llmClient, opts)
+	if err != nil {
+		return nil, err
+	}
+	result := &FederatedResult{Prompt: userPrompt, Plan: plan, Usage: planResult.Usage, Cost: planResult.Cost}
+
+	steps := make(map[string]*db.ResultSet, len(plan.Steps))
+	for _, step := range plan.Steps {
+		stepResult, err := runPlanStep(ctx, step, tm, llmClient, opts)
+		if err != nil {
+			return nil, fmt.Errorf("step %s on %s failed: %w", step.Name, step.Database, err)
+		}
+		result.Steps = append(result.Steps, stepResult)
+		result.Usage = result.Usage.Add(stepResult.Usage)
+		result.Cost += stepResult.Cost
+		result.Truncated = result.Truncated || step.Truncated
+		steps[step.Name] = stepResult.Result
+	}
+	if result.Truncated {
+		log.Printf("Warning: a step of the federated query returned more than %d rows, the joined result may be incomplete", maxStepRows(opts))
+	}
+
+	if err := resolveJoinKeys(plan, steps, opts.JoinKeys); err != nil {
+		return nil, err
+	}
+	rs, err := joinSteps(plan, steps)
+	if err != nil {
+		return nil, err
+	}
+	result.Result = rs
+	result.Rows = rs.Maps()
+	return result, nil
+}
+
+// planFederated generates and validates the plan of a prompt with the templates of llmClient
+func planFederated(ctx context.Context, userPrompt string, llmClient llm.LLM, opts AskOptions) (*FederatedPlan, *AskResult, error) {
+	if userPrompt == "" {
+		return nil, nil, errors.New("prompt is empty")
+	}
+	schema := GetAllSchemas()
+	if schema == "" {
+		return nil, nil, errors.New("schema is empty – call IntrospectAllSchemas() first")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	req := llm.QueryRequest{
+		Prompt:    userPrompt,
+		Schema:    schema,
+		DBType:    "federated",
+		QueryType: llm.QueryTypePlan,
+		CustomVars: map[string]interface{}{
+			"Databases": planDatabases(),
+			"JoinKeys":  opts.JoinKeys,
+		},
+	}
+	planResult := &AskResult{Prompt: userPrompt}
+	resp, err := generateQuery(ctx, llmClient, req, opts, planResult)
+	if err != nil {
+		return nil, nil, fmt.Errorf("llm planning failed: %w", err)
+	}
+
+	plan, err := ParseFederatedPlan(cleanMongoText(resp.Query))
+	if err != nil {
+		return nil, nil, err
+	}
+	return plan, planResult, nil
+}
+
+// planDatabase describes a registered database to the planner
+type planDatabase struct {
+	Name string
+	Type config.DBType
+}
+
+// planDatabases returns the registered databases, ordered by name
+func planDatabases() []planDatabase {
+	dbs := make([]planDatabase, 0, len(config.RegisteredDBs))
+	for name, cfg := range config.RegisteredDBs {
+		dbs = append(dbs, planDatabase{Name: name, Type: cfg.Type})
+	}
+	sort.Slice(dbs, func(i, j int) bool { return dbs[i].Name < dbs[j].Name })
+	return dbs
+}
+
+// ParseFederatedPlan parses a plan written by the LLM and checks that its steps use
+// registered databases and its joins refer to its steps. Steps without a name are
+// named after their database; two steps with the same name are an error.
+func ParseFederatedPlan(text string) (*FederatedPlan, error) {
+	var plan FederatedPlan
+	if err := json.Unmarshal([]byte(text), &plan); err != nil {
+		return nil, fmt.Errorf("invalid federated plan: %w\nRaw response: %s", err, text)
+	}
+	if len(plan.Steps) == 0 {
+		return nil, errors.New("federated plan has no steps")
+	}
+	if len(plan.Steps) > maxPlanSteps {
+		return nil, fmt.Errorf("federated plan has %d steps, at most %d are allowed", len(plan.Steps), maxPlanSteps)
+	}
+
+	names := make(map[string]bool, len(plan.Steps))
+	for i, step := range plan.Steps {
+		if step == nil || strings.TrimSpace(step.Prompt) == "" {
+			return nil, fmt.Errorf("step %d of the federated plan has no prompt", i+1)
+		}
+		if _, ok := config.RegisteredDBs[step.Database]; !ok {
+			return nil, fmt.Errorf("step %d of the federated plan uses unregistered database %q", i+1, step.Database)
+		}
+		if step.Name == "" {
+			step.Name = step.Database
+		}
+		if names[step.Name] {
+			return nil, fmt.Errorf("step %d of the federated plan reuses the step name %q", i+1, step.Name)
+		}
+		names[step.Name] = true
+	}
+
+	joined := map[string]bool{plan.Steps[0].Name: true}
+	for i, join := range plan.Joins {
+		if join == nil {
+			return nil, fmt.Errorf("join %d of the federated plan is empty", i+1)
+		}
+		if !names[join.Left] || !names[join.Right] {
+			return nil, fmt.Errorf("join %d of the federated plan refers to unknown steps %q and %q", i+1, join.Left, join.Right)
+		}
+		if !joined[join.Left] || joined[join.Right] {
+			return nil, fmt.Errorf("join %d of the federated plan must join a new step %q to joined step %q", i+1, join.Right, join.Left)
+		}
+		joined[join.Right] = true
+		switch join.Type {
+		case "":
+			join.Type = "left"
+		case "left", "inner":
+		default:
+			return nil, fmt.Errorf("join %d of the federated plan has unsupported type %q", i+1, join.Type)
+		}
+		if join.LeftKey != "" && join.RightKey != "" {
+			join.Source = "plan"
+		}
+	}
+
+	if plan.Merge {
+		plan.Joins = nil
+		return &plan, nil
+	}
+	// Join steps the plan left unconnected to the one before them, on keys found later
+	for i, step := range plan.Steps[1:] {
+		if !joined[step.Name] {
+			plan.Joins = append(plan.Joins, &PlanJoin{Left: plan.Steps[i].Name, Right: step.Name, Type: "left"})
+			joined[step.Name] = true
+		}
+	}
+	return &plan, nil
+}
+
+// maxStepRows returns the number of rows read from each database of a federated query
+func maxStepRows(opts AskOptions) int {
+	if opts.MaxStepRows > 0 {
+		return opts.MaxStepRows
+	}
+	return 10 * db.RowLimit()
+}
+
+// runPlanStep generates and runs the query of a step, reading its pages up to maxStepRows
+func runPlanStep(ctx context.Context, step *PlanStep, tm *templates.TemplateManager, llmClient llm.LLM, opts AskOptions) (*AskResult, error) {
+	targetDB := config.RegisteredDBs[step.Database]
+	// Steps are written by the planner, there is no user to ask
+	opts.AllowClarification = false
+	stepResult, err := askDatabase(ctx, step.Prompt, targetDB, GetSchema(targetDB.Name), tm, llmClient, opts)
+	if err != nil {
+		return nil, err
+	}
+	if stepResult.Result == nil {
+		stepResult.Result = db.NewResultSet(stepResult.Rows)
+	}
+
+	limit := maxStepRows(opts)
+	rs := stepResult.Result
+	for token := stepResult.NextPageToken; token != "" && len(rs.Rows) < limit; {
+		page, err := FetchPage(ctx, token, opts)
+		if err != nil {
+			return nil, err
+		}
+		rs.Rows = append(rs.Rows, page.Result.Rows...)
+		rs.Truncated = page.Truncated
+		token = page.NextPageToken
+	}
+	stepResult.Rows = rs.Maps()
+	stepResult.Truncated = rs.Truncated
+	stepResult.NextPageToken = ""
+
+	step.Query = stepResult.Query
+	step.Rows = len(rs.Rows)
+	step.Truncated = rs.Truncated
+	return stepResult, nil
+}
+
+// resolveJoinKeys fills in the keys of joins the plan gave none for, or gave keys
+// that are not columns of the step results
+func resolveJoinKeys(plan *FederatedPlan, steps map[string]*db.ResultSet, declared []JoinKey) error {
+	databases := make(map[string]string, len(plan.Steps))
+	for _, step := range plan.Steps {
+		databases[step.Name] = step.Database
+	}
+
+	for _, join := range plan.Joins {
+		left, right := steps[join.Left], steps[join.Right]
+		if join.Source == "plan" {
+			if left.ColumnIndex(join.LeftKey) >= 0 && right.ColumnIndex(join.RightKey) >= 0 {
+				continue
+			}
+			log.Printf("Warning: join keys %s.%s and %s.%s of the plan are not columns of the results, inferring others",
+				join.Left, join.LeftKey, join.Right, join.RightKey)
+		}
+
+		if key, ok := declaredJoinKey(declared, databases[join.Left], databases[join.Right], left, right); ok {
+			join.LeftKey, join.RightKey, join.Source = key[0], key[1], "declared"
+			continue
+		}
+		leftKey, rightKey, ok := inferJoinKey(join.Left, join.Right, left, right)
+		if !ok {
+			return fmt.Errorf("could not find columns to join steps %s and %s on", join.Left, join.Right)
+		}
+		join.LeftKey, join.RightKey, join.Source = leftKey, rightKey, "inferred"
+	}
+	return nil
+}
+
+// declaredJoinKey returns the first declared key between the databases of two steps
+// whose columns are in their results
+func declaredJoinKey(declared []JoinKey, leftDB, rightDB string, left, right *db.ResultSet) ([2]string, bool) {
+	for _, k := range declared {
+		switch {
+		case k.LeftDatabase == leftDB && k.RightDatabase == rightDB:
+			if left.ColumnIndex(k.LeftColumn) >= 0 && right.ColumnIndex(k.RightColumn) >= 0 {
+				return [2]string{k.LeftColumn, k.RightColumn}, true
+			}
+		case k.LeftDatabase == rightDB && k.RightDatabase == leftDB:
+			if left.ColumnIndex(k.RightColumn) >= 0 && right.ColumnIndex(k.LeftColumn) >= 0 {
+				return [2]string{k.RightColumn, k.LeftColumn}, true
+			}
+		}
+	}
+	return [2]string{}, false
+}
+
+// inferJoinKey guesses the columns two step results are related by: a foreign key
+// named after the other step, such as customer_id referring to customers.id or _id.
+// Other shared columns, such as name, are not guessed at.
+func inferJoinKey(leftName, rightName string, left, right *db.ResultSet) (string, string, bool) {
+	if l, r, ok := foreignKey(left, rightName, right); ok {
+		return l, r, true
+	}
+	if r, l, ok := foreignKey(right, leftName, left); ok {
+		return l, r, true
+	}
+	return "", "", false
+}
+
+// foreignKey finds a column of from, such as customer_id, that refers to the id of
+// the step named to, such as customers
+func foreignKey(from *db.ResultSet, to string, target *db.ResultSet) (string, string, bool) {
+	targetKey := ""
+	for _, k := range []string{"id", "_id"} {
+		if target.ColumnIndex(k) >= 0 {
+			targetKey = k
+			break
+		}
+	}
+	if targetKey == "" {
+		return "", "", false
+	}
+	singular := strings.TrimSuffix(strings.ToLower(to), "s")
+	for _, candidate := range []string{singular + "_id", strings.ToLower(to) + "_id"} {
+		for _, c := range from.Columns {
+			if strings.ToLower(c.Name) == candidate {
+				return c.Name, targetKey, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// joinSteps joins the step results along the joins of the plan. The results of a
+// merge plan are appended, with a step column telling which step each row came from.
+func joinSteps(plan *FederatedPlan, steps map[string]*db.ResultSet) (*db.ResultSet, error) {
+	first := steps[plan.Steps[0].Name]
+	if len(plan.Steps) == 1 {
+		return first, nil
+	}
+	if plan.Merge {
+		return mergeSteps(plan, steps), nil
+	}
+
+	joined := &db.ResultSet{Columns: append([]db.Column(nil), first.Columns...)}
+	for _, row := range first.Rows {
+		joined.Rows = append(joined.Rows, append([]interface{}(nil), row...))
+	}
+	joined.Truncated = first.Truncated
+
+	// columns[step][column] is the index of a step's column in the joined rows
+	columns := map[string]map[string]int{plan.Steps[0].Name: columnIndexes(first, 0)}
+	for _, join := range plan.Joins {
+		right := steps[join.Right]
+		leftIndex, ok := columns[join.Left][join.LeftKey]
+		if !ok {
+			return nil, fmt.Errorf("join key %s is not a column of step %s", join.LeftKey, join.Left)
+		}
+		rightIndex := right.ColumnIndex(join.RightKey)
+		if rightIndex < 0 {
+			return nil, fmt.Errorf("join key %s is not a column of step %s", join.RightKey, join.Right)
+		}
+
+		offset := len(joined.Columns)
+		columns[join.Right] = columnIndexes(right, offset)
+		for _, c := range right.Columns {
+			if joined.ColumnIndex(c.Name) >= 0 {
+				c.Name = join.Right + "." + c.Name
+			}
+			joined.Columns = append(joined.Columns, c)
+		}
+
+		matches := make(map[string][][]interface{}, len(right.Rows))
+		for _, row := range right.Rows {
+			if k, ok := joinKeyValue(row[rightIndex]); ok {
+				matches[k] = append(matches[k], row)
+			}
+		}
+
+		var rows [][]interface{}
+		for _, row := range joined.Rows {
+			k, ok := joinKeyValue(row[leftIndex])
+			found := matches[k]
+			if !ok || len(found) == 0 {
+				if join.Type != "inner" {
+					rows = append(rows, append(row, make([]interface{}, len(right.Columns))...))
+				}
+				continue
+			}
+			for _, match := range found {
+				combined := make([]interface{}, 0, len(joined.Columns))
+				combined = append(append(combined, row...), match...)
+				rows = append(rows, combined)
+			}
+		}
+		joined.Rows = rows
+		joined.Truncated = joined.Truncated || right.Truncated
+	}
+	return joined, nil
+}
+
+// columnIndexes maps the columns of rs to their index in joined rows, which start at offset
+func columnIndexes(rs *db.ResultSet, offset int) map[string]int {
+	indexes := make(map[string]int, len(rs.Columns))
+	for i, c := range rs.Columns {
+		indexes[c.Name] = offset + i
+	}
+	return indexes
+}
+
+// mergeSteps appends the rows of every step, with the union of their columns
+func mergeSteps(plan *FederatedPlan, steps map[string]*db.ResultSet) *db.ResultSet {
+	merged := &db.ResultSet{Columns: []db.Column{{Name: "step", DBType: "text", Type: db.TypeString}}}
+	for _, step := range plan.Steps {
+		rs := steps[step.Name]
+		index := make([]int, len(rs.Columns))
+		for i, c := range rs.Columns {
+			index[i] = merged.ColumnIndex(c.Name)
+			if index[i] < 0 {
+				index[i] = len(merged.Columns)
+				merged.Columns = append(merged.Columns, c)
+			}
+		}
+		for _, row := range rs.Rows {
+			out := make([]interface{}, len(merged.Columns))
+			out[0] = step.Name
+			for i, v := range row {
+				out[index[i]] = v
+			}
+			merged.Rows = append(merged.Rows, out)
+		}
+		merged.Truncated = merged.Truncated || rs.Truncated
+	}
+	for i, row := range merged.Rows {
+		if len(row) < len(merged.Columns) {
+			merged.Rows[i] = append(row, make([]interface{}, len(merged.Columns)-len(row))...)
+		}
+	}
+	return merged
+}
+
+// joinKeyValue returns the value of a join key as a string, so keys of different
+// databases match: integral numbers of any type, and ObjectIDs by their hex form
+func joinKeyValue(v interface{}) (string, bool) {
+	switch x := v.(type) {
+	case nil:
+		return "", false
+	case string:
+		return x, true
+	case []byte:
+		return string(x), true
+	case interface{ Hex() string }:
+		return x.Hex(), true
+	case float32:
+		return joinKeyValue(float64(x))
+	case float64:
+		if x == math.Trunc(x) && math.Abs(x) < 1<<53 {
+			return fmt.Sprint(int64(x)), true
+		}
+	}
+	return fmt.Sprint(v), true
+}
@@ -0,0 +1,287 @@
+package prompterdb
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vijaylingoju/prompterdb/config"
+	"github.com/vijaylingoju/prompterdb/db"
+)
+
+// resultSet builds a result set with untyped columns and the given rows
+func resultSet(columns []string, rows ...[]interface{}) *db.ResultSet {
+	rs := &db.ResultSet{Rows: rows}
+	for _, name := range columns {
+		rs.Columns = append(rs.Columns, db.Column{Name: name})
+	}
+	return rs
+}
+
+func columnNames(rs *db.ResultSet) []string {
+	names := make([]string, len(rs.Columns))
+	for i, c := range rs.Columns {
+		names[i] = c.Name
+	}
+	return names
+}
+
+func TestInferJoinKey(t *testing.T) {
+	tests := []struct {
+		name              string
+		leftName          string
+		rightName         string
+		left, right       *db.ResultSet
+		leftKey, rightKey string
+		ok                bool
+	}{
+		{
+			name:     "foreign key on the left",
+			leftName: "orders", rightName: "customers",
+			left:    resultSet([]string{"id", "customer_id", "total"}),
+			right:   resultSet([]string{"id", "name"}),
+			leftKey: "customer_id", rightKey: "id", ok: true,
+		},
+		{
+			name:     "foreign key on the right",
+			leftName: "customers", rightName: "orders",
+			left:    resultSet([]string{"id", "name"}),
+			right:   resultSet([]string{"id", "customer_id"}),
+			leftKey: "id", rightKey: "customer_id", ok: true,
+		},
+		{
+			name:     "mongo _id",
+			leftName: "orders", rightName: "customers",
+			left:    resultSet([]string{"customer_id"}),
+			right:   resultSet([]string{"_id", "name"}),
+			leftKey: "customer_id", rightKey: "_id", ok: true,
+		},
+		{
+			name:     "step name ending in s",
+			leftName: "orders", rightName: "address",
+			left:    resultSet([]string{"address_id"}),
+			right:   resultSet([]string{"id"}),
+			leftKey: "address_id", rightKey: "id", ok: true,
+		},
+		{
+			name:     "shared column is not a key",
+			leftName: "orders", rightName: "customers",
+			left:  resultSet([]string{"id", "name"}),
+			right: resultSet([]string{"id", "name"}),
+		},
+		{
+			name:     "foreign key without underscore",
+			leftName: "orders", rightName: "customers",
+			left:  resultSet([]string{"customerid"}),
+			right: resultSet([]string{"id"}),
+		},
+		{
+			name:     "no id on the referenced step",
+			leftName: "orders", rightName: "customers",
+			left:  resultSet([]string{"customer_id"}),
+			right: resultSet([]string{"customer_id", "name"}),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			leftKey, rightKey, ok := inferJoinKey(tt.leftName, tt.rightName, tt.left, tt.right)
+			if leftKey != tt.leftKey || rightKey != tt.rightKey || ok != tt.ok {
+				t.Errorf("inferJoinKey() = %q, %q, %v, want %q, %q, %v", leftKey, rightKey, ok, tt.leftKey, tt.rightKey, tt.ok)
+			}
+		})
+	}
+}
+
+func TestResolveJoinKeysFailsWithoutKey(t *testing.T) {
+	plan := &FederatedPlan{
+		Steps: []*PlanStep{{Name: "orders"}, {Name: "customers"}},
+		Joins: []*PlanJoin{{Left: "orders", Right: "customers", Type: "left"}},
+	}
+	steps := map[string]*db.ResultSet{
+		"orders":    resultSet([]string{"id", "name"}),
+		"customers": resultSet([]string{"id", "name"}),
+	}
+	err := resolveJoinKeys(plan, steps, nil)
+	if err == nil || !strings.Contains(err.Error(), "could not find columns") {
+		t.Fatalf("resolveJoinKeys() error = %v, want could not find columns", err)
+	}
+}
+
+func TestJoinSteps(t *testing.T) {
+	orders := resultSet([]string{"id", "customer_id", "total"},
+		[]interface{}{int64(1), int64(10), 5.0},
+		[]interface{}{int64(2), int64(20), 7.0},
+		[]interface{}{int64(3), nil, 9.0},
+	)
+	customers := resultSet([]string{"id", "name"},
+		[]interface{}{float64(10), "Ada"},
+		[]interface{}{"30", "Grace"},
+	)
+
+	tests := []struct {
+		name     string
+		joinType string
+		columns  []string
+		rows     [][]interface{}
+	}{
+		{
+			name:     "left",
+			joinType: "left",
+			columns:  []string{"id", "customer_id", "total", "customers.id", "name"},
+			rows: [][]interface{}{
+				{int64(1), int64(10), 5.0, float64(10), "Ada"},
+				{int64(2), int64(20), 7.0, nil, nil},
+				{int64(3), nil, 9.0, nil, nil},
+			},
+		},
+		{
+			name:     "inner",
+			joinType: "inner",
+			columns:  []string{"id", "customer_id", "total", "customers.id", "name"},
+			rows: [][]interface{}{
+				{int64(1), int64(10), 5.0, float64(10), "Ada"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := &FederatedPlan{
+				Steps: []*PlanStep{{Name: "orders"}, {Name: "customers"}},
+				Joins: []*PlanJoin{{Left: "orders", Right: "customers", LeftKey: "customer_id", RightKey: "id", Type: tt.joinType}},
+			}
+			joined, err := joinSteps(plan, map[string]*db.ResultSet{"orders": orders, "customers": customers})
+			if err != nil {
+				t.Fatalf("joinSteps() error = %v", err)
+			}
+			if got := columnNames(joined); !reflect.DeepEqual(got, tt.columns) {
+				t.Errorf("columns = %v, want %v", got, tt.columns)
+			}
+			if !reflect.DeepEqual(joined.Rows, tt.rows) {
+				t.Errorf("rows = %v, want %v", joined.Rows, tt.rows)
+			}
+		})
+	}
+}
+
+func TestJoinStepsMultipleMatches(t *testing.T) {
+	customers := resultSet([]string{"id", "name"}, []interface{}{int64(1), "Ada"})
+	orders := resultSet([]string{"customer_id", "total"},
+		[]interface{}{int64(1), 5.0},
+		[]interface{}{int64(1), 7.0},
+	)
+	plan := &FederatedPlan{
+		Steps: []*PlanStep{{Name: "customers"}, {Name: "orders"}},
+		Joins: []*PlanJoin{{Left: "customers", Right: "orders", LeftKey: "id", RightKey: "customer_id", Type: "inner"}},
+	}
+	joined, err := joinSteps(plan, map[string]*db.ResultSet{"customers": customers, "orders": orders})
+	if err != nil {
+		t.Fatalf("joinSteps() error = %v", err)
+	}
+	want := [][]interface{}{
+		{int64(1), "Ada", int64(1), 5.0},
+		{int64(1), "Ada", int64(1), 7.0},
+	}
+	if !reflect.DeepEqual(joined.Rows, want) {
+		t.Errorf("rows = %v, want %v", joined.Rows, want)
+	}
+}
+
+func TestMergeSteps(t *testing.T) {
+	plan := &FederatedPlan{Steps: []*PlanStep{{Name: "eu"}, {Name: "us"}}, Merge: true}
+	steps := map[string]*db.ResultSet{
+		"eu": resultSet([]string{"id", "name"}, []interface{}{int64(1), "Ada"}),
+		"us": resultSet([]string{"id", "email"}, []interface{}{int64(2), "grace@example.com"}),
+	}
+	steps["eu"].Truncated = true
+
+	merged, err := joinSteps(plan, steps)
+	if err != nil {
+		t.Fatalf("joinSteps() error = %v", err)
+	}
+	if got, want := columnNames(merged), []string{"step", "id", "name", "email"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("columns = %v, want %v", got, want)
+	}
+	want := [][]interface{}{
+		{"eu", int64(1), "Ada", nil},
+		{"us", int64(2), nil, "grace@example.com"},
+	}
+	if !reflect.DeepEqual(merged.Rows, want) {
+		t.Errorf("rows = %v, want %v", merged.Rows, want)
+	}
+	if !merged.Truncated {
+		t.Error("merged result is not truncated, want truncated when a step is")
+	}
+}
+
+func TestParseFederatedPlan(t *testing.T) {
+	saved := config.RegisteredDBs
+	config.RegisteredDBs = map[string]config.DBConfig{
+		"shop": {Name: "shop", Type: "postgres"},
+		"crm":  {Name: "crm", Type: "mongo"},
+	}
+	defer func() { config.RegisteredDBs = saved }()
+
+	tests := []struct {
+		name  string
+		plan  string
+		err   string
+		joins []PlanJoin
+	}{
+		{
+			name:  "unconnected steps are joined in order",
+			plan:  `{"steps": [{"name": "orders", "database": "shop", "prompt": "orders"}, {"name": "customers", "database": "crm", "prompt": "customers"}]}`,
+			joins: []PlanJoin{{Left: "orders", Right: "customers", Type: "left"}},
+		},
+		{
+			name: "keys of the plan",
+			plan: `{"steps": [{"name": "orders", "database": "shop", "prompt": "orders"}, {"name": "customers", "database": "crm", "prompt": "customers"}],
+				"joins": [{"left": "orders", "right": "customers", "left_key": "customer_id", "right_key": "_id", "type": "inner"}]}`,
+			joins: []PlanJoin{{Left: "orders", Right: "customers", LeftKey: "customer_id", RightKey: "_id", Type: "inner", Source: "plan"}},
+		},
+		{
+			name: "duplicate step names",
+			plan: `{"steps": [{"name": "orders", "database": "shop", "prompt": "new orders"}, {"name": "orders", "database": "crm", "prompt": "old orders"}]}`,
+			err:  `reuses the step name "orders"`,
+		},
+		{
+			name: "unnamed steps on the same database",
+			plan: `{"steps": [{"database": "shop", "prompt": "orders"}, {"database": "shop", "prompt": "refunds"}]}`,
+			err:  `reuses the step name "shop"`,
+		},
+		{
+			name: "unregistered database",
+			plan: `{"steps": [{"name": "orders", "database": "billing", "prompt": "orders"}]}`,
+			err:  `unregistered database "billing"`,
+		},
+		{
+			name: "unsupported join type",
+			plan: `{"steps": [{"name": "orders", "database": "shop", "prompt": "orders"}, {"name": "customers", "database": "crm", "prompt": "customers"}],
+				"joins": [{"left": "orders", "right": "customers", "type": "outer"}]}`,
+			err: `unsupported type "outer"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := ParseFederatedPlan(tt.plan)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("ParseFederatedPlan() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseFederatedPlan() error = %v", err)
+			}
+			joins := make([]PlanJoin, len(plan.Joins))
+			for i, join := range plan.Joins {
+				joins[i] = *join
+			}
+			if !reflect.DeepEqual(joins, tt.joins) {
+				t.Errorf("joins = %+v, want %+v", joins, tt.joins)
+			}
+		})
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"regexp"
 	"strings"
 	"time"
 
@@ -44,9 +43,18 @@ func (b *BaseLLM) preparePrompt(req QueryRequest) (string, error) {
 		templateName = "default"
 	}
 	var templateType templates.TemplateType
-	if req.QueryType == QueryTypeMongo {
+	switch req.QueryType {
+	case QueryTypeMongo:
 		templateType = templates.MongoSystemPrompt
-	} else {
+	case QueryTypePlan:
+		templateType = templates.Plan
+	case QueryTypeAgent:
+		templateType = templates.Agent
+	case QueryTypeSummary:
+		templateType = templates.Summary
+	case QueryTypeVisualization:
+		templateType = templates.Visualization
+	default:
 		templateType = templates.SystemPrompt
 	}
 
@@ -55,6 +63,7 @@ func (b *BaseLLM) preparePrompt(req QueryRequest) (string, error) {
 		"Schema":      req.Schema,
 		"UserRequest": req.Prompt,
 		"DBType":      req.DBType,
+		"Examples":    req.Examples,
 	}
 
 	// Add custom variables to template data
@@ -183,11 +192,14 @@ func (b *BaseLLM) formatResponse(req QueryRequest, query, explanation string) (s
 		data[k] = v
 	}
 
-	// Handle parameters - extract them from the query if they exist
-	parameters, remainingQuery := extractParameters(query)
-	if len(parameters) > 0 {
+	// Handle parameters - extract the bound arguments if the model returned them
+	if req.QueryType == QueryTypeSQL {
+		parameters, remainingQuery := extractParameters(query)
 		query = remainingQuery
-		data["Parameters"] = parameters
+		data["Query"] = query
+		if len(parameters) > 0 {
+			data["Parameters"] = parameters
+		}
 	}
 
 	// Convert parameters to JSON for the template
@@ -224,26 +236,32 @@ func (b *BaseLLM) formatResponse(req QueryRequest, query, explanation string) (s
 	return tmplResult, nil
 }
 
-// extractParameters extracts parameters from a query string.
-// Returns the parameters and the remaining query string.
-func extractParameters(query string) ([]interface{}, string) {
-	re := regexp.MustCompile(`\$\d+`)
-	matches := re.FindAllString(query, -1)
-	if len(matches) == 0 {
+// extractParameters extracts the bound arguments from a query returned as
+// {"query": ..., "args": [...]}. Returns the arguments and the SQL statement.
+func extractParameters(query string) ([]QueryArg, string) {
+	parsed, err := ParseSQLQuery(query)
+	if err != nil {
 		return nil, query
 	}
+	return parsed.Args, parsed.Query
+}
 
-	// Remove parameters from the query
-	cleanQuery := re.ReplaceAllString(query, "?")
-	
-	// Extract parameter values (for now, using placeholders)
-	// In a real implementation, you'd extract these from the query
-	params := make([]interface{}, 0, len(matches))
-	for i := range matches {
-		params = append(params, fmt.Sprintf("param%d", i+1))
+// parametersFromResponse reads the bound arguments from the "parameters"
+// field of a formatted response
+func parametersFromResponse(m map[string]interface{}) []QueryArg {
+	raw, ok := m["parameters"]
+	if !ok {
+		return nil
 	}
-
-	return params, cleanQuery
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil
+	}
+	var args []QueryArg
+	if err := decodeJSON(data, &args); err != nil {
+		return nil
+	}
+	return args
 }
 
 // getStringValue safely extracts a string value from a map with a default fallback
@@ -0,0 +1,46 @@
+package llm
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Clarification is a question the model asks instead of writing a query, when the
+// request can be read in ways that lead to different queries
+type Clarification struct {
+	Question string   `json:"question"`
+	Options  []string `json:"options"` // candidate interpretations of the request
+}
+
+// ClarificationAnswer is the user's answer to a clarification, given to the next request
+type ClarificationAnswer struct {
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+}
+
+// Answer returns the user's reply to the clarification: one of its options, or any other text
+func (c Clarification) Answer(reply string) ClarificationAnswer {
+	return ClarificationAnswer{Question: c.Question, Answer: reply}
+}
+
+// ParseClarification returns the clarification of a response written as
+// {"clarification": {"question": ..., "options": [...]}}, or false for a query
+func ParseClarification(text string) (*Clarification, bool) {
+	trimmed := strings.TrimSpace(text)
+	start := strings.Index(trimmed, "{")
+	end := strings.LastIndex(trimmed, "}")
+	if start < 0 || end < start || !looksLikeJSON(trimmed[:start]) {
+		return nil, false
+	}
+
+	var reply struct {
+		Clarification *Clarification `json:"clarification"`
+	}
+	if err := json.Unmarshal([]byte(trimmed[start:end+1]), &reply); err != nil {
+		return nil, false
+	}
+	if reply.Clarification == nil || strings.TrimSpace(reply.Clarification.Question) == "" {
+		return nil, false
+	}
+	return reply.Clarification, true
+}
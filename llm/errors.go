@@ -0,0 +1,78 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// APIError is returned when an LLM provider answers with a non-success HTTP status
+type APIError struct {
+	Provider   string
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s API returned status %d: %s", e.Provider, e.StatusCode, e.Body)
+}
+
+// UsageError is returned by calls that consumed tokens but failed, e.g. on a reply
+// that could not be read, so the tokens can still be charged
+type UsageError struct {
+	Usage []ModelUsage
+	Err   error
+}
+
+func (e *UsageError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *UsageError) Unwrap() error {
+	return e.Err
+}
+
+// FailedUsage returns the usage carried by a UsageError in err's chain
+func FailedUsage(err error) []ModelUsage {
+	var usageErr *UsageError
+	if errors.As(err, &usageErr) {
+		return usageErr.Usage
+	}
+	return nil
+}
+
+// IsRetryable reports whether err is a transient provider failure (HTTP 429, 5xx or a network timeout)
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return isRetryableStatus(apiErr.StatusCode)
+	}
+
+	var openaiErr *openai.APIError
+	if errors.As(err, &openaiErr) {
+		return isRetryableStatus(openaiErr.HTTPStatusCode)
+	}
+
+	var requestErr *openai.RequestError
+	if errors.As(err, &requestErr) {
+		return isRetryableStatus(requestErr.HTTPStatusCode)
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return false
+}
+
+func isRetryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
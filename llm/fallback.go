@@ -0,0 +1,311 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/vijaylingoju/prompterdb/templates"
+)
+
+// ErrCircuitOpen is reported for a provider whose circuit breaker is currently open
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// Provider is a single member of a Fallback chain
+type Provider struct {
+	LLM LLM
+	// Weight is the provider's share of traffic under weighted round-robin.
+	// Providers with a weight of 0 are only used as fallbacks.
+	Weight int
+}
+
+// FallbackOptions controls retries and circuit breaking in a Fallback chain
+type FallbackOptions struct {
+	MaxRetries       int           // retries per provider on 429/5xx responses
+	InitialBackoff   time.Duration // delay before the first retry, doubled on each attempt
+	MaxBackoff       time.Duration // upper bound for the retry delay
+	FailureThreshold int           // consecutive failures that open a provider's breaker
+	OpenTimeout      time.Duration // how long an open breaker rejects calls before a trial call
+}
+
+// DefaultFallbackOptions returns the options used when none are supplied
+func DefaultFallbackOptions() FallbackOptions {
+	return FallbackOptions{
+		MaxRetries:       2,
+		InitialBackoff:   500 * time.Millisecond,
+		MaxBackoff:       8 * time.Second,
+		FailureThreshold: 3,
+		OpenTimeout:      30 * time.Second,
+	}
+}
+
+// Fallback is an LLM that spreads requests over several providers.
+// Weighted providers are picked by smooth weighted round-robin; when the
+// chosen provider fails, the remaining providers are tried in declared order.
+type Fallback struct {
+	members []*fallbackMember
+	opts    FallbackOptions
+	mu      sync.Mutex
+
+	// clock, replaced by tests
+	now   func() time.Time
+	after func(time.Duration) <-chan time.Time
+}
+
+type fallbackMember struct {
+	Provider
+	current int // smooth weighted round-robin state
+	breaker circuitBreaker
+}
+
+// NewFallback creates a Fallback chain over the given providers
+func NewFallback(opts FallbackOptions, providers ...Provider) (*Fallback, error) {
+	if len(providers) == 0 {
+		return nil, errors.New("at least one provider is required")
+	}
+
+	defaults := DefaultFallbackOptions()
+	if opts.InitialBackoff <= 0 {
+		opts.InitialBackoff = defaults.InitialBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = defaults.MaxBackoff
+	}
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = defaults.FailureThreshold
+	}
+	if opts.OpenTimeout <= 0 {
+		opts.OpenTimeout = defaults.OpenTimeout
+	}
+
+	members := make([]*fallbackMember, 0, len(providers))
+	for i, p := range providers {
+		if p.LLM == nil {
+			return nil, fmt.Errorf("provider %d has no LLM", i)
+		}
+		if p.Weight < 0 {
+			return nil, fmt.Errorf("provider %s has a negative weight", p.LLM.Name())
+		}
+		members = append(members, &fallbackMember{Provider: p})
+	}
+
+	return &Fallback{members: members, opts: opts, now: time.Now, after: time.After}, nil
+}
+
+// Name returns the name of the LLM implementation
+func (f *Fallback) Name() string {
+	return "fallback"
+}
+
+// SetTemplateManager sets the template manager on every provider in the chain
+func (f *Fallback) SetTemplateManager(tm *templates.TemplateManager) {
+	for _, m := range f.members {
+		m.LLM.SetTemplateManager(tm)
+	}
+}
+
+// GenerateQuery tries the providers in order until one succeeds.
+// The Provider field of the response names the provider that answered.
+func (f *Fallback) GenerateQuery(req QueryRequest) (*QueryResponse, error) {
+	return f.GenerateQueryContext(context.Background(), req)
+}
+
+// GenerateQueryContext is GenerateQuery with a context that stops the retries and
+// the remaining providers. The tokens of failed attempts are reported in the
+// response's FailedUsage, or in a UsageError when every provider fails.
+func (f *Fallback) GenerateQueryContext(ctx context.Context, req QueryRequest) (*QueryResponse, error) {
+	var errs []error
+	var failed []ModelUsage
+	for _, m := range f.order() {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		name := m.LLM.Name()
+		if !f.allow(m) {
+			errs = append(errs, fmt.Errorf("%s: %w", name, ErrCircuitOpen))
+			continue
+		}
+
+		resp, err := f.generateWithRetry(ctx, m, req, &failed)
+		if err != nil && ctx.Err() != nil {
+			// a cancelled call says nothing about the provider
+			f.release(m)
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			break
+		}
+		f.record(m, err)
+		if err != nil {
+			log.Printf("Warning: LLM provider %s failed: %v", name, err)
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+
+		if resp.Provider == "" {
+			resp.Provider = name
+		}
+		resp.FailedUsage = append(failed, resp.FailedUsage...)
+		return resp, nil
+	}
+
+	err := fmt.Errorf("all LLM providers failed: %w", errors.Join(errs...))
+	if len(failed) > 0 {
+		return nil, &UsageError{Usage: failed, Err: err}
+	}
+	return nil, err
+}
+
+// generateWithRetry calls a single provider, retrying transient failures with exponential
+// backoff until ctx is done. The usage of failed attempts is appended to failed.
+func (f *Fallback) generateWithRetry(ctx context.Context, m *fallbackMember, req QueryRequest, failed *[]ModelUsage) (*QueryResponse, error) {
+	backoff := f.opts.InitialBackoff
+	for attempt := 0; ; attempt++ {
+		resp, err := GenerateQueryContext(ctx, m.LLM, req)
+		if err == nil {
+			return resp, nil
+		}
+		*failed = append(*failed, FailedUsage(err)...)
+		if attempt >= f.opts.MaxRetries || !IsRetryable(err) {
+			return nil, err
+		}
+
+		log.Printf("Retrying LLM provider %s in %s (attempt %d): %v", m.LLM.Name(), backoff, attempt+1, err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-f.after(backoff):
+		}
+
+		backoff *= 2
+		if backoff > f.opts.MaxBackoff {
+			backoff = f.opts.MaxBackoff
+		}
+	}
+}
+
+// order returns the providers in the order they should be tried for the next request
+func (f *Fallback) order() []*fallbackMember {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now()
+	var best *fallbackMember
+	total := 0
+	for _, m := range f.members {
+		if m.Weight == 0 || !m.breaker.available(now, f.opts.OpenTimeout) {
+			continue
+		}
+		m.current += m.Weight
+		total += m.Weight
+		if best == nil || m.current > best.current {
+			best = m
+		}
+	}
+
+	if best == nil {
+		return f.members
+	}
+	best.current -= total
+
+	order := make([]*fallbackMember, 0, len(f.members))
+	order = append(order, best)
+	for _, m := range f.members {
+		if m != best {
+			order = append(order, m)
+		}
+	}
+	return order
+}
+
+func (f *Fallback) allow(m *fallbackMember) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return m.breaker.allow(f.now(), f.opts.OpenTimeout)
+}
+
+// release ends a call that was cancelled without recording an outcome, so a
+// half-open breaker lets its next probe through
+func (f *Fallback) release(m *fallbackMember) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	m.breaker.probing = false
+}
+
+// record updates the breaker of a provider with the outcome of a call. Only transient
+// failures (timeouts, 429 and 5xx responses) count; any other error is an answer of a
+// provider that is up, e.g. to a bad request.
+func (f *Fallback) record(m *fallbackMember, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if IsRetryable(err) {
+		m.breaker.failure(f.now(), f.opts.FailureThreshold)
+		return
+	}
+	m.breaker.success()
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// circuitBreaker tracks consecutive failures of a provider.
+// It is not safe for concurrent use; Fallback guards it with its mutex.
+type circuitBreaker struct {
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  bool // a half-open breaker let its probe call through, which has not been recorded yet
+}
+
+// available reports whether the breaker would let a call through without changing state
+func (cb *circuitBreaker) available(now time.Time, openTimeout time.Duration) bool {
+	switch cb.state {
+	case breakerOpen:
+		return now.Sub(cb.openedAt) >= openTimeout
+	case breakerHalfOpen:
+		return !cb.probing
+	}
+	return true
+}
+
+// allow reports whether a call may proceed, moving an expired open breaker to half-open.
+// A half-open breaker lets a single probe through and rejects calls until it is recorded.
+func (cb *circuitBreaker) allow(now time.Time, openTimeout time.Duration) bool {
+	switch cb.state {
+	case breakerOpen:
+		if now.Sub(cb.openedAt) < openTimeout {
+			return false
+		}
+		cb.state = breakerHalfOpen
+	case breakerHalfOpen:
+		if cb.probing {
+			return false
+		}
+	default:
+		return true
+	}
+	cb.probing = true
+	return true
+}
+
+func (cb *circuitBreaker) success() {
+	cb.state = breakerClosed
+	cb.failures = 0
+	cb.probing = false
+}
+
+func (cb *circuitBreaker) failure(now time.Time, threshold int) {
+	cb.probing = false
+	cb.failures++
+	if cb.state == breakerHalfOpen || cb.failures >= threshold {
+		cb.state = breakerOpen
+		cb.openedAt = now
+	}
+}
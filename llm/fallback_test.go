@@ -0,0 +1,224 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vijaylingoju/prompterdb/templates"
+)
+
+// fakeLLM answers with its name, or with the errors queued in fail before that
+type fakeLLM struct {
+	name   string
+	fail   []error
+	calls  int
+	onCall func()
+}
+
+func (l *fakeLLM) GenerateQuery(req QueryRequest) (*QueryResponse, error) {
+	l.calls++
+	if l.onCall != nil {
+		l.onCall()
+	}
+	if len(l.fail) > 0 {
+		err := l.fail[0]
+		l.fail = l.fail[1:]
+		return nil, err
+	}
+	return &QueryResponse{Query: l.name, Model: l.name + "-model", Usage: Usage{TotalTokens: 10}}, nil
+}
+
+func (l *fakeLLM) Name() string { return l.name }
+
+func (l *fakeLLM) SetTemplateManager(*templates.TemplateManager) {}
+
+// fakeClock is a clock that only moves when told to, and records the backoffs waited for
+type fakeClock struct {
+	now   time.Time
+	waits []time.Duration
+	block bool // waits never end
+}
+
+func (c *fakeClock) install(f *Fallback) {
+	f.now = func() time.Time { return c.now }
+	f.after = func(d time.Duration) <-chan time.Time {
+		c.waits = append(c.waits, d)
+		ch := make(chan time.Time, 1)
+		if !c.block {
+			c.now = c.now.Add(d)
+			ch <- c.now
+		}
+		return ch
+	}
+}
+
+var errUnavailable = &APIError{Provider: "fake", StatusCode: http.StatusServiceUnavailable}
+
+func TestFallbackWeightedRoundRobin(t *testing.T) {
+	a, b, spare := &fakeLLM{name: "a"}, &fakeLLM{name: "b"}, &fakeLLM{name: "spare"}
+	f, err := NewFallback(FallbackOptions{}, Provider{LLM: a, Weight: 2}, Provider{LLM: b, Weight: 1}, Provider{LLM: spare})
+	if err != nil {
+		t.Fatalf("NewFallback() error = %v", err)
+	}
+
+	var got []string
+	for i := 0; i < 6; i++ {
+		resp, err := f.GenerateQuery(QueryRequest{})
+		if err != nil {
+			t.Fatalf("GenerateQuery() error = %v", err)
+		}
+		got = append(got, resp.Provider)
+	}
+	if want := []string{"a", "b", "a", "a", "b", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("providers = %v, want %v", got, want)
+	}
+	if spare.calls != 0 {
+		t.Errorf("spare provider was called %d times, want only as a fallback", spare.calls)
+	}
+}
+
+func TestFallbackHalfOpenProbe(t *testing.T) {
+	a, b := &fakeLLM{name: "a"}, &fakeLLM{name: "b"}
+	f, err := NewFallback(FallbackOptions{FailureThreshold: 1, OpenTimeout: time.Minute}, Provider{LLM: a, Weight: 1}, Provider{LLM: b})
+	if err != nil {
+		t.Fatalf("NewFallback() error = %v", err)
+	}
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	clock.install(f)
+	f.opts.MaxRetries = 0
+
+	// a transient failure opens a's breaker and b answers
+	a.fail = []error{errUnavailable}
+	if resp, err := f.GenerateQuery(QueryRequest{}); err != nil || resp.Provider != "b" {
+		t.Fatalf("GenerateQuery() = %v, %v, want an answer from b", resp, err)
+	}
+
+	// the open breaker skips a until the timeout
+	clock.now = clock.now.Add(time.Minute - time.Second)
+	if resp, err := f.GenerateQuery(QueryRequest{}); err != nil || resp.Provider != "b" || a.calls != 1 {
+		t.Fatalf("GenerateQuery() = %v, %v with %d calls to a, want b while a is open", resp, err, a.calls)
+	}
+
+	// after the timeout a single probe goes to a; calls made during the probe use b
+	clock.now = clock.now.Add(time.Second)
+	var during string
+	a.onCall = func() {
+		a.onCall = nil
+		resp, err := f.GenerateQuery(QueryRequest{})
+		if err != nil {
+			t.Errorf("GenerateQuery() during the probe error = %v", err)
+			return
+		}
+		during = resp.Provider
+	}
+	a.fail = []error{errUnavailable}
+	if resp, err := f.GenerateQuery(QueryRequest{}); err != nil || resp.Provider != "b" {
+		t.Fatalf("GenerateQuery() = %v, %v, want b after the failed probe", resp, err)
+	}
+	if during != "b" || a.calls != 2 {
+		t.Fatalf("call during the probe went to %q with %d calls to a, want b and a single probe", during, a.calls)
+	}
+
+	// the failed probe reopened the breaker from its time
+	clock.now = clock.now.Add(time.Minute - time.Second)
+	if resp, _ := f.GenerateQuery(QueryRequest{}); resp.Provider != "b" {
+		t.Fatalf("GenerateQuery() = %v, want b while a is open again", resp)
+	}
+
+	// a successful probe closes the breaker
+	clock.now = clock.now.Add(time.Second)
+	for i := 0; i < 2; i++ {
+		if resp, err := f.GenerateQuery(QueryRequest{}); err != nil || resp.Provider != "a" {
+			t.Fatalf("GenerateQuery() = %v, %v, want a once its breaker closed", resp, err)
+		}
+	}
+}
+
+func TestFallbackNonTransientErrorsKeepBreakerClosed(t *testing.T) {
+	a, b := &fakeLLM{name: "a"}, &fakeLLM{name: "b"}
+	f, err := NewFallback(FallbackOptions{FailureThreshold: 1}, Provider{LLM: a, Weight: 1}, Provider{LLM: b})
+	if err != nil {
+		t.Fatalf("NewFallback() error = %v", err)
+	}
+	(&fakeClock{now: time.Unix(0, 0)}).install(f)
+
+	a.fail = []error{&APIError{Provider: "a", StatusCode: http.StatusBadRequest}}
+	if resp, err := f.GenerateQuery(QueryRequest{}); err != nil || resp.Provider != "b" {
+		t.Fatalf("GenerateQuery() = %v, %v, want an answer from b", resp, err)
+	}
+	if resp, err := f.GenerateQuery(QueryRequest{}); err != nil || resp.Provider != "a" {
+		t.Fatalf("GenerateQuery() = %v, %v, want a, whose breaker stays closed", resp, err)
+	}
+}
+
+func TestFallbackRetryBackoff(t *testing.T) {
+	a := &fakeLLM{name: "a", fail: []error{errUnavailable, errUnavailable, errUnavailable}}
+	f, err := NewFallback(FallbackOptions{MaxRetries: 3, InitialBackoff: time.Second, MaxBackoff: 3 * time.Second, FailureThreshold: 10}, Provider{LLM: a, Weight: 1})
+	if err != nil {
+		t.Fatalf("NewFallback() error = %v", err)
+	}
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	clock.install(f)
+
+	if _, err := f.GenerateQuery(QueryRequest{}); err != nil {
+		t.Fatalf("GenerateQuery() error = %v", err)
+	}
+	if want := []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}; !reflect.DeepEqual(clock.waits, want) {
+		t.Errorf("backoffs = %v, want %v", clock.waits, want)
+	}
+}
+
+func TestFallbackRetryStopsWhenContextIsDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	a := &fakeLLM{name: "a", fail: []error{errUnavailable}, onCall: cancel}
+	b := &fakeLLM{name: "b"}
+	f, err := NewFallback(FallbackOptions{MaxRetries: 2, FailureThreshold: 1}, Provider{LLM: a, Weight: 1}, Provider{LLM: b})
+	if err != nil {
+		t.Fatalf("NewFallback() error = %v", err)
+	}
+	clock := &fakeClock{now: time.Unix(0, 0), block: true}
+	clock.install(f)
+
+	_, err = f.GenerateQueryContext(ctx, QueryRequest{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("GenerateQueryContext() error = %v, want context.Canceled", err)
+	}
+	if a.calls != 1 || b.calls != 0 {
+		t.Errorf("calls = %d to a and %d to b, want 1 and 0", a.calls, b.calls)
+	}
+
+	// the cancelled call is not a failure of a
+	if resp, err := f.GenerateQuery(QueryRequest{}); err != nil || resp.Provider != "a" {
+		t.Errorf("GenerateQuery() = %v, %v, want a", resp, err)
+	}
+}
+
+func TestFallbackFailedUsage(t *testing.T) {
+	spent := []ModelUsage{{Model: "a-model", Usage: Usage{PromptTokens: 7, TotalTokens: 7}}}
+	a := &fakeLLM{name: "a", fail: []error{&UsageError{Usage: spent, Err: errors.New("unreadable reply")}}}
+	b := &fakeLLM{name: "b"}
+	f, err := NewFallback(FallbackOptions{}, Provider{LLM: a, Weight: 1}, Provider{LLM: b})
+	if err != nil {
+		t.Fatalf("NewFallback() error = %v", err)
+	}
+
+	resp, err := f.GenerateQuery(QueryRequest{})
+	if err != nil {
+		t.Fatalf("GenerateQuery() error = %v", err)
+	}
+	if !reflect.DeepEqual(resp.FailedUsage, spent) {
+		t.Errorf("FailedUsage = %v, want %v", resp.FailedUsage, spent)
+	}
+
+	// when every provider fails, the usage is carried by the error
+	a.fail = []error{&UsageError{Usage: spent, Err: errors.New("unreadable reply")}}
+	b.fail = []error{errors.New("bad request")}
+	_, err = f.GenerateQuery(QueryRequest{})
+	if got := FailedUsage(err); !reflect.DeepEqual(got, spent) {
+		t.Errorf("FailedUsage(%v) = %v, want %v", err, got, spent)
+	}
+}
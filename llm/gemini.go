@@ -64,17 +64,32 @@ func (g *Gemini) GenerateQuery(req QueryRequest) (*QueryResponse, error) {
 	}
 
 	// Make API request
-	text, err := g.makeAPIRequest(prompt)
+	text, usage, err := g.makeAPIRequest(prompt)
 	if err != nil {
-		return nil, fmt.Errorf("API request failed: %w", err)
+		return nil, g.usageError(usage, fmt.Errorf("API request failed: %w", err))
 	}
 
 	// Process and format the response
-	return g.processResponse(req, text)
+	response, err := g.processResponse(req, text)
+	if err != nil {
+		return nil, g.usageError(usage, err)
+	}
+	response.Model = g.Model
+	response.Usage = usage
+
+	return response, nil
 }
 
-// makeAPIRequest sends a request to the Gemini API and returns the response text
-func (g *Gemini) makeAPIRequest(prompt string) (string, error) {
+// usageError attaches the tokens of a failed call to err, so they are charged
+func (g *Gemini) usageError(usage Usage, err error) error {
+	if usage.TotalTokens == 0 {
+		return err
+	}
+	return &UsageError{Usage: []ModelUsage{{Model: g.Model, Usage: usage}}, Err: err}
+}
+
+// makeAPIRequest sends a request to the Gemini API and returns the response text and token usage
+func (g *Gemini) makeAPIRequest(prompt string) (string, Usage, error) {
 	url := fmt.Sprintf(geminiAPIURL+"?key=%s", g.Model, g.APIKey)
 
 	requestBody := map[string]interface{}{
@@ -89,35 +104,35 @@ func (g *Gemini) makeAPIRequest(prompt string) (string, error) {
 
 	jsonBody, err := json.Marshal(requestBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request body: %w", err)
+		return "", Usage{}, fmt.Errorf("failed to marshal request body: %w", err)
 	}
 
 	httpReq, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(jsonBody))
 	if err != nil {
-		return "", fmt.Errorf("failed to create HTTP request: %w", err)
+		return "", Usage{}, fmt.Errorf("failed to create HTTP request: %w", err)
 	}
 	httpReq.Header.Set("Content-Type", "application/json")
 
 	resp, err := g.client.Do(httpReq)
 	if err != nil {
-		return "", fmt.Errorf("HTTP request failed: %w", err)
+		return "", Usage{}, fmt.Errorf("HTTP request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response body: %w", err)
+		return "", Usage{}, fmt.Errorf("failed to read response body: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+		return "", Usage{}, &APIError{Provider: g.Name(), StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	return g.extractTextFromResponse(body)
 }
 
-// extractTextFromResponse extracts the text content from the Gemini API response
-func (g *Gemini) extractTextFromResponse(body []byte) (string, error) {
+// extractTextFromResponse extracts the text content and token usage from the Gemini API response
+func (g *Gemini) extractTextFromResponse(body []byte) (string, Usage, error) {
 	var result struct {
 		Candidates []struct {
 			Content struct {
@@ -126,18 +141,29 @@ func (g *Gemini) extractTextFromResponse(body []byte) (string, error) {
 				} `json:"parts"`
 			} `json:"content"`
 		} `json:"candidates"`
+		UsageMetadata struct {
+			PromptTokenCount     int `json:"promptTokenCount"`
+			CandidatesTokenCount int `json:"candidatesTokenCount"`
+			TotalTokenCount      int `json:"totalTokenCount"`
+		} `json:"usageMetadata"`
 	}
 
 	if err := json.Unmarshal(body, &result); err != nil {
-		return "", fmt.Errorf("failed to parse API response: %w", err)
+		return "", Usage{}, fmt.Errorf("failed to parse API response: %w", err)
+	}
+
+	usage := Usage{
+		PromptTokens:     result.UsageMetadata.PromptTokenCount,
+		CompletionTokens: result.UsageMetadata.CandidatesTokenCount,
+		TotalTokens:      result.UsageMetadata.TotalTokenCount,
 	}
 
 	if len(result.Candidates) == 0 {
-		return "", errors.New("no candidates in API response")
+		return "", usage, errors.New("no candidates in API response")
 	}
 
 	if len(result.Candidates[0].Content.Parts) == 0 {
-		return "", errors.New("no text parts in API response")
+		return "", usage, errors.New("no text parts in API response")
 	}
 
 	text := result.Candidates[0].Content.Parts[0].Text
@@ -145,7 +171,7 @@ func (g *Gemini) extractTextFromResponse(body []byte) (string, error) {
 	text = strings.Trim(text, "`")
 	text = strings.TrimSpace(strings.TrimPrefix(text, "sql"))
 
-	return text, nil
+	return text, usage, nil
 }
 
 // processResponse processes the API response and formats it according to the request
@@ -156,12 +182,13 @@ func (g *Gemini) processResponse(req QueryRequest, text string) (*QueryResponse,
 	}
 
 	var responseMap map[string]interface{}
-	if err := json.Unmarshal([]byte(formattedResponse), &responseMap); err != nil {
+	if err := decodeJSON([]byte(formattedResponse), &responseMap); err != nil {
 		// If we can't parse the response, return a basic response
 		return &QueryResponse{
 			Query:       text,
 			Explanation: "",
 			RawResponse: formattedResponse,
+			Provider:    g.Name(),
 		}, nil
 	}
 
@@ -170,6 +197,7 @@ func (g *Gemini) processResponse(req QueryRequest, text string) (*QueryResponse,
 		Query:       text,
 		Explanation: "",
 		RawResponse: formattedResponse,
+		Provider:    g.Name(),
 	}
 
 	// Update from responseMap if available
@@ -179,6 +207,7 @@ func (g *Gemini) processResponse(req QueryRequest, text string) (*QueryResponse,
 	if explanation, ok := responseMap["explanation"].(string); ok && explanation != "" {
 		response.Explanation = explanation
 	}
+	response.Args = parametersFromResponse(responseMap)
 
 	return response, nil
 }
@@ -2,14 +2,20 @@
 package llm
 
 import (
+	"context"
+
 	"github.com/vijaylingoju/prompterdb/templates"
 )
 
 type QueryType string
 
 const (
-	QueryTypeSQL    QueryType = "sql"
-	QueryTypeMongo  QueryType = "mongo"
+	QueryTypeSQL           QueryType = "sql"
+	QueryTypeMongo         QueryType = "mongo"
+	QueryTypePlan          QueryType = "plan"          // plan of sub-queries over several databases
+	QueryTypeAgent         QueryType = "agent"         // next step or answer of a multi-step question
+	QueryTypeSummary       QueryType = "summary"       // natural language answer over query results
+	QueryTypeVisualization QueryType = "visualization" // widget type for query results
 )
 
 type QueryRequest struct {
@@ -19,12 +25,27 @@ type QueryRequest struct {
 	QueryType   QueryType
 	Template    string // Optional: name of the template to use
 	CustomVars  map[string]interface{} // Additional variables for template
+	Examples    []Example // Optional: few-shot examples exposed to templates as .Examples
+}
+
+// Example is a question paired with a known good query, used for few-shot prompting
+type Example struct {
+	Question string `json:"question"`
+	Query    string `json:"query"`
+	Database string `json:"database"` // registered database name or DB type
 }
 
 type QueryResponse struct {
 	Query       string
 	Explanation string
 	RawResponse string
+	Provider    string // name of the LLM provider that produced the response
+	Model       string // model that produced the response
+	Usage       Usage  // tokens consumed by the call
+	// FailedUsage holds the tokens of failed attempts made before this response, e.g. by a
+	// Fallback chain, per model so they can be priced
+	FailedUsage []ModelUsage
+	Args        []QueryArg // arguments bound to the $n placeholders of a SQL query
 }
 
 type LLM interface {
@@ -37,3 +58,21 @@ type LLM interface {
 	// SetTemplateManager sets the template manager to use
 	SetTemplateManager(tm *templates.TemplateManager)
 }
+
+// ContextLLM is an LLM whose calls can be cancelled, such as a Fallback chain
+type ContextLLM interface {
+	LLM
+	GenerateQueryContext(ctx context.Context, req QueryRequest) (*QueryResponse, error)
+}
+
+// GenerateQueryContext calls l with ctx when it supports cancellation.
+// Other LLMs are only called when ctx is not done yet.
+func GenerateQueryContext(ctx context.Context, l LLM, req QueryRequest) (*QueryResponse, error) {
+	if c, ok := l.(ContextLLM); ok {
+		return c.GenerateQueryContext(ctx, req)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return l.GenerateQuery(req)
+}
@@ -1,39 +1,86 @@
 package llm
 
 import (
-	"encoding/json"
 	"fmt"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// MongoQuery represents a generated MongoDB query structure from LLM
+// MongoQuery represents a generated MongoDB query structure from LLM.
+// Values are decoded from canonical or relaxed Extended JSON, so {"$oid": ...},
+// {"$date": ...} and {"$numberDecimal": ...} become ObjectIDs, dates and decimals.
 type MongoQuery struct {
-	Collection string         `json:"collection"`
-	Filter     map[string]any `json:"filter"`
+	Operation  string          `bson:"operation"`
+	Collection string          `bson:"collection"`
+	Filter     bson.M          `bson:"filter,omitempty"`
+	Document   bson.M          `bson:"document,omitempty"`
+	Documents  []bson.M        `bson:"documents,omitempty"`
+	Update     bson.M          `bson:"update,omitempty"`
+	Pipeline   []bson.D        `bson:"pipeline,omitempty"` // stages keep their key order
+	Field      string          `bson:"field,omitempty"`
+	Operations []bson.M        `bson:"operations,omitempty"` // bulkWrite operations
+	Projection bson.M          `bson:"projection,omitempty"`
+	Sort       bson.D          `bson:"sort,omitempty"`
+	Limit      int64           `bson:"limit,omitempty"`
+	Skip       int64           `bson:"skip,omitempty"`
+	Hint       interface{}     `bson:"hint,omitempty"` // index name or ordered index key document
+	Collation  *mongoCollation `bson:"collation,omitempty"`
 }
 
-// ParseMongoQuery parses JSON string from LLM into MongoQuery struct
+// mongoCollation maps the camelCase collation fields of the query JSON,
+// which options.Collation does not declare bson names for
+type mongoCollation struct {
+	Locale          string `bson:"locale"`
+	CaseLevel       bool   `bson:"caseLevel"`
+	CaseFirst       string `bson:"caseFirst"`
+	Strength        int    `bson:"strength"`
+	NumericOrdering bool   `bson:"numericOrdering"`
+	Alternate       string `bson:"alternate"`
+	MaxVariable     string `bson:"maxVariable"`
+	Normalization   bool   `bson:"normalization"`
+	Backwards       bool   `bson:"backwards"`
+}
+
+// ParseMongoQuery parses the Extended JSON string from LLM into a MongoQuery
 func ParseMongoQuery(jsonStr string) (*MongoQuery, error) {
 	var mq MongoQuery
-	if err := json.Unmarshal([]byte(jsonStr), &mq); err != nil {
+	if err := bson.UnmarshalExtJSON([]byte(jsonStr), false, &mq); err != nil {
 		return nil, fmt.Errorf("error parsing LLM Mongo response: %w", err)
 	}
-	if mq.Collection == "" {
-		return nil, fmt.Errorf("missing collection in MongoQuery")
-	}
 	return &mq, nil
 }
 
-// ConvertToBson converts filter into bson.M for Mongo querying
+// ConvertToBson returns the filter for Mongo querying, never nil
 func (mq *MongoQuery) ConvertToBson() (bson.M, error) {
-	b, err := json.Marshal(mq.Filter)
-	if err != nil {
-		return nil, fmt.Errorf("error marshalling Mongo filter: %w", err)
+	if mq.Filter == nil {
+		return bson.M{}, nil
+	}
+	return mq.Filter, nil
+}
+
+// DriverCollation returns the collation as driver options, or nil when none is set
+func (mq *MongoQuery) DriverCollation() *options.Collation {
+	if mq.Collation == nil {
+		return nil
 	}
-	var filter bson.M
-	if err := bson.UnmarshalExtJSON(b, true, &filter); err != nil {
-		return nil, fmt.Errorf("error converting filter to bson.M: %w", err)
+	c := options.Collation(*mq.Collation)
+	return &c
+}
+
+// DocumentList returns Documents as the plain maps accepted by db.InsertManyMongo
+func (mq *MongoQuery) DocumentList() []map[string]interface{} {
+	docs := make([]map[string]interface{}, len(mq.Documents))
+	for i, doc := range mq.Documents {
+		docs[i] = doc
 	}
-	return filter, nil
+	return docs
+}
+
+// extJSONTypeKeys are the Extended JSON type wrappers, which look like operators but are values
+var extJSONTypeKeys = map[string]bool{
+	"$oid": true, "$date": true, "$numberDecimal": true, "$numberLong": true,
+	"$numberInt": true, "$numberDouble": true, "$binary": true, "$uuid": true,
+	"$regularExpression": true, "$timestamp": true, "$minKey": true, "$maxKey": true,
+	"$undefined": true,
 }
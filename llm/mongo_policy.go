@@ -0,0 +1,245 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// DefaultPipelineLimit is the $limit appended to aggregation pipelines that have none
+const DefaultPipelineLimit = 1000
+
+// MongoPolicy controls what generated MongoDB queries are allowed to do
+type MongoPolicy struct {
+	// ReadOnly rejects write operations and the $out and $merge stages
+	ReadOnly bool
+	// AllowWriteStages permits $out and $merge in pipelines when the policy is not read-only
+	AllowWriteStages bool
+	// LookupCollections lists the collections $lookup, $graphLookup and $unionWith may read.
+	// An empty list allows any collection.
+	LookupCollections []string
+	// AllowedOperators, when set, restricts query and expression operators to this list
+	// in addition to the JavaScript operators that are always denied
+	AllowedOperators []string
+	// DefaultLimit is appended as a $limit stage to pipelines without one; 0 disables it
+	DefaultLimit int
+}
+
+// DefaultMongoPolicy returns the policy used by ValidateMongo
+func DefaultMongoPolicy() MongoPolicy {
+	return MongoPolicy{DefaultLimit: DefaultPipelineLimit}
+}
+
+// allowedStages are the aggregation stages generated pipelines may use
+var allowedStages = map[string]bool{
+	"$match": true, "$project": true, "$addFields": true, "$set": true, "$unset": true,
+	"$group": true, "$sort": true, "$limit": true, "$skip": true, "$unwind": true,
+	"$lookup": true, "$graphLookup": true, "$unionWith": true, "$facet": true,
+	"$count": true, "$bucket": true, "$bucketAuto": true, "$sortByCount": true,
+	"$replaceRoot": true, "$replaceWith": true, "$sample": true, "$redact": true,
+	"$densify": true, "$fill": true, "$setWindowFields": true, "$geoNear": true,
+}
+
+// writeStages are the aggregation stages that write to a collection
+var writeStages = map[string]bool{
+	"$out":   true,
+	"$merge": true,
+}
+
+// deniedOperators run server-side JavaScript and are never allowed
+var deniedOperators = map[string]bool{
+	"$where":       true,
+	"$function":    true,
+	"$accumulator": true,
+}
+
+// writeOperations are the operations rejected by a read-only policy
+var writeOperations = map[string]bool{
+	"insert":     true,
+	"insertMany": true,
+	"update":     true,
+	"bulkWrite":  true,
+	"delete":     true,
+}
+
+// validatePolicy applies the policy to a parsed MongoDB query
+func validatePolicy(mongoQuery map[string]interface{}, policy MongoPolicy) error {
+	operation, _ := mongoQuery["operation"].(string)
+	if policy.ReadOnly && writeOperations[operation] {
+		return fmt.Errorf("operation %s is not allowed by the read-only policy", operation)
+	}
+
+	for _, key := range []string{"filter", "update", "document", "documents", "operations", "projection"} {
+		if err := validateOperators(mongoQuery[key], policy); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+
+	if operation == "aggregate" {
+		pipeline, ok := mongoQuery["pipeline"].([]interface{})
+		if !ok {
+			return errors.New("pipeline must be an array")
+		}
+		return ValidatePipeline(pipeline, policy)
+	}
+	return nil
+}
+
+// ValidatePipeline validates an aggregation pipeline stage by stage against policy
+func ValidatePipeline(pipeline []interface{}, policy MongoPolicy) error {
+	return validateStages(pipeline, policy, true)
+}
+
+func validateStages(pipeline []interface{}, policy MongoPolicy, topLevel bool) error {
+	for i, s := range pipeline {
+		stage, ok := s.(map[string]interface{})
+		if !ok || len(stage) != 1 {
+			return fmt.Errorf("pipeline stage %d must be an object with a single stage name", i)
+		}
+
+		for name, body := range stage {
+			switch {
+			case writeStages[name]:
+				if policy.ReadOnly || !policy.AllowWriteStages {
+					return fmt.Errorf("pipeline stage %d: %s is not allowed", i, name)
+				}
+				if !topLevel || i != len(pipeline)-1 {
+					return fmt.Errorf("pipeline stage %d: %s must be the last stage", i, name)
+				}
+			case !allowedStages[name]:
+				return fmt.Errorf("pipeline stage %d: %s is not an allowed stage", i, name)
+			}
+
+			if err := validateStage(name, body, policy); err != nil {
+				return fmt.Errorf("pipeline stage %d: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateStage checks lookup targets, nested pipelines and the operators used in a stage
+func validateStage(name string, body interface{}, policy MongoPolicy) error {
+	spec, _ := body.(map[string]interface{})
+
+	switch name {
+	case "$lookup", "$graphLookup":
+		from, _ := spec["from"].(string)
+		if err := checkLookupTarget(name, from, policy); err != nil {
+			return err
+		}
+		if sub, ok := spec["pipeline"].([]interface{}); ok {
+			if err := validateStages(sub, policy, false); err != nil {
+				return fmt.Errorf("%s pipeline: %w", name, err)
+			}
+		}
+		return validateOperators(withoutKey(spec, "pipeline"), policy)
+	case "$unionWith":
+		coll, _ := body.(string)
+		if spec != nil {
+			coll, _ = spec["coll"].(string)
+		}
+		if err := checkLookupTarget(name, coll, policy); err != nil {
+			return err
+		}
+		if sub, ok := spec["pipeline"].([]interface{}); ok {
+			if err := validateStages(sub, policy, false); err != nil {
+				return fmt.Errorf("%s pipeline: %w", name, err)
+			}
+		}
+		return nil
+	case "$facet":
+		for facet, sub := range spec {
+			stages, ok := sub.([]interface{})
+			if !ok {
+				return fmt.Errorf("$facet %s must be a pipeline", facet)
+			}
+			if err := validateStages(stages, policy, false); err != nil {
+				return fmt.Errorf("$facet %s: %w", facet, err)
+			}
+		}
+		return nil
+	}
+
+	return validateOperators(body, policy)
+}
+
+func checkLookupTarget(stage, collection string, policy MongoPolicy) error {
+	if collection == "" {
+		return fmt.Errorf("%s requires a target collection", stage)
+	}
+	if len(policy.LookupCollections) == 0 {
+		return nil
+	}
+	for _, allowed := range policy.LookupCollections {
+		if collection == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s into collection %s is not permitted", stage, collection)
+}
+
+// validateOperators walks a value and rejects denied operators, and operators
+// outside the policy's allow-list when one is set
+func validateOperators(v interface{}, policy MongoPolicy) error {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			if strings.HasPrefix(key, "$") {
+				if deniedOperators[key] {
+					return fmt.Errorf("operator %s is not allowed", key)
+				}
+				if len(policy.AllowedOperators) > 0 && !extJSONTypeKeys[key] && !containsString(policy.AllowedOperators, key) {
+					return fmt.Errorf("operator %s is not in the allowed operators", key)
+				}
+			}
+			if err := validateOperators(child, policy); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, child := range value {
+			if err := validateOperators(child, policy); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// EnforcePipelineLimit appends a $limit stage to a pipeline that has no top-level $limit.
+// Pipelines ending in a write stage are left unchanged.
+func EnforcePipelineLimit(pipeline []bson.D, limit int) []bson.D {
+	if limit <= 0 {
+		return pipeline
+	}
+	for _, stage := range pipeline {
+		for _, e := range stage {
+			if e.Key == "$limit" || writeStages[e.Key] {
+				return pipeline
+			}
+		}
+	}
+	return append(pipeline, bson.D{{Key: "$limit", Value: limit}})
+}
+
+func withoutKey(m map[string]interface{}, key string) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		if k != key {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
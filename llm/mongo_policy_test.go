@@ -0,0 +1,240 @@
+package llm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestValidateMongoWithPolicy(t *testing.T) {
+	readOnly := MongoPolicy{ReadOnly: true}
+	writable := MongoPolicy{AllowWriteStages: true}
+	lookups := MongoPolicy{LookupCollections: []string{"customers"}}
+	operators := MongoPolicy{AllowedOperators: []string{"$gt", "$sum"}}
+
+	tests := []struct {
+		name   string
+		query  string
+		policy MongoPolicy
+		err    string
+	}{
+		// stages
+		{
+			name:  "allowed stages",
+			query: `{"operation": "aggregate", "collection": "orders", "pipeline": [{"$match": {"total": {"$gt": 5}}}, {"$group": {"_id": "$status", "n": {"$sum": 1}}}, {"$sort": {"n": -1}}]}`,
+		},
+		{
+			name:  "unknown stage",
+			query: `{"operation": "aggregate", "collection": "orders", "pipeline": [{"$collStats": {}}]}`,
+			err:   "$collStats is not an allowed stage",
+		},
+		{
+			name:  "stage with two names",
+			query: `{"operation": "aggregate", "collection": "orders", "pipeline": [{"$match": {}, "$limit": 5}]}`,
+			err:   "single stage name",
+		},
+		{
+			name:  "write stage denied by default",
+			query: `{"operation": "aggregate", "collection": "orders", "pipeline": [{"$out": "copy"}]}`,
+			err:   "$out is not allowed",
+		},
+		{
+			name:   "write stage allowed last",
+			query:  `{"operation": "aggregate", "collection": "orders", "pipeline": [{"$match": {}}, {"$merge": {"into": "copy"}}]}`,
+			policy: writable,
+		},
+		{
+			name:   "write stage before the end",
+			query:  `{"operation": "aggregate", "collection": "orders", "pipeline": [{"$out": "copy"}, {"$match": {}}]}`,
+			policy: writable,
+			err:    "$out must be the last stage",
+		},
+		{
+			name:   "write stage in a facet",
+			query:  `{"operation": "aggregate", "collection": "orders", "pipeline": [{"$facet": {"copy": [{"$out": "copy"}]}}]}`,
+			policy: writable,
+			err:    "$out must be the last stage",
+		},
+		{
+			name:   "write stage under a read-only policy",
+			query:  `{"operation": "aggregate", "collection": "orders", "pipeline": [{"$out": "copy"}]}`,
+			policy: MongoPolicy{ReadOnly: true, AllowWriteStages: true},
+			err:    "$out is not allowed",
+		},
+		{
+			name:   "write operation under a read-only policy",
+			query:  `{"operation": "insert", "collection": "orders", "document": {"total": 5}}`,
+			policy: readOnly,
+			err:    "operation insert is not allowed by the read-only policy",
+		},
+
+		// denied operators
+		{
+			name:  "$where in a filter",
+			query: `{"operation": "find", "collection": "orders", "filter": {"$where": "this.total > 5"}}`,
+			err:   "filter: operator $where is not allowed",
+		},
+		{
+			name:  "$function in a projection",
+			query: `{"operation": "find", "collection": "orders", "filter": {}, "projection": {"x": {"$function": {"body": "f", "args": [], "lang": "js"}}}}`,
+			err:   "projection: operator $function is not allowed",
+		},
+		{
+			name:  "$accumulator in a group",
+			query: `{"operation": "aggregate", "collection": "orders", "pipeline": [{"$group": {"_id": null, "x": {"$accumulator": {}}}}]}`,
+			err:   "operator $accumulator is not allowed",
+		},
+		{
+			name:  "$where in an array",
+			query: `{"operation": "find", "collection": "orders", "filter": {"$or": [{"total": 1}, {"$where": "true"}]}}`,
+			err:   "operator $where is not allowed",
+		},
+		{
+			name:   "operator outside the allow-list",
+			query:  `{"operation": "find", "collection": "orders", "filter": {"total": {"$lt": 5}}}`,
+			policy: operators,
+			err:    "operator $lt is not in the allowed operators",
+		},
+		{
+			name:   "Extended JSON values with an allow-list",
+			query:  `{"operation": "find", "collection": "orders", "filter": {"total": {"$gt": {"$numberLong": "5"}}}}`,
+			policy: operators,
+		},
+
+		// lookup targets
+		{
+			name:   "permitted $lookup",
+			query:  `{"operation": "aggregate", "collection": "orders", "pipeline": [{"$lookup": {"from": "customers", "localField": "customer_id", "foreignField": "_id", "as": "customer"}}]}`,
+			policy: lookups,
+		},
+		{
+			name:   "$lookup into another collection",
+			query:  `{"operation": "aggregate", "collection": "orders", "pipeline": [{"$lookup": {"from": "users", "localField": "user_id", "foreignField": "_id", "as": "user"}}]}`,
+			policy: lookups,
+			err:    "$lookup into collection users is not permitted",
+		},
+		{
+			name:   "$graphLookup into another collection",
+			query:  `{"operation": "aggregate", "collection": "orders", "pipeline": [{"$graphLookup": {"from": "users", "startWith": "$a", "connectFromField": "a", "connectToField": "b", "as": "c"}}]}`,
+			policy: lookups,
+			err:    "$graphLookup into collection users is not permitted",
+		},
+		{
+			name:   "$unionWith shorthand into another collection",
+			query:  `{"operation": "aggregate", "collection": "orders", "pipeline": [{"$unionWith": "users"}]}`,
+			policy: lookups,
+			err:    "$unionWith into collection users is not permitted",
+		},
+		{
+			name:  "$lookup without a target",
+			query: `{"operation": "aggregate", "collection": "orders", "pipeline": [{"$lookup": {"localField": "a", "foreignField": "b", "as": "c"}}]}`,
+			err:   "$lookup requires a target collection",
+		},
+
+		// nested pipelines
+		{
+			name:   "$lookup nested in a $lookup pipeline",
+			query:  `{"operation": "aggregate", "collection": "orders", "pipeline": [{"$lookup": {"from": "customers", "as": "c", "pipeline": [{"$lookup": {"from": "users", "as": "u", "pipeline": []}}]}}]}`,
+			policy: lookups,
+			err:    "$lookup pipeline: pipeline stage 0: $lookup into collection users is not permitted",
+		},
+		{
+			name:  "$where in a $lookup pipeline",
+			query: `{"operation": "aggregate", "collection": "orders", "pipeline": [{"$lookup": {"from": "customers", "as": "c", "pipeline": [{"$match": {"$where": "true"}}]}}]}`,
+			err:   "$lookup pipeline: pipeline stage 0: operator $where is not allowed",
+		},
+		{
+			name:   "$lookup in a $facet",
+			query:  `{"operation": "aggregate", "collection": "orders", "pipeline": [{"$facet": {"users": [{"$lookup": {"from": "users", "as": "u", "pipeline": []}}]}}]}`,
+			policy: lookups,
+			err:    "$facet users: pipeline stage 0: $lookup into collection users is not permitted",
+		},
+		{
+			name:  "$function in a $facet",
+			query: `{"operation": "aggregate", "collection": "orders", "pipeline": [{"$facet": {"x": [{"$project": {"y": {"$function": {}}}}]}}]}`,
+			err:   "$facet x: pipeline stage 0: operator $function is not allowed",
+		},
+		{
+			name:  "$facet that is not a pipeline",
+			query: `{"operation": "aggregate", "collection": "orders", "pipeline": [{"$facet": {"x": {"$match": {}}}}]}`,
+			err:   "$facet x must be a pipeline",
+		},
+		{
+			name:  "allowed nested pipelines",
+			query: `{"operation": "aggregate", "collection": "orders", "pipeline": [{"$facet": {"by_status": [{"$group": {"_id": "$status"}}], "with_customer": [{"$lookup": {"from": "customers", "as": "c", "pipeline": [{"$match": {"active": true}}]}}]}}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateMongoWithPolicy(tt.query, tt.policy)
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("ValidateMongoWithPolicy() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ValidateMongoWithPolicy() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestEnforcePipelineLimit(t *testing.T) {
+	match := bson.D{{Key: "$match", Value: bson.D{}}}
+	tests := []struct {
+		name     string
+		pipeline []bson.D
+		limit    int
+		want     []bson.D
+	}{
+		{
+			name:     "appended",
+			pipeline: []bson.D{match},
+			limit:    1000,
+			want:     []bson.D{match, {{Key: "$limit", Value: 1000}}},
+		},
+		{
+			name:  "empty pipeline",
+			limit: 10,
+			want:  []bson.D{{{Key: "$limit", Value: 10}}},
+		},
+		{
+			name:     "existing limit",
+			pipeline: []bson.D{match, {{Key: "$limit", Value: 5}}},
+			limit:    1000,
+			want:     []bson.D{match, {{Key: "$limit", Value: 5}}},
+		},
+		{
+			name:     "limit only inside a facet",
+			pipeline: []bson.D{{{Key: "$facet", Value: bson.D{{Key: "top", Value: bson.A{bson.D{{Key: "$limit", Value: 5}}}}}}}},
+			limit:    1000,
+			want: []bson.D{
+				{{Key: "$facet", Value: bson.D{{Key: "top", Value: bson.A{bson.D{{Key: "$limit", Value: 5}}}}}}},
+				{{Key: "$limit", Value: 1000}},
+			},
+		},
+		{
+			name:     "write stage",
+			pipeline: []bson.D{match, {{Key: "$out", Value: "copy"}}},
+			limit:    1000,
+			want:     []bson.D{match, {{Key: "$out", Value: "copy"}}},
+		},
+		{
+			name:     "disabled",
+			pipeline: []bson.D{match},
+			want:     []bson.D{match},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EnforcePipelineLimit(tt.pipeline, tt.limit); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("EnforcePipelineLimit() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
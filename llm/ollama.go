@@ -55,6 +55,44 @@ func (o *Ollama) GenerateSQL(prompt string, schema string) (string, error) {
 	return result.Response, nil
 }
 
+// Embed returns the embedding of text using the Ollama embeddings API.
+// The Ollama instance should be created with an embedding model such as nomic-embed-text.
+func (o *Ollama) Embed(text string) ([]float64, error) {
+	body := map[string]interface{}{
+		"model":  o.Model,
+		"prompt": text,
+	}
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal embedding request: %w", err)
+	}
+
+	resp, err := http.Post(o.Host+"/api/embeddings", "application/json", bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("ollama embedding request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	bs, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedding response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &APIError{Provider: o.Name(), StatusCode: resp.StatusCode, Body: string(bs)}
+	}
+
+	var result struct {
+		Embedding []float64 `json:"embedding"`
+	}
+	if err := json.Unmarshal(bs, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse embedding response: %w", err)
+	}
+	if len(result.Embedding) == 0 {
+		return nil, errors.New("ollama returned an empty embedding")
+	}
+	return result.Embedding, nil
+}
+
 func (o *Ollama) GenerateMongoQuery(prompt, schema string) (string, error) {
 	message := fmt.Sprintf(`Given this MongoDB schema:
 %s
@@ -3,7 +3,6 @@ package llm
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -73,8 +72,25 @@ func (o *OpenAI) GenerateQuery(req QueryRequest) (*QueryResponse, error) {
 		return nil, fmt.Errorf("OpenAI API error: %w", err)
 	}
 
+	// tokens of a reply that cannot be used are still charged
+	usage := Usage{
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+		TotalTokens:      resp.Usage.TotalTokens,
+	}
+	model := resp.Model
+	if model == "" {
+		model = o.Model
+	}
+	usageError := func(err error) error {
+		if usage.TotalTokens == 0 {
+			return err
+		}
+		return &UsageError{Usage: []ModelUsage{{Model: model, Usage: usage}}, Err: err}
+	}
+
 	if len(resp.Choices) == 0 {
-		return nil, errors.New("no response from OpenAI")
+		return nil, usageError(errors.New("no response from OpenAI"))
 	}
 
 	query := strings.TrimSpace(resp.Choices[0].Message.Content)
@@ -82,12 +98,12 @@ func (o *OpenAI) GenerateQuery(req QueryRequest) (*QueryResponse, error) {
 	// Format the response using the template system
 	formattedResponse, err := o.formatResponse(req, query, "")
 	if err != nil {
-		return nil, fmt.Errorf("error formatting response: %w", err)
+		return nil, usageError(fmt.Errorf("error formatting response: %w", err))
 	}
 
 	// Parse the formatted response if it's JSON
 	var responseMap map[string]interface{}
-	if err := json.Unmarshal([]byte(formattedResponse), &responseMap); err != nil {
+	if err := decodeJSON([]byte(formattedResponse), &responseMap); err != nil {
 		// If it's not valid JSON, just use it as is
 		responseMap = map[string]interface{}{
 			"query":       query,
@@ -101,6 +117,10 @@ func (o *OpenAI) GenerateQuery(req QueryRequest) (*QueryResponse, error) {
 		Query:       getStringValue(responseMap, "query", query),
 		Explanation: getStringValue(responseMap, "explanation", ""),
 		RawResponse: formattedResponse,
+		Provider:    o.Name(),
+		Args:        parametersFromResponse(responseMap),
+		Model:       model,
+		Usage:       usage,
 	}
 
 	return response, nil
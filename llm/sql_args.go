@@ -0,0 +1,307 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var placeholderPattern = regexp.MustCompile(`\$(\d+)`)
+
+// QueryArg is a value bound to a $n placeholder of a generated SQL query
+type QueryArg struct {
+	Value  interface{} `json:"value"`
+	Type   string      `json:"type,omitempty"`   // SQL type of the value, e.g. integer, text, timestamptz
+	Column string      `json:"column,omitempty"` // table.column the value is compared with or assigned to
+}
+
+// SQLQuery is a generated SQL statement together with its bound arguments
+type SQLQuery struct {
+	Query string     `json:"query"`
+	Args  []QueryArg `json:"args,omitempty"`
+}
+
+// ParseSQLQuery parses LLM output that is either a JSON object with "query"
+// and "args" fields, or a plain SQL statement without arguments
+func ParseSQLQuery(text string) (*SQLQuery, error) {
+	trimmed := strings.TrimSpace(text)
+	start := strings.Index(trimmed, "{")
+	end := strings.LastIndex(trimmed, "}")
+	if start < 0 || end < start || !looksLikeJSON(trimmed[:start]) {
+		return &SQLQuery{Query: trimmed}, nil
+	}
+
+	var q SQLQuery
+	if err := decodeJSON([]byte(trimmed[start:end+1]), &q); err != nil {
+		return nil, fmt.Errorf("invalid SQL query JSON: %w", err)
+	}
+	if strings.TrimSpace(q.Query) == "" {
+		return nil, errors.New("missing required field: query")
+	}
+	return &q, nil
+}
+
+// decodeJSON unmarshals data like json.Unmarshal, but decodes numbers as json.Number
+// so bigint arguments above 2^53 keep their value
+func decodeJSON(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("unexpected data after the JSON value")
+	}
+	return nil
+}
+
+// looksLikeJSON reports whether the text before the first brace is only a code fence,
+// so SQL such as `SELECT '{}'::jsonb` is not mistaken for a JSON object
+func looksLikeJSON(prefix string) bool {
+	prefix = strings.TrimSpace(prefix)
+	prefix = strings.TrimPrefix(prefix, "```")
+	prefix = strings.TrimSpace(strings.TrimPrefix(strings.ToLower(prefix), "json"))
+	return prefix == ""
+}
+
+// String returns the query as plain SQL when it has no arguments, otherwise as JSON
+func (q SQLQuery) String() string {
+	if len(q.Args) == 0 {
+		return q.Query
+	}
+	data, err := json.Marshal(q)
+	if err != nil {
+		return q.Query
+	}
+	return string(data)
+}
+
+// Values converts the arguments to the Go values passed to the database driver
+func (q SQLQuery) Values() ([]interface{}, error) {
+	values := make([]interface{}, len(q.Args))
+	for i, arg := range q.Args {
+		v, err := arg.GoValue()
+		if err != nil {
+			return nil, fmt.Errorf("argument $%d: %w", i+1, err)
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// GoValue converts the JSON value of the argument to a Go value matching its declared type
+func (a QueryArg) GoValue() (interface{}, error) {
+	if a.Value == nil {
+		return nil, nil
+	}
+
+	t := strings.ToLower(strings.TrimSpace(a.Type))
+	if strings.HasSuffix(t, "[]") {
+		items, ok := a.Value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected an array for type %s, got %T", a.Type, a.Value)
+		}
+		values := make([]interface{}, len(items))
+		for i, item := range items {
+			v, err := QueryArg{Value: item, Type: strings.TrimSuffix(t, "[]")}.GoValue()
+			if err != nil {
+				return nil, err
+			}
+			values[i] = v
+		}
+		return values, nil
+	}
+
+	switch t {
+	case "int", "int2", "int4", "int8", "integer", "tinyint", "smallint", "mediumint", "bigint", "serial", "bigserial":
+		return toInt64(a.Value)
+	case "float", "float4", "float8", "real", "double", "double precision":
+		return toFloat64(a.Value)
+	case "numeric", "decimal":
+		// Keep strings as-is so the driver does not lose precision
+		if n, ok := a.Value.(json.Number); ok {
+			return n.String(), nil
+		}
+		if s, ok := a.Value.(string); ok {
+			if _, err := strconv.ParseFloat(s, 64); err != nil {
+				return nil, fmt.Errorf("invalid %s value %q", a.Type, s)
+			}
+			return s, nil
+		}
+		return toFloat64(a.Value)
+	case "bool", "boolean":
+		switch v := a.Value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s value %q", a.Type, v)
+			}
+			return b, nil
+		}
+		return nil, fmt.Errorf("invalid %s value %v", a.Type, a.Value)
+	case "timestamp", "timestamptz", "timestamp with time zone", "timestamp without time zone", "date", "datetime":
+		s, ok := a.Value.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a string for type %s, got %T", a.Type, a.Value)
+		}
+		return parseTime(s)
+	case "text", "varchar", "char", "character varying", "citext", "uuid", "string":
+		s, ok := a.Value.(string)
+		if !ok {
+			return fmt.Sprint(a.Value), nil
+		}
+		return s, nil
+	default:
+		// json, jsonb and unknown types are passed through unchanged, with numbers
+		// converted like those of integer or float arguments
+		if n, ok := a.Value.(json.Number); ok {
+			if i, err := n.Int64(); err == nil {
+				return i, nil
+			}
+			return toFloat64(n)
+		}
+		return a.Value, nil
+	}
+}
+
+// CheckType reports whether the argument is compatible with a column whose
+// Go type is goType, as described by db.GetColumnType
+func (a QueryArg) CheckType(goType string) error {
+	v, err := a.GoValue()
+	if err != nil || v == nil {
+		return err
+	}
+
+	fields := strings.Fields(goType)
+	if len(fields) == 0 {
+		return nil
+	}
+	base := strings.TrimSuffix(fields[0], ",")
+
+	ok := true
+	switch base {
+	case "int64", "float64":
+		switch n := v.(type) {
+		case int64:
+		case float64:
+			ok = base == "float64" || n == math.Trunc(n)
+		case string:
+			_, err := strconv.ParseFloat(n, 64)
+			ok = err == nil
+		default:
+			ok = false
+		}
+	case "bool":
+		_, ok = v.(bool)
+	case "string":
+		_, ok = v.(string)
+	case "time.Time":
+		switch t := v.(type) {
+		case time.Time:
+		case string:
+			_, err := parseTime(t)
+			ok = err == nil
+		default:
+			ok = false
+		}
+	}
+
+	if !ok {
+		return fmt.Errorf("value %v (%T) does not match column %s of type %s", a.Value, a.Value, a.Column, base)
+	}
+	return nil
+}
+
+// ValidateSQLArgs checks that the $n placeholders of a query match its arguments.
+// Placeholders inside literals, quoted identifiers and comments are not counted.
+func ValidateSQLArgs(q SQLQuery) error {
+	highest := 0
+	used := map[int]bool{}
+	for _, match := range placeholderPattern.FindAllStringSubmatch(stripSQLStrings(q.Query, DialectPostgres), -1) {
+		n, err := strconv.Atoi(match[1])
+		if err != nil || n == 0 {
+			return fmt.Errorf("invalid placeholder %s", match[0])
+		}
+		used[n] = true
+		if n > highest {
+			highest = n
+		}
+	}
+
+	if highest != len(q.Args) {
+		return fmt.Errorf("query uses %d placeholders but %d arguments were provided", highest, len(q.Args))
+	}
+	for n := 1; n <= highest; n++ {
+		if !used[n] {
+			return fmt.Errorf("placeholder $%d is never used", n)
+		}
+	}
+
+	_, err := q.Values()
+	return err
+}
+
+func toInt64(v interface{}) (int64, error) {
+	switch n := v.(type) {
+	case json.Number:
+		if i, err := n.Int64(); err == nil {
+			return i, nil
+		}
+		// an integral number written with an exponent or a fraction, e.g. 1e3 or 5.0
+		f, err := n.Float64()
+		if err != nil || f != math.Trunc(f) || math.Abs(f) >= 1<<63 {
+			return 0, fmt.Errorf("expected an integer, got %v", n)
+		}
+		return int64(f), nil
+	case float64:
+		if n != math.Trunc(n) {
+			return 0, fmt.Errorf("expected an integer, got %v", n)
+		}
+		return int64(n), nil
+	case string:
+		i, err := strconv.ParseInt(n, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("expected an integer, got %q", n)
+		}
+		return i, nil
+	}
+	return 0, fmt.Errorf("expected an integer, got %T", v)
+}
+
+func toFloat64(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		if err != nil {
+			return 0, fmt.Errorf("expected a number, got %v", n)
+		}
+		return f, nil
+	case float64:
+		return n, nil
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		if err != nil {
+			return 0, fmt.Errorf("expected a number, got %q", n)
+		}
+		return f, nil
+	}
+	return 0, fmt.Errorf("expected a number, got %T", v)
+}
+
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time value %q", s)
+}
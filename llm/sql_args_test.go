@@ -0,0 +1,212 @@
+package llm
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSQLQuery(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want *SQLQuery
+		err  string
+	}{
+		{
+			name: "plain SQL",
+			text: "  SELECT * FROM orders  ",
+			want: &SQLQuery{Query: "SELECT * FROM orders"},
+		},
+		{
+			name: "JSON literal in plain SQL",
+			text: `SELECT '{"query": 1}'::jsonb`,
+			want: &SQLQuery{Query: `SELECT '{"query": 1}'::jsonb`},
+		},
+		{
+			name: "JSON with arguments",
+			text: `{"query": "SELECT * FROM orders WHERE id = $1", "args": [{"value": 9007199254740993, "type": "bigint"}]}`,
+			want: &SQLQuery{
+				Query: "SELECT * FROM orders WHERE id = $1",
+				Args:  []QueryArg{{Value: json.Number("9007199254740993"), Type: "bigint"}},
+			},
+		},
+		{
+			name: "fenced JSON",
+			text: "```json\n{\"query\": \"SELECT 1\"}\n```",
+			want: &SQLQuery{Query: "SELECT 1"},
+		},
+		{
+			name: "missing query",
+			text: `{"args": []}`,
+			err:  "missing required field: query",
+		},
+		{
+			name: "invalid JSON",
+			text: `{"query": "SELECT 1",}`,
+			err:  "invalid SQL query JSON",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSQLQuery(tt.text)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("ParseSQLQuery() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSQLQuery() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseSQLQuery() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryArgGoValue(t *testing.T) {
+	tests := []struct {
+		name string
+		arg  QueryArg
+		want interface{}
+		err  string
+	}{
+		{name: "bigint above 2^53", arg: QueryArg{Value: json.Number("9007199254740993"), Type: "bigint"}, want: int64(9007199254740993)},
+		{name: "integer with exponent", arg: QueryArg{Value: json.Number("1e3"), Type: "integer"}, want: int64(1000)},
+		{name: "integer from float64", arg: QueryArg{Value: float64(42), Type: "int"}, want: int64(42)},
+		{name: "integer from string", arg: QueryArg{Value: "42", Type: "int8"}, want: int64(42)},
+		{name: "fractional integer", arg: QueryArg{Value: json.Number("1.5"), Type: "integer"}, err: "expected an integer"},
+		{name: "integer out of range", arg: QueryArg{Value: json.Number("1e30"), Type: "bigint"}, err: "expected an integer"},
+		{name: "float", arg: QueryArg{Value: json.Number("2.5"), Type: "double precision"}, want: 2.5},
+		{name: "numeric keeps its digits", arg: QueryArg{Value: json.Number("12345678901234567.89"), Type: "numeric"}, want: "12345678901234567.89"},
+		{name: "invalid numeric string", arg: QueryArg{Value: "abc", Type: "decimal"}, err: `invalid decimal value "abc"`},
+		{name: "bool from string", arg: QueryArg{Value: "true", Type: "boolean"}, want: true},
+		{name: "timestamp", arg: QueryArg{Value: "2024-01-02", Type: "date"}, want: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{name: "text from number", arg: QueryArg{Value: json.Number("7"), Type: "text"}, want: "7"},
+		{name: "array", arg: QueryArg{Value: []interface{}{json.Number("1"), json.Number("2")}, Type: "int[]"}, want: []interface{}{int64(1), int64(2)}},
+		{name: "untyped integer", arg: QueryArg{Value: json.Number("9007199254740993")}, want: int64(9007199254740993)},
+		{name: "untyped float", arg: QueryArg{Value: json.Number("0.5")}, want: 0.5},
+		{name: "null", arg: QueryArg{Type: "integer"}, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.arg.GoValue()
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("GoValue() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GoValue() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GoValue() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryArgCheckType(t *testing.T) {
+	tests := []struct {
+		name   string
+		arg    QueryArg
+		goType string
+		ok     bool
+	}{
+		{name: "integer for int64", arg: QueryArg{Value: json.Number("5"), Type: "integer"}, goType: "int64", ok: true},
+		{name: "untyped fraction for int64", arg: QueryArg{Value: json.Number("5.5")}, goType: "int64"},
+		{name: "untyped fraction for float64", arg: QueryArg{Value: json.Number("5.5")}, goType: "float64", ok: true},
+		{name: "numeric string for float64", arg: QueryArg{Value: json.Number("5.5"), Type: "numeric"}, goType: "float64", ok: true},
+		{name: "text for int64", arg: QueryArg{Value: "five", Type: "text"}, goType: "int64"},
+		{name: "bool", arg: QueryArg{Value: true, Type: "boolean"}, goType: "bool", ok: true},
+		{name: "number for bool", arg: QueryArg{Value: json.Number("1")}, goType: "bool"},
+		{name: "date string for time", arg: QueryArg{Value: "2024-01-02", Type: "text"}, goType: "time.Time", ok: true},
+		{name: "nullable column", arg: QueryArg{Value: json.Number("5"), Type: "int"}, goType: "int64, nullable", ok: true},
+		{name: "unknown column type", arg: QueryArg{Value: "x"}, goType: "", ok: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.arg.CheckType(tt.goType)
+			if (err == nil) != tt.ok {
+				t.Errorf("CheckType(%q) error = %v, want ok %v", tt.goType, err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestValidateSQLArgs(t *testing.T) {
+	one := []QueryArg{{Value: json.Number("1"), Type: "integer"}}
+	tests := []struct {
+		name string
+		q    SQLQuery
+		err  string
+	}{
+		{
+			name: "matching placeholders",
+			q:    SQLQuery{Query: "SELECT * FROM orders WHERE id = $1 OR parent_id = $1", Args: one},
+		},
+		{
+			name: "placeholder in a literal",
+			q:    SQLQuery{Query: "SELECT * FROM orders WHERE id = $1 AND note <> 'costs $2'", Args: one},
+		},
+		{
+			name: "placeholder in an escaped literal",
+			q:    SQLQuery{Query: `SELECT * FROM orders WHERE id = $1 AND note <> E'it\'s $2'`, Args: one},
+		},
+		{
+			name: "placeholder in a dollar-quoted literal",
+			q:    SQLQuery{Query: "SELECT * FROM orders WHERE id = $1 AND note <> $$costs $2$$", Args: one},
+		},
+		{
+			name: "placeholder in a tagged dollar-quoted literal",
+			q:    SQLQuery{Query: "SELECT * FROM orders WHERE id = $1 AND note <> $q$it's $2$q$", Args: one},
+		},
+		{
+			name: "placeholder in a quoted identifier and a comment",
+			q:    SQLQuery{Query: "SELECT \"$2\" FROM orders -- $3\nWHERE id = $1", Args: one},
+		},
+		{
+			name: "too few arguments",
+			q:    SQLQuery{Query: "SELECT * FROM orders WHERE id = $1 AND total > $2", Args: one},
+			err:  "query uses 2 placeholders but 1 arguments were provided",
+		},
+		{
+			name: "skipped placeholder",
+			q:    SQLQuery{Query: "SELECT * FROM orders WHERE id = $2", Args: append(one, one...)},
+			err:  "placeholder $1 is never used",
+		},
+		{
+			name: "invalid placeholder",
+			q:    SQLQuery{Query: "SELECT * FROM orders WHERE id = $0", Args: one},
+			err:  "invalid placeholder $0",
+		},
+		{
+			name: "invalid argument",
+			q:    SQLQuery{Query: "SELECT * FROM orders WHERE id = $1", Args: []QueryArg{{Value: "one", Type: "integer"}}},
+			err:  "argument $1: expected an integer",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSQLArgs(tt.q)
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("ValidateSQLArgs() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ValidateSQLArgs() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// SQLDialect is the SQL flavour a generated query is written in. Its values
+// match the config.DBType of the database.
+type SQLDialect string
+
+const (
+	DialectPostgres SQLDialect = "postgres"
+	DialectMySQL    SQLDialect = "mysql"
+	DialectSQLite   SQLDialect = "sqlite"
+)
+
+// Placeholder returns the placeholder of the nth bound argument, counting from 1
+func (d SQLDialect) Placeholder(n int) string {
+	if d.positional() {
+		return "?"
+	}
+	return fmt.Sprintf("$%d", n)
+}
+
+// positional reports whether the dialect binds arguments to ? placeholders in order
+func (d SQLDialect) positional() bool {
+	return d == DialectMySQL || d == DialectSQLite
+}
+
+// QuoteIdentifier quotes a table or column name
+func (d SQLDialect) QuoteIdentifier(name string) string {
+	if d == DialectMySQL {
+		return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// dialectBlocked lists the functions and clauses of each dialect that read or write
+// server files, or stall the server, in addition to the operations ValidateSQL blocks
+var dialectBlocked = map[SQLDialect][]string{
+	DialectPostgres: {"pg_sleep", "pg_read_file", "pg_read_binary_file", "pg_ls_dir", "lo_import", "lo_export"},
+	DialectMySQL:    {"sleep(", "benchmark(", "load_file(", "into outfile", "into dumpfile", "get_lock("},
+	DialectSQLite:   {"load_extension(", "readfile(", "writefile(", "fts3_tokenizer("},
+}
+
+// ValidateSQLDialect validates a query like ValidateSQL and rejects the dangerous
+// functions and clauses of its dialect. Literals and comments are not searched, so
+// WHERE title = 'sleep(3)' is allowed.
+func ValidateSQLDialect(query string, dialect SQLDialect) error {
+	if err := ValidateSQL(query); err != nil {
+		return err
+	}
+	// single spaces, and none before parentheses, so "SLEEP (1)" matches sleep(
+	q := strings.Join(strings.Fields(strings.ToLower(stripSQLStrings(query, dialect))), " ")
+	q = strings.ReplaceAll(q, " (", "(")
+	for _, keyword := range dialectBlocked[dialect] {
+		if strings.Contains(q, keyword) {
+			return fmt.Errorf("query contains forbidden %s operation: %s", dialect, strings.TrimRight(keyword, "( "))
+		}
+	}
+	// the MySQL and SQLite drivers would run every statement of the query
+	if dialect.positional() && strings.Contains(strings.TrimRight(strings.TrimSpace(q), ";"), ";") {
+		return errors.New("query contains more than one statement")
+	}
+	return nil
+}
+
+// ValidateSQLArgsDialect checks that the placeholders of a query match its arguments.
+// MySQL and SQLite queries use one ? per argument, in order.
+func ValidateSQLArgsDialect(q SQLQuery, dialect SQLDialect) error {
+	if !dialect.positional() {
+		return ValidateSQLArgs(q)
+	}
+
+	if placeholderPattern.MatchString(stripSQLStrings(q.Query, dialect)) {
+		return fmt.Errorf("%s queries use ? placeholders, not $n", dialect)
+	}
+	count := strings.Count(stripSQLStrings(q.Query, dialect), "?")
+	if count != len(q.Args) {
+		return fmt.Errorf("query uses %d placeholders but %d arguments were provided", count, len(q.Args))
+	}
+	_, err := q.Values()
+	return err
+}
+
+// stripSQLStrings removes quoted literals and identifiers, and comments, from a query,
+// so placeholders can be counted without matching characters inside them. A doubled
+// quote stays inside its literal; MySQL literals and Postgres E'...' literals may also
+// escape a quote with a backslash, and Postgres literals may be $$ or $tag$ quoted.
+func stripSQLStrings(query string, dialect SQLDialect) string {
+	var b strings.Builder
+	runes := []rune(query)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\'' || r == '"' || r == '`':
+			backslash := r == '\'' && (dialect == DialectMySQL ||
+				dialect == DialectPostgres && i > 0 && (runes[i-1] == 'E' || runes[i-1] == 'e'))
+			for i++; i < len(runes); i++ {
+				if runes[i] == '\\' && backslash {
+					i++
+				} else if runes[i] == r {
+					if i+1 < len(runes) && runes[i+1] == r {
+						i++
+						continue
+					}
+					break
+				}
+			}
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			b.WriteRune(' ')
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			for i += 3; i < len(runes) && !(runes[i] == '/' && runes[i-1] == '*'); i++ {
+			}
+			b.WriteRune(' ')
+		case r == '$' && dialect == DialectPostgres:
+			tag, ok := dollarQuoteTag(runes[i:])
+			if !ok {
+				b.WriteRune(r)
+				continue
+			}
+			j := i + len(tag)
+			for j+len(tag) <= len(runes) && string(runes[j:j+len(tag)]) != string(tag) {
+				j++
+			}
+			i = j + len(tag) - 1
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// dollarQuoteTag returns the $$ or $tag$ delimiter a Postgres dollar-quoted literal
+// starts with, when runes starts with one. $1 is a placeholder: tags cannot start with a digit.
+func dollarQuoteTag(runes []rune) ([]rune, bool) {
+	for i := 1; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '$':
+			return runes[:i+1], true
+		case r == '_' || unicode.IsLetter(r) || (i > 1 && unicode.IsDigit(r)):
+		default:
+			return nil, false
+		}
+	}
+	return nil, false
+}
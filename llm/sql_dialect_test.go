@@ -0,0 +1,80 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateSQLDialect(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		dialect SQLDialect
+		err     string
+	}{
+		{
+			name:    "semicolon in a literal",
+			query:   "SELECT * FROM notes WHERE note = 'a;b'",
+			dialect: DialectMySQL,
+		},
+		{
+			name:    "semicolon in a comment",
+			query:   "SELECT * FROM notes -- a;b\nWHERE id = 1",
+			dialect: DialectSQLite,
+		},
+		{
+			name:    "trailing semicolon",
+			query:   "SELECT * FROM notes;",
+			dialect: DialectMySQL,
+		},
+		{
+			name:    "two statements",
+			query:   "SELECT * FROM notes; SELECT * FROM users",
+			dialect: DialectSQLite,
+			err:     "more than one statement",
+		},
+		{
+			name:    "blocked function in a literal",
+			query:   "SELECT * FROM books WHERE title = 'sleep(3)'",
+			dialect: DialectMySQL,
+		},
+		{
+			name:    "blocked function in a dollar-quoted literal",
+			query:   "SELECT * FROM books WHERE title = $$pg_sleep(3)$$",
+			dialect: DialectPostgres,
+		},
+		{
+			name:    "blocked function",
+			query:   "SELECT SLEEP (3) FROM books",
+			dialect: DialectMySQL,
+			err:     "forbidden mysql operation: sleep",
+		},
+		{
+			name:    "blocked function after a literal",
+			query:   "SELECT * FROM books WHERE title = 'a' AND pg_sleep(3) IS NULL",
+			dialect: DialectPostgres,
+			err:     "forbidden postgres operation: pg_sleep",
+		},
+		{
+			name:    "blocked clause with a quoted path",
+			query:   "SELECT * FROM books INTO OUTFILE '/tmp/books'",
+			dialect: DialectMySQL,
+			err:     "forbidden mysql operation: into outfile",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSQLDialect(tt.query, tt.dialect)
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("ValidateSQLDialect() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ValidateSQLDialect() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
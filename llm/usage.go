@@ -0,0 +1,87 @@
+package llm
+
+import (
+	"sort"
+	"strings"
+)
+
+// Usage reports the tokens consumed by an LLM call
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// ModelUsage is the usage of a call priced under the model that made it
+type ModelUsage struct {
+	Model string
+	Usage Usage
+}
+
+// Add returns the sum of two usages
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokens + other.PromptTokens,
+		CompletionTokens: u.CompletionTokens + other.CompletionTokens,
+		TotalTokens:      u.TotalTokens + other.TotalTokens,
+	}
+}
+
+// Sub returns the usage of u that is not in other, e.g. the tokens used between two readings
+func (u Usage) Sub(other Usage) Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokens - other.PromptTokens,
+		CompletionTokens: u.CompletionTokens - other.CompletionTokens,
+		TotalTokens:      u.TotalTokens - other.TotalTokens,
+	}
+}
+
+// ModelPrice is the price of a model per 1,000 tokens
+type ModelPrice struct {
+	PromptPer1K     float64
+	CompletionPer1K float64
+}
+
+// PriceTable looks up the price of a model
+type PriceTable interface {
+	Price(model string) (ModelPrice, bool)
+}
+
+// StaticPriceTable is a PriceTable backed by a map of model name to price.
+// A model without an exact entry uses the longest key that prefixes it,
+// so "gpt-4o" also prices dated snapshots such as "gpt-4o-2024-08-06".
+type StaticPriceTable map[string]ModelPrice
+
+// Price returns the price for the given model
+func (t StaticPriceTable) Price(model string) (ModelPrice, bool) {
+	if price, ok := t[model]; ok {
+		return price, true
+	}
+
+	keys := make([]string, 0, len(t))
+	for k := range t {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return len(keys[i]) > len(keys[j]) })
+
+	for _, k := range keys {
+		if strings.HasPrefix(model, k) {
+			return t[k], true
+		}
+	}
+	return ModelPrice{}, false
+}
+
+// Cost computes the cost of usage for the given model.
+// It returns 0 when the table is nil or has no price for the model.
+func Cost(table PriceTable, model string, usage Usage) float64 {
+	if table == nil {
+		return 0
+	}
+	price, ok := table.Price(model)
+	if !ok {
+		return 0
+	}
+	return float64(usage.PromptTokens)/1000*price.PromptPer1K +
+		float64(usage.CompletionTokens)/1000*price.CompletionPer1K
+}
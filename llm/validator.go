@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
 )
 
@@ -39,8 +41,14 @@ func ValidateSQL(query string) error {
 	return nil
 }
 
-// ValidateMongo validates a MongoDB query JSON
+// ValidateMongo validates a MongoDB query JSON against DefaultMongoPolicy
 func ValidateMongo(query string) error {
+	return ValidateMongoWithPolicy(query, DefaultMongoPolicy())
+}
+
+// ValidateMongoWithPolicy validates a MongoDB query JSON and applies policy to
+// its operation, operators and aggregation pipeline
+func ValidateMongoWithPolicy(query string, policy MongoPolicy) error {
 	// Parse the JSON
 	var mongoQuery map[string]interface{}
 	if err := json.Unmarshal([]byte(query), &mongoQuery); err != nil {
@@ -61,7 +69,10 @@ func ValidateMongo(query string) error {
 	// Validate operation type
 	if opStr, ok := operation.(string); ok {
 		// Allowed operations
-		allowedOps := []string{"find", "insert", "update", "aggregate"}
+		allowedOps := []string{
+			"find", "findOne", "insert", "insertMany", "update", "aggregate",
+			"countDocuments", "estimatedDocumentCount", "distinct", "bulkWrite",
+		}
 		isValidOp := false
 		for _, allowed := range allowedOps {
 			if opStr == allowed {
@@ -79,6 +90,9 @@ func ValidateMongo(query string) error {
 			if _, ok := mongoQuery["filter"]; !ok {
 				return errors.New("find operation requires filter field")
 			}
+			if err := validateFindOptions(mongoQuery); err != nil {
+				return err
+			}
 		case "insert":
 			if _, ok := mongoQuery["document"]; !ok {
 				return errors.New("insert operation requires document field")
@@ -94,6 +108,42 @@ func ValidateMongo(query string) error {
 			if _, ok := mongoQuery["pipeline"]; !ok {
 				return errors.New("aggregate operation requires pipeline field")
 			}
+		case "findOne":
+			if _, ok := mongoQuery["filter"]; !ok {
+				return errors.New("findOne operation requires filter field")
+			}
+			if err := validateFindOptions(mongoQuery); err != nil {
+				return err
+			}
+		case "countDocuments":
+			if err := validateOptionalObject(mongoQuery, "filter"); err != nil {
+				return err
+			}
+		case "estimatedDocumentCount":
+			if filter, ok := mongoQuery["filter"].(map[string]interface{}); ok && len(filter) > 0 {
+				return errors.New("estimatedDocumentCount does not accept a filter, use countDocuments")
+			}
+		case "distinct":
+			if field, ok := mongoQuery["field"].(string); !ok || field == "" {
+				return errors.New("distinct operation requires field")
+			}
+			if err := validateOptionalObject(mongoQuery, "filter"); err != nil {
+				return err
+			}
+		case "insertMany":
+			docs, ok := mongoQuery["documents"].([]interface{})
+			if !ok || len(docs) == 0 {
+				return errors.New("insertMany operation requires a non-empty documents array")
+			}
+			for i, doc := range docs {
+				if _, ok := doc.(map[string]interface{}); !ok {
+					return fmt.Errorf("document %d must be an object", i)
+				}
+			}
+		case "bulkWrite":
+			if err := validateBulkWrite(mongoQuery); err != nil {
+				return err
+			}
 		}
 	} else {
 		return errors.New("operation must be a string")
@@ -104,5 +154,165 @@ func ValidateMongo(query string) error {
 		return errors.New("collection must be a string")
 	}
 
+	return validatePolicy(mongoQuery, policy)
+}
+
+// validateFindOptions validates the projection, sort, limit, skip, hint and collation of a find
+func validateFindOptions(mongoQuery map[string]interface{}) error {
+	if projection, ok := mongoQuery["projection"]; ok && projection != nil {
+		fields, ok := projection.(map[string]interface{})
+		if !ok {
+			return errors.New("projection must be an object")
+		}
+		included, excluded := false, false
+		for field, v := range fields {
+			switch value := v.(type) {
+			case bool:
+				included, excluded = included || value, excluded || (!value && field != "_id")
+			case float64:
+				if value != 0 && value != 1 {
+					return fmt.Errorf("projection value for %s must be 0 or 1", field)
+				}
+				included, excluded = included || value == 1, excluded || (value == 0 && field != "_id")
+			case map[string]interface{}, string:
+				// projection operators such as $slice and $elemMatch, or aggregation expressions
+			default:
+				return fmt.Errorf("invalid projection value for %s", field)
+			}
+		}
+		if included && excluded {
+			return errors.New("projection cannot mix inclusion and exclusion")
+		}
+	}
+
+	if sort, ok := mongoQuery["sort"]; ok && sort != nil {
+		fields, ok := sort.(map[string]interface{})
+		if !ok {
+			return errors.New("sort must be an object")
+		}
+		for field, v := range fields {
+			switch value := v.(type) {
+			case float64:
+				if value != 1 && value != -1 {
+					return fmt.Errorf("sort direction for %s must be 1 or -1", field)
+				}
+			case map[string]interface{}:
+				if value["$meta"] != "textScore" {
+					return fmt.Errorf("invalid sort value for %s", field)
+				}
+			default:
+				return fmt.Errorf("invalid sort value for %s", field)
+			}
+		}
+	}
+
+	for _, key := range []string{"limit", "skip"} {
+		v, ok := mongoQuery[key]
+		if !ok || v == nil {
+			continue
+		}
+		if n, ok := mongoInteger(v); !ok || n < 0 {
+			return fmt.Errorf("%s must be a non-negative integer", key)
+		}
+	}
+
+	if hint, ok := mongoQuery["hint"]; ok && hint != nil {
+		switch hint.(type) {
+		case string, map[string]interface{}:
+		default:
+			return errors.New("hint must be an index name or an index key object")
+		}
+	}
+
+	if collation, ok := mongoQuery["collation"]; ok && collation != nil {
+		fields, ok := collation.(map[string]interface{})
+		if !ok {
+			return errors.New("collation must be an object")
+		}
+		if locale, ok := fields["locale"].(string); !ok || locale == "" {
+			return errors.New("collation requires a locale")
+		}
+	}
+
+	return nil
+}
+
+// mongoInteger returns the value of an integer written as a JSON number, a Go integer
+// decoded from BSON, or an Extended JSON {"$numberLong": "10"} or {"$numberInt": "10"}
+func mongoInteger(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case int:
+		return int64(n), true
+	case float64:
+		return int64(n), n == math.Trunc(n) && math.Abs(n) < 1<<63
+	case map[string]interface{}:
+		if len(n) != 1 {
+			return 0, false
+		}
+		for _, key := range []string{"$numberLong", "$numberInt"} {
+			if s, ok := n[key].(string); ok {
+				i, err := strconv.ParseInt(s, 10, 64)
+				return i, err == nil
+			}
+		}
+	}
+	return 0, false
+}
+
+// validateOptionalObject checks that key, when present, holds an object
+func validateOptionalObject(mongoQuery map[string]interface{}, key string) error {
+	v, ok := mongoQuery[key]
+	if !ok || v == nil {
+		return nil
+	}
+	if _, ok := v.(map[string]interface{}); !ok {
+		return fmt.Errorf("%s must be an object", key)
+	}
+	return nil
+}
+
+// bulkWriteRequiredFields lists the allowed bulk write operations and the fields each requires.
+// Deletes are not allowed, matching the top-level operations.
+var bulkWriteRequiredFields = map[string][]string{
+	"insertOne":  {"document"},
+	"updateOne":  {"filter", "update"},
+	"updateMany": {"filter", "update"},
+	"replaceOne": {"filter", "replacement"},
+}
+
+// validateBulkWrite validates the operations of a bulkWrite
+func validateBulkWrite(mongoQuery map[string]interface{}) error {
+	ops, ok := mongoQuery["operations"].([]interface{})
+	if !ok || len(ops) == 0 {
+		return errors.New("bulkWrite operation requires a non-empty operations array")
+	}
+
+	for i, op := range ops {
+		wrapper, ok := op.(map[string]interface{})
+		if !ok || len(wrapper) != 1 {
+			return fmt.Errorf("bulkWrite operation %d must be an object with a single operation key", i)
+		}
+		for opName, body := range wrapper {
+			required, ok := bulkWriteRequiredFields[opName]
+			if !ok {
+				return fmt.Errorf("bulkWrite operation %d: %s is not allowed", i, opName)
+			}
+			fields, ok := body.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("bulkWrite operation %d: %s must be an object", i, opName)
+			}
+			for _, field := range required {
+				if _, ok := fields[field].(map[string]interface{}); !ok {
+					if _, isPipeline := fields[field].([]interface{}); !(isPipeline && field == "update") {
+						return fmt.Errorf("bulkWrite operation %d: %s requires %s", i, opName, field)
+					}
+				}
+			}
+		}
+	}
 	return nil
 }
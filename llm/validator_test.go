@@ -0,0 +1,48 @@
+package llm
+
+import "testing"
+
+func TestValidateFindOptionsLimitAndSkip(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		ok    bool
+	}{
+		{name: "JSON number", value: float64(10), ok: true},
+		{name: "integral float", value: 10.0, ok: true},
+		{name: "int32", value: int32(10), ok: true},
+		{name: "int64", value: int64(10), ok: true},
+		{name: "numberLong", value: map[string]interface{}{"$numberLong": "10"}, ok: true},
+		{name: "numberInt", value: map[string]interface{}{"$numberInt": "10"}, ok: true},
+		{name: "fraction", value: 10.5},
+		{name: "negative", value: int64(-1)},
+		{name: "negative numberLong", value: map[string]interface{}{"$numberLong": "-1"}},
+		{name: "invalid numberLong", value: map[string]interface{}{"$numberLong": "ten"}},
+		{name: "string", value: "10"},
+	}
+
+	for _, tt := range tests {
+		for _, key := range []string{"limit", "skip"} {
+			t.Run(tt.name+"/"+key, func(t *testing.T) {
+				err := validateFindOptions(map[string]interface{}{key: tt.value})
+				if (err == nil) != tt.ok {
+					t.Errorf("validateFindOptions(%s: %v) error = %v, want ok %v", key, tt.value, err, tt.ok)
+				}
+			})
+		}
+	}
+}
+
+func TestValidateMongoNumberLongLimit(t *testing.T) {
+	query := `{"operation": "find", "collection": "orders", "filter": {}, "limit": {"$numberLong": "10"}, "skip": 20}`
+	if err := ValidateMongo(query); err != nil {
+		t.Fatalf("ValidateMongo() error = %v", err)
+	}
+	q, err := ParseMongoQuery(query)
+	if err != nil {
+		t.Fatalf("ParseMongoQuery() error = %v", err)
+	}
+	if q.Limit != 10 || q.Skip != 20 {
+		t.Errorf("limit, skip = %d, %d, want 10, 20", q.Limit, q.Skip)
+	}
+}
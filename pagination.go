@@ -0,0 +1,196 @@
+package prompterdb
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/vijaylingoju/prompterdb/config"
+	"github.com/vijaylingoju/prompterdb/db"
+)
+
+// ErrInvalidPageToken is returned by FetchPage for tokens that were altered or not issued by this process
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+var (
+	pageTokenKey   []byte
+	pageTokenKeyMu sync.RWMutex
+)
+
+func init() {
+	pageTokenKey = make([]byte, 32)
+	if _, err := rand.Read(pageTokenKey); err != nil {
+		panic(fmt.Sprintf("failed to generate page token key: %v", err))
+	}
+}
+
+// SetPageTokenKey sets the key page tokens are signed with. Services running
+// several instances must share a key so any instance can serve the next page.
+func SetPageTokenKey(key []byte) {
+	pageTokenKeyMu.Lock()
+	defer pageTokenKeyMu.Unlock()
+	pageTokenKey = append([]byte(nil), key...)
+}
+
+// pageToken is the state needed to fetch the next page of a generated query
+type pageToken struct {
+	Database   string      `json:"db"`
+	Query      string      `json:"q"`           // validated query as generated by the LLM
+	Collection string      `json:"c,omitempty"` // Mongo collection the query runs on
+	Size       int         `json:"n"`           // rows per page
+	Offset     int64       `json:"o,omitempty"` // rows already returned, for offset pagination
+	Key        string      `json:"k,omitempty"` // ordering column, for keyset pagination
+	After      interface{} `json:"a,omitempty"` // last key value returned
+}
+
+// firstPage returns the page state for the first page of a query
+func firstPage(opts AskOptions, database, rawQuery, collection string) pageToken {
+	size := opts.PageSize
+	if size <= 0 {
+		size = db.RowLimit()
+	}
+	return pageToken{Database: database, Query: rawQuery, Collection: collection, Size: size, Key: opts.PageKey}
+}
+
+// next returns the token for the page following rs, or "" when there is none
+func (p pageToken) next(rs *db.ResultSet) (string, error) {
+	if !rs.Truncated || len(rs.Rows) == 0 {
+		return "", nil
+	}
+	next := p
+	if p.Key != "" {
+		i := rs.ColumnIndex(p.Key)
+		if i < 0 {
+			return "", fmt.Errorf("page key %s is not a column of the result", p.Key)
+		}
+		// Rows that tie on the key at the page boundary would be skipped by the next page
+		for r := 1; r < len(rs.Rows); r++ {
+			if reflect.DeepEqual(rs.Rows[r][i], rs.Rows[r-1][i]) {
+				return "", fmt.Errorf("page key %s is not unique: value %v repeats", p.Key, rs.Rows[r][i])
+			}
+		}
+		next.After = rs.Rows[len(rs.Rows)-1][i]
+	} else {
+		next.Offset += int64(len(rs.Rows))
+	}
+	return encodePageToken(next)
+}
+
+// setPage records the rows of a page and the token for the next one on result
+func (p pageToken) setPage(result *AskResult, rs *db.ResultSet) error {
+	token, err := p.next(rs)
+	if err != nil {
+		return err
+	}
+	result.Result = rs
+	result.Rows = rs.Maps()
+	result.Truncated = rs.Truncated
+	result.NextPageToken = token
+	return nil
+}
+
+func encodePageToken(p pageToken) (string, error) {
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode page token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(signPageToken(payload)), nil
+}
+
+func decodePageToken(token string) (pageToken, error) {
+	var p pageToken
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return p, ErrInvalidPageToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return p, ErrInvalidPageToken
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, signPageToken(payload)) {
+		return p, ErrInvalidPageToken
+	}
+	// Decode numbers as json.Number so int64 keys above 2^53 keep their value
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	if err := dec.Decode(&p); err != nil {
+		return p, fmt.Errorf("%w: %v", ErrInvalidPageToken, err)
+	}
+	if n, ok := p.After.(json.Number); ok {
+		p.After = pageKeyNumber(n)
+	}
+	return p, nil
+}
+
+// pageKeyNumber converts a numeric page key to an int64, or to a float64 when it has a fraction
+func pageKeyNumber(n json.Number) interface{} {
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+	if f, err := n.Float64(); err == nil {
+		return f
+	}
+	return n.String()
+}
+
+func signPageToken(payload []byte) []byte {
+	pageTokenKeyMu.RLock()
+	defer pageTokenKeyMu.RUnlock()
+	mac := hmac.New(sha256.New, pageTokenKey)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// FetchPage returns the page of rows identified by a token from AskResult.NextPageToken.
+// The query in the token is validated again before it runs; the LLM is not called.
+func FetchPage(ctx context.Context, token string, opts AskOptions) (*AskResult, error) {
+	p, err := decodePageToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	targetDB, ok := config.RegisteredDBs[p.Database]
+	if !ok {
+		return nil, fmt.Errorf("database %s is not registered", p.Database)
+	}
+	result := &AskResult{Database: targetDB.Name}
+
+	drv, err := db.GetDriver(targetDB.Type)
+	if err != nil {
+		return nil, err
+	}
+	execOpts := execOptions(opts, p.Collection)
+	stmt, err := drv.Validate(targetDB, p.Query, execOpts)
+	if err != nil {
+		return nil, fmt.Errorf("query validation failed: %w", err)
+	}
+	if !stmt.Pageable {
+		return nil, fmt.Errorf("%w: the query does not return pages", ErrInvalidPageToken)
+	}
+	result.Query, result.Args = stmt.Query, stmt.Args
+	if err := runPage(ctx, drv, targetDB, stmt, p, execOpts, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// runPage runs the page of a statement selected by p and records it on result
+func runPage(ctx context.Context, drv db.Driver, targetDB config.DBConfig, stmt *db.Statement, p pageToken, execOpts db.ExecOptions, result *AskResult) error {
+	execOpts.Page = db.Page{Size: p.Size, Offset: p.Offset, Key: p.Key, After: p.After}
+	rs, err := drv.Execute(ctx, targetDB, stmt, execOpts)
+	if err != nil {
+		return err
+	}
+	return p.setPage(result, rs)
+}
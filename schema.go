@@ -37,15 +37,9 @@ func IntrospectAllSchemasWithContext(ctx context.Context) error {
 				return
 			default:
 				var schema string
-				var err error
-
-				switch cfg.Type {
-				case config.Postgres:
-					schema, err = db.GetPostgresSchema(name)
-				case config.Mongo:
-					schema, err = db.GetMongoSchema(name)
-				default:
-					err = fmt.Errorf("unsupported DB type: %s", cfg.Type)
+				drv, err := db.GetDriver(cfg.Type)
+				if err == nil {
+					schema, err = drv.Introspect(ctx, name)
 				}
 
 				if err != nil {
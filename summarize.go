@@ -0,0 +1,168 @@
+package prompterdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/vijaylingoju/prompterdb/config"
+	"github.com/vijaylingoju/prompterdb/db"
+	"github.com/vijaylingoju/prompterdb/llm"
+	"github.com/vijaylingoju/prompterdb/templates"
+)
+
+// Summary is a natural language answer to the question of a result
+type Summary struct {
+	Answer string `json:"answer"`
+	// Caveats qualify the answer, e.g. that the rows were truncated or which
+	// assumptions the query made
+	Caveats []string `json:"caveats,omitempty"`
+}
+
+// Summarize asks the LLM to answer the question of a result in a sentence or two, such
+// as "Revenue grew 12% to $4.2M". The model is shown the question, the generated query,
+// the first rows and statistics of every column, not the full result. The summary is
+// stored on result.Summary and its tokens are added to result.Usage.
+//
+// The prompt is the summaries/<TemplateKey>/default.tmpl template of the result's
+// database, or summaries/default/default.tmpl.
+func Summarize(ctx context.Context, result *AskResult, llmClient llm.LLM, opts AskOptions) (*Summary, error) {
+	if result == nil {
+		return nil, errors.New("result cannot be nil")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	rs := result.Result
+	if rs == nil {
+		rs = db.NewResultSet(result.Rows)
+	}
+
+	tm, err := useDefaultTemplates(llmClient)
+	if err != nil {
+		return nil, err
+	}
+	req := llm.QueryRequest{
+		Prompt:    result.Prompt,
+		DBType:    summaryTemplateKey(tm, result.Database),
+		QueryType: llm.QueryTypeSummary,
+		CustomVars: map[string]interface{}{
+			"Query":     result.Query,
+			"Database":  result.Database,
+			"Rows":      summarizeResult(rs),
+			"RowCount":  len(rs.Rows),
+			"Truncated": rs.Truncated,
+		},
+	}
+	resp, err := generateQuery(ctx, llmClient, req, opts, result)
+	if err != nil {
+		return nil, fmt.Errorf("llm summarization failed: %w", err)
+	}
+
+	summary := parseSummary(cleanMongoText(resp.Query))
+	if summary.Answer == "" {
+		return nil, errors.New("the model returned an empty summary")
+	}
+	summary.Caveats = append(resultCaveats(result, rs), summary.Caveats...)
+	result.Summary = summary
+	return summary, nil
+}
+
+// summaryTemplateKey returns the summaries directory for a database: its driver's
+// template key when there is a template for it, else "default"
+func summaryTemplateKey(tm *templates.TemplateManager, database string) string {
+	if cfg, ok := config.RegisteredDBs[database]; ok {
+		if drv, err := db.GetDriver(cfg.Type); err == nil {
+			return templateKey(tm, templates.Summary, strings.ToLower(drv.TemplateKey()))
+		}
+	}
+	return "default"
+}
+
+// parseSummary reads a summary written as {"answer": ..., "caveats": [...]}. A reply
+// that is not JSON is taken as the answer.
+func parseSummary(text string) *Summary {
+	var summary Summary
+	if err := json.Unmarshal([]byte(text), &summary); err != nil {
+		return &Summary{Answer: strings.TrimSpace(text)}
+	}
+	summary.Answer = strings.TrimSpace(summary.Answer)
+	return &summary
+}
+
+// resultCaveats returns the caveats that follow from how a result was produced
+func resultCaveats(result *AskResult, rs *db.ResultSet) []string {
+	var caveats []string
+	if rs.Truncated {
+		caveats = append(caveats, fmt.Sprintf("Only the first %d rows were read; the query returned more.", len(rs.Rows)))
+	}
+	if len(rs.Rows) == 0 {
+		caveats = append(caveats, "The query returned no rows.")
+	}
+	if result.ReusedFrom != "" {
+		caveats = append(caveats, fmt.Sprintf("The query was reused from the similar question %q.", result.ReusedFrom))
+	}
+	return caveats
+}
+
+// columnStats describes the values of each column of a result: the range and total of
+// numbers and times, and the number of distinct values of others
+func columnStats(rs *db.ResultSet) string {
+	var b strings.Builder
+	for i, c := range rs.Columns {
+		var count, nulls, numbers int
+		min, max, sum := math.Inf(1), math.Inf(-1), 0.0
+		var first, last string
+		distinct := map[string]bool{}
+		for _, row := range rs.Rows {
+			if i >= len(row) || row[i] == nil {
+				nulls++
+				continue
+			}
+			count++
+			switch c.Type {
+			case db.TypeNumber:
+				if f, ok := numericValue(row[i]); ok {
+					min, max, sum = math.Min(min, f), math.Max(max, f), sum+f
+					numbers++
+				}
+			case db.TypeTime:
+				s := fmt.Sprint(row[i])
+				if t, ok := row[i].(time.Time); ok {
+					s = t.UTC().Format(time.RFC3339)
+				}
+				if first == "" || s < first {
+					first = s
+				}
+				if s > last {
+					last = s
+				}
+			default:
+				if len(distinct) <= 1000 {
+					distinct[fmt.Sprint(row[i])] = true
+				}
+			}
+		}
+
+		fmt.Fprintf(&b, "%s: %d values", c.Name, count)
+		if nulls > 0 {
+			fmt.Fprintf(&b, ", %d null", nulls)
+		}
+		switch {
+		case c.Type == db.TypeNumber && numbers > 0:
+			fmt.Fprintf(&b, ", min %g, max %g, sum %g, avg %g", min, max, sum, sum/float64(numbers))
+		case c.Type == db.TypeTime && first != "":
+			fmt.Fprintf(&b, ", from %s to %s", first, last)
+		case len(distinct) > 1000:
+			b.WriteString(", over 1000 distinct")
+		case len(distinct) > 0:
+			fmt.Fprintf(&b, ", %d distinct", len(distinct))
+		}
+		b.WriteByte('\n')
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -30,17 +30,9 @@ func (tm *TemplateManager) parseTemplatePath(path string) (templateType Template
 		return "", "", "", fmt.Errorf("invalid template path structure, expected: <type>/[subtype/]<db_type>/<file>, got: %s", relPath)
 	}
 
-	// Determine template type based on path
-	switch {
-	case strings.HasPrefix(relPath, "system_prompts/mongo"):
-		templateType = MongoSystemPrompt
-	case strings.HasPrefix(relPath, "system_prompts"):
-		templateType = SystemPrompt
-	case strings.HasPrefix(relPath, "response_formats/mongo"):
-		templateType = MongoResponseFormat
-	case strings.HasPrefix(relPath, "response_formats"):
-		templateType = ResponseFormat
-	default:
+	// Determine template type based on path, see Kinds
+	templateType, ok := typeOfPath(relPath)
+	if !ok {
 		return "", "", "", fmt.Errorf("unknown template type in path: %s", relPath)
 	}
 
@@ -82,6 +74,11 @@ func (tm *TemplateManager) processTemplateFile(path string, readFile func(string
 		return fmt.Errorf("template file is empty: %s", path)
 	}
 
+	// Fail on syntax errors and misspelled variables now rather than when the template is used
+	if err := ValidateTemplate(templateType, string(content)); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
@@ -0,0 +1,203 @@
+package templates
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"text/template/parse"
+)
+
+// Kind describes a stage that renders templates: the directory its templates are
+// loaded from and the variables the stage passes to them
+type Kind struct {
+	Name string       // stage, e.g. "generation"
+	Type TemplateType // directory of the templates under the template root
+	// Required variables must be used by every template of the kind
+	Required []string
+	// Optional variables may be used as well; any other variable is reported as a typo
+	Optional []string
+}
+
+// promptVars are passed by the LLM clients to every prompt template
+var promptVars = []string{"Schema", "UserRequest", "DBType", "Examples"}
+
+// generationVars are the variables of query generation, which response formats are also given
+var generationVars = []string{"Collection", "AllowClarification", "Clarifications", "Clarified"}
+
+var (
+	kindsMu sync.RWMutex
+	kinds   = map[TemplateType]Kind{}
+)
+
+func init() {
+	for _, kind := range []Kind{
+		{Name: "generation", Type: SystemPrompt, Required: []string{"Schema", "UserRequest"}, Optional: generationVars},
+		{Name: "generation", Type: MongoSystemPrompt, Required: []string{"Schema", "UserRequest"}, Optional: generationVars},
+		{Name: "response", Type: ResponseFormat, Optional: append([]string{
+			"Query", "Explanation", "Timestamp", "Database", "Parameters", "ParametersJSON", "Operation", "Filter",
+		}, generationVars...)},
+		{Name: "response", Type: MongoResponseFormat, Optional: append([]string{
+			"Query", "Explanation", "Timestamp", "Database", "Parameters", "ParametersJSON", "Operation", "Filter",
+		}, generationVars...)},
+		{Name: "planning", Type: Plan, Required: []string{"Schema", "UserRequest", "Databases"}, Optional: []string{"JoinKeys"}},
+		{Name: "agent", Type: Agent, Required: []string{"UserRequest", "Databases", "Steps"}, Optional: []string{"Plan", "StepsLeft", "Final"}},
+		{Name: "clarification", Type: Clarification, Required: []string{"Clarifications"}},
+		{Name: "summarization", Type: Summary, Required: []string{"UserRequest", "Rows"}, Optional: []string{"Query", "Database", "RowCount", "Truncated"}},
+		{Name: "visualization", Type: Visualization, Required: []string{"Results"}, Optional: []string{"RowCount"}},
+	} {
+		// Every stage may use the variables the LLM clients pass to all prompts
+		kind.Optional = append(append([]string(nil), kind.Optional...), promptVars...)
+		kinds[kind.Type] = kind
+	}
+}
+
+// RegisterKind adds a kind of template, or replaces the kind of the same type
+func RegisterKind(kind Kind) {
+	kindsMu.Lock()
+	defer kindsMu.Unlock()
+	kinds[kind.Type] = kind
+}
+
+// DeclareVariables adds optional variables to the kind of a template type, e.g. the
+// variables a custom driver adds to its generation requests
+func DeclareVariables(templateType TemplateType, names ...string) error {
+	kindsMu.Lock()
+	defer kindsMu.Unlock()
+	kind, ok := kinds[templateType]
+	if !ok {
+		return fmt.Errorf("unknown template type: %s", templateType)
+	}
+	kind.Optional = append(append([]string(nil), kind.Optional...), names...)
+	kinds[templateType] = kind
+	return nil
+}
+
+// KindOf returns the kind of a template type
+func KindOf(templateType TemplateType) (Kind, bool) {
+	kindsMu.RLock()
+	defer kindsMu.RUnlock()
+	kind, ok := kinds[templateType]
+	return kind, ok
+}
+
+// Kinds returns the registered kinds, ordered by type
+func Kinds() []Kind {
+	kindsMu.RLock()
+	defer kindsMu.RUnlock()
+	list := make([]Kind, 0, len(kinds))
+	for _, kind := range kinds {
+		list = append(list, kind)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Type < list[j].Type })
+	return list
+}
+
+// typeOfPath returns the template type of a path relative to the template root: the
+// type of the longest registered directory the path is in
+func typeOfPath(relPath string) (TemplateType, bool) {
+	kindsMu.RLock()
+	defer kindsMu.RUnlock()
+	var best TemplateType
+	for t := range kinds {
+		if strings.HasPrefix(relPath, string(t)+"/") && len(t) > len(best) {
+			best = t
+		}
+	}
+	return best, best != ""
+}
+
+// ValidateTemplate parses a template and checks its variables against the kind of its
+// type: every required variable must be used, and no variable the kind does not declare.
+// Templates of types without a kind are only parsed.
+func ValidateTemplate(templateType TemplateType, content string) error {
+	tmpl, err := template.New(string(templateType)).Funcs(funcMap).Parse(content)
+	if err != nil {
+		return fmt.Errorf("error parsing template: %w", err)
+	}
+	kind, ok := KindOf(templateType)
+	if !ok {
+		return nil
+	}
+
+	used := map[string]bool{}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			collectVars(t.Tree.Root, true, used)
+		}
+	}
+
+	declared := map[string]bool{}
+	for _, name := range append(append([]string(nil), kind.Required...), kind.Optional...) {
+		declared[name] = true
+	}
+	var problems []string
+	for _, name := range kind.Required {
+		if !used[name] {
+			problems = append(problems, fmt.Sprintf("required variable .%s is not used", name))
+		}
+	}
+	var unknown []string
+	for name := range used {
+		if !declared[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		problems = append(problems, fmt.Sprintf("unknown variable .%s", name))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid %s template: %s", kind.Name, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// collectVars adds the top-level variables a template node uses to used. root is
+// false inside range and with blocks, where the dot is no longer the template data.
+func collectVars(node parse.Node, root bool, used map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectVars(child, root, used)
+		}
+	case *parse.ActionNode:
+		collectVars(n.Pipe, root, used)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			for _, arg := range cmd.Args {
+				collectVars(arg, root, used)
+			}
+		}
+	case *parse.IfNode:
+		collectVars(n.Pipe, root, used)
+		collectVars(n.List, root, used)
+		collectVars(n.ElseList, root, used)
+	case *parse.RangeNode:
+		collectVars(n.Pipe, root, used)
+		collectVars(n.List, false, used)
+		collectVars(n.ElseList, root, used)
+	case *parse.WithNode:
+		collectVars(n.Pipe, root, used)
+		collectVars(n.List, false, used)
+		collectVars(n.ElseList, root, used)
+	case *parse.TemplateNode:
+		collectVars(n.Pipe, root, used)
+	case *parse.FieldNode:
+		if root {
+			used[n.Ident[0]] = true
+		}
+	case *parse.VariableNode:
+		// $ is the template data wherever it is used
+		if n.Ident[0] == "$" && len(n.Ident) > 1 {
+			used[n.Ident[1]] = true
+		}
+	}
+}
@@ -4,11 +4,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"html/template"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"text/template"
 )
 
 type TemplateType string
@@ -23,8 +23,29 @@ const (
 	ResponseFormat TemplateType = "response_formats"
 	// MongoResponseFormat is the template type for MongoDB response formats
 	MongoResponseFormat TemplateType = "response_formats/mongo"
+	// Summary is the template type for natural language answers summarizing query results
+	Summary TemplateType = "summaries"
+	// Plan is the template type for plans of queries over several databases
+	Plan TemplateType = "system_prompts/federated"
+	// Agent is the template type for the turns of multi-step questions
+	Agent TemplateType = "system_prompts/agent"
+	// Visualization is the template type for choosing how to chart query results
+	Visualization TemplateType = "system_prompts/visualization"
+	// Clarification is the template type for the user's answers to clarifying questions
+	Clarification TemplateType = "clarifications"
 )
 
+// funcMap holds the helper functions available to templates
+var funcMap = template.FuncMap{
+	"toJson": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	},
+}
+
 type TemplateManager struct {
 	templates map[TemplateType]map[string]string
 	mu        sync.RWMutex
@@ -138,17 +159,6 @@ func (tm *TemplateManager) ExecuteTemplate(templateType TemplateType, dbType, te
 		return "", fmt.Errorf("template %s/%s/%s not found: %w", templateType, dbType, templateName, err)
 	}
 
-	// Create a new template with helper functions
-	funcMap := template.FuncMap{
-		"toJson": func(v interface{}) (string, error) {
-			b, err := json.Marshal(v)
-			if err != nil {
-				return "", err
-			}
-			return string(b), nil
-		},
-	}
-
 	tmpl, err := template.New(templateName).Funcs(funcMap).Parse(tmplContent)
 	if err != nil {
 		return "", fmt.Errorf("error parsing template: %w", err)
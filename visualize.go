@@ -8,10 +8,15 @@ import (
 	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/vijaylingoju/prompterdb/db"
 	"github.com/vijaylingoju/prompterdb/llm"
 	"github.com/vijaylingoju/prompterdb/templates"
 )
 
+// visualizationRows is the number of rows shown to the LLM to suggest a widget type
+const visualizationRows = 5
+
 // WidgetType represents the type of visualization widget
 type WidgetType string
 
@@ -32,84 +37,71 @@ type WidgetConfig struct {
 	CreatedAt   time.Time             `json:"created_at"`
 }
 
-// Visualize converts query results into widget configurations using the specified template and LLM client
+// Visualize converts query results into widget configurations using the specified template and LLM client.
+// Columns are ordered by name; use VisualizeResultSet to keep the query's column order.
 func Visualize(
 	results []map[string]interface{},
 	templateName string,
 	tm *templates.TemplateManager,
 	llmClient llm.LLM,
+) ([]WidgetConfig, error) {
+	return VisualizeResultSet(db.NewResultSet(results), templateName, tm, llmClient)
+}
+
+// VisualizeResultSet converts a result set into widget configurations, keeping its column order
+// and using the column types to pick chart fields. The LLM suggests the widget type with the
+// system_prompts/visualization/<templateName>.tmpl template of tm, or default.tmpl.
+func VisualizeResultSet(
+	rs *db.ResultSet,
+	templateName string,
+	tm *templates.TemplateManager,
+	llmClient llm.LLM,
+) ([]WidgetConfig, error) {
+	return visualizeResultSet(rs, templateName, tm, llmClient, llmClient.GenerateQuery)
+}
+
+// visualizeResultSet is VisualizeResultSet with the LLM call made by generate, so Ask
+// can enforce the tenant's budget and record the usage of the suggestion
+func visualizeResultSet(
+	rs *db.ResultSet,
+	templateName string,
+	tm *templates.TemplateManager,
+	llmClient llm.LLM,
+	generate func(llm.QueryRequest) (*llm.QueryResponse, error),
 ) ([]WidgetConfig, error) {
 	log.Println("Starting visualization process...")
-	if len(results) == 0 {
+	if rs == nil || len(rs.Rows) == 0 {
 		log.Println("No results to visualize")
 		return nil, fmt.Errorf("no results to visualize")
 	}
 
-	log.Printf("Processing %d result rows", len(results))
-
-	// Convert results to JSON for LLM analysis
-	resultsJSON, err := json.MarshalIndent(results, "", "  ")
-	if err != nil {
-		log.Printf("Error marshaling results to JSON: %v", err)
-		return nil, fmt.Errorf("error preparing data for visualization: %w", err)
-	}
+	log.Printf("Processing %d result rows", len(rs.Rows))
 
 	// Check if the user specifically asked for a pie chart in the template name
 	if strings.Contains(strings.ToLower(templateName), "pie") {
-		// Try to find a numeric column for the pie chart
-		var valueField string
-		if len(results) > 0 {
-			for col, val := range results[0] {
-				if _, ok := val.(float64); ok || val == nil {
-					valueField = col
-					break
-				}
+		// Use the first numeric column for values and the first string column for categories
+		var valueField, categoryField string
+		for _, col := range rs.Columns {
+			if col.Type == db.TypeNumber && valueField == "" {
+				valueField = col.Name
+			} else if col.Type == db.TypeString && categoryField == "" {
+				categoryField = col.Name
 			}
 		}
 
-		// If no numeric field found, try common names
-		if valueField == "" {
-			possibleFields := []string{"count", "total", "value", "amount", "quantity"}
-			for _, field := range possibleFields {
-				if _, exists := results[0][field]; exists {
-					valueField = field
-					break
-				}
-			}
-		}
-
-		// If we found a value field, try to create a pie chart
-		if valueField != "" {
-			// Find a category field (non-numeric)
-			var categoryField string
-			for col, val := range results[0] {
-				if col != valueField && val != nil {
-					categoryField = col
-					break
-				}
-			}
-
-			if categoryField != "" {
-				widgets, err := createPieChartWidget(results, categoryField, valueField)
-				if err == nil {
-					return widgets, nil
-				}
-				log.Printf("Warning: Could not create pie chart: %v", err)
+		if valueField != "" && categoryField != "" {
+			widgets, err := createPieChartWidget(rs, categoryField, valueField)
+			if err == nil {
+				return widgets, nil
 			}
+			log.Printf("Warning: Could not create pie chart: %v", err)
 		}
 	}
 
-	// Create a direct prompt for the LLM to suggest visualization type
-	prompt := fmt.Sprintf(`Analyze the following query results and suggest the best visualization type (table, bar-chart, pie-chart, line-chart). 
-Consider the data types and relationships in the results. Respond with only the visualization type, nothing else.
-
-Results:
-%s`, resultsJSON)
+	log.Println("Sending results to LLM for visualization suggestion...")
 
-	log.Println("Sending prompt to LLM for visualization suggestion...")
-	
 	// Try to get visualization suggestion from LLM
-	widgetTypeStr, err := getVisualizationSuggestion(llmClient, prompt)
+	widgetTypeStr, err := getVisualizationSuggestion(rs, templateName, tm, llmClient, generate)
 	if err != nil {
 		log.Printf("Error getting visualization suggestion from LLM: %v", err)
 		// Default to table view if LLM fails
@@ -121,7 +113,7 @@ Results:
 	log.Printf("LLM suggested visualization type: %s", widgetType)
 
 	// Create widget configuration based on the suggested type
-	widget, err := createWidget(results, widgetType, templateName)
+	widget, err := createWidget(rs, widgetType, templateName)
 	if err != nil {
 		log.Printf("Error creating widget: %v", err)
 		return nil, fmt.Errorf("error creating widget: %w", err)
@@ -133,7 +125,7 @@ Results:
 
 // normalizeWidgetType ensures the widget type is one of the supported types
 func normalizeWidgetType(widgetType string) WidgetType {
-	switch strings.ToLower(widgetType) {
+	switch strings.Trim(strings.ToLower(widgetType), " \t\r\n\"'`.") {
 	case "bar", "barchart", "bar-chart":
 		return WidgetTypeBarChart
 	case "pie", "piechart", "pie-chart":
@@ -145,18 +137,13 @@ func normalizeWidgetType(widgetType string) WidgetType {
 	}
 }
 
-// createWidget creates a widget configuration based on the results and widget type
-func createWidget(results []map[string]interface{}, widgetType WidgetType, templateName string) (WidgetConfig, error) {
-	if len(results) == 0 {
+// createWidget creates a widget configuration based on the results and widget type.
+// Rows are value slices in the order of columns.
+func createWidget(rs *db.ResultSet, widgetType WidgetType, templateName string) (WidgetConfig, error) {
+	if len(rs.Rows) == 0 {
 		return WidgetConfig{}, fmt.Errorf("no results to create widget")
 	}
 
-	// Extract column names from the first result
-	var columns []string
-	for col := range results[0] {
-		columns = append(columns, col)
-	}
-
 	// Create basic widget configuration
 	widget := WidgetConfig{
 		ID:          fmt.Sprintf("widget_%d", time.Now().Unix()),
@@ -164,8 +151,9 @@ func createWidget(results []map[string]interface{}, widgetType WidgetType, templ
 		Description: fmt.Sprintf("Visualization of %s data as %s", templateName, widgetType),
 		Type:        widgetType,
 		Data: map[string]interface{}{
-			"columns": columns,
-			"rows":    results,
+			"columns":      rs.ColumnNames(),
+			"column_types": rs.Columns,
+			"rows":         rs.Rows,
 		},
 		CreatedAt: time.Now(),
 	}
@@ -174,26 +162,30 @@ func createWidget(results []map[string]interface{}, widgetType WidgetType, templ
 }
 
 // createPieChartWidget creates a pie chart widget from query results
-func createPieChartWidget(results []map[string]interface{}, categoryField, valueField string) ([]WidgetConfig, error) {
-	if len(results) == 0 {
+func createPieChartWidget(rs *db.ResultSet, categoryField, valueField string) ([]WidgetConfig, error) {
+	if len(rs.Rows) == 0 {
 		return nil, fmt.Errorf("no data to visualize")
 	}
+	categoryIndex, valueIndex := rs.ColumnIndex(categoryField), rs.ColumnIndex(valueField)
+	if categoryIndex < 0 || valueIndex < 0 {
+		return nil, fmt.Errorf("unknown pie chart fields %s and %s", categoryField, valueField)
+	}
 
 	// Prepare data for pie chart
 	var data []map[string]interface{}
 	total := 0.0
 
 	// First pass: calculate total for percentages
-	for _, row := range results {
-		if val, ok := row[valueField].(float64); ok {
+	for _, row := range rs.Rows {
+		if val, ok := numericValue(row[valueIndex]); ok {
 			total += val
 		}
 	}
 
 	// Second pass: create data points with percentages
-	for _, row := range results {
-		category, _ := row[categoryField].(string)
-		value, _ := row[valueField].(float64)
+	for _, row := range rs.Rows {
+		category, _ := row[categoryIndex].(string)
+		value, _ := numericValue(row[valueIndex])
 		
 		// Skip if value is zero or category is empty
 		if value == 0 || category == "" {
@@ -227,17 +219,11 @@ func createPieChartWidget(results []map[string]interface{}, categoryField, value
 }
 
 // createTableWidget creates a simple table widget from query results
-func createTableWidget(results []map[string]interface{}) []WidgetConfig {
-	if len(results) == 0 {
+func createTableWidget(rs *db.ResultSet) []WidgetConfig {
+	if len(rs.Rows) == 0 {
 		return []WidgetConfig{}
 	}
 
-	// Extract column names from first row
-	var columns []string
-	for col := range results[0] {
-		columns = append(columns, col)
-	}
-
 	return []WidgetConfig{
 		{
 			ID:          "table_" + strconv.FormatInt(time.Now().Unix(), 10),
@@ -245,29 +231,85 @@ func createTableWidget(results []map[string]interface{}) []WidgetConfig {
 			Description: "Tabular view of query results",
 			Type:        WidgetTypeTable,
 			Data: map[string]interface{}{
-				"columns": columns,
-				"rows":    results,
+				"columns":      rs.ColumnNames(),
+				"column_types": rs.Columns,
+				"rows":         rs.Rows,
 			},
 		},
 	}
 }
 
-// getVisualizationSuggestion gets a visualization suggestion using a direct API call
-func getVisualizationSuggestion(llmClient llm.LLM, prompt string) (string, error) {
-	// For now, we'll use a simple heuristic based on the prompt
-	// This avoids any template system issues
-	if strings.Contains(strings.ToLower(prompt), "pie") {
-		return "pie-chart", nil
+// numericValue converts the numeric values drivers return to float64
+func numericValue(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	case pgtype.Numeric:
+		f, err := n.Float64Value()
+		return f.Float64, err == nil && f.Valid
 	}
-	if strings.Contains(strings.ToLower(prompt), "bar") {
-		return "bar-chart", nil
+	return 0, false
+}
+
+// getVisualizationSuggestion asks the LLM for the widget type of a result, showing it the
+// first rows with the visualization template of the given name, or the default one.
+// The default templates are used when tm is nil. The request is sent with generate.
+func getVisualizationSuggestion(
+	rs *db.ResultSet,
+	templateName string,
+	tm *templates.TemplateManager,
+	llmClient llm.LLM,
+	generate func(llm.QueryRequest) (*llm.QueryResponse, error),
+) (string, error) {
+	if tm == nil {
+		loaded, err := useDefaultTemplates(llmClient)
+		if err != nil {
+			return "", err
+		}
+		tm = loaded
+	} else {
+		llmClient.SetTemplateManager(tm)
+	}
+	if !tm.HasTemplate(templates.Visualization, "visualization", templateName) {
+		templateName = "default"
+	}
+
+	preview := &db.ResultSet{Columns: rs.Columns, Rows: rs.Rows}
+	if len(preview.Rows) > visualizationRows {
+		preview.Rows = preview.Rows[:visualizationRows]
 	}
-	if strings.Contains(strings.ToLower(prompt), "line") {
-		return "line-chart", nil
+	previewJSON, err := json.MarshalIndent(preview, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error preparing data for visualization: %w", err)
 	}
-	
-	// Default to table view
-	return "table", nil
+
+	req := llm.QueryRequest{
+		DBType:    "visualization",
+		Template:  templateName,
+		QueryType: llm.QueryTypeVisualization,
+		CustomVars: map[string]interface{}{
+			"Results":  string(previewJSON),
+			"RowCount": len(rs.Rows),
+		},
+	}
+	resp, err := generate(req)
+	if err != nil {
+		return "", err
+	}
+	return resp.Query, nil
 }
 
 // PrintWidgetConfig prints the widget configuration in a readable format
@@ -280,10 +322,13 @@ func PrintWidgetConfig(widgets []WidgetConfig) {
 		fmt.Printf("Description: %s\n", widget.Description)
 		
 		// Print a summary of the data
-		if data, ok := widget.Data["rows"].([]map[string]interface{}); ok && len(data) > 0 {
+		columns, _ := widget.Data["columns"].([]string)
+		if data, ok := widget.Data["rows"].([][]interface{}); ok && len(data) > 0 {
 			fmt.Printf("\nData Preview (first row of %d):\n", len(data))
-			for k, v := range data[0] {
-				fmt.Printf("  %s: %v\n", k, v)
+			for i, col := range columns {
+				if i < len(data[0]) {
+					fmt.Printf("  %s: %v\n", col, data[0][i])
+				}
 			}
 		}
 		